@@ -0,0 +1,70 @@
+// Author:: Jonathan Hartman (<j@p4nt5.com>)
+//
+// Copyright (C) 2014, Jonathan Hartman
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package goulash implements a Go client library for the Chef Supermarket API.
+
+This file defines the errors a Supermarket's API responds with when it refuses
+a request, which have a code and any number of messages, e.g.
+
+	{
+	  "error_code": "INVALID_DATA",
+	  "error_messages": ["Version already exists"]
+	}
+*/
+package goulash
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// APIError implements an error response from a Supermarket.
+type APIError struct {
+	StatusCode int      `json:"-"`
+	Code       string   `json:"error_code"`
+	Messages   []string `json:"error_messages"`
+}
+
+// Error returns an APIError's code and messages, or its HTTP status if the
+// Supermarket didn't say anything more.
+func (e *APIError) Error() string {
+	if e.Code == "" && len(e.Messages) == 0 {
+		return http.StatusText(e.StatusCode)
+	}
+	return e.Code + ": " + strings.Join(e.Messages, "; ")
+}
+
+// ValidationError implements an APIError for a request the Supermarket found
+// invalid, e.g. sharing a cookbook version that already exists.
+type ValidationError struct {
+	APIError
+}
+
+// newAPIError reads an error response into an APIError, or a ValidationError
+// if its code is INVALID_DATA.
+func newAPIError(resp *http.Response) (err error) {
+	e := APIError{StatusCode: resp.StatusCode}
+	data, _ := io.ReadAll(resp.Body)
+	// Not every error response is JSON, e.g. one from a proxy
+	json.Unmarshal(data, &e)
+	if e.Code == "INVALID_DATA" {
+		return &ValidationError{e}
+	}
+	return &e
+}
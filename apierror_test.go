@@ -0,0 +1,42 @@
+package goulash
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestAPIErrorError(t *testing.T) {
+	for _, i := range [][]interface{}{
+		{(&APIError{StatusCode: 404}).Error(), "Not Found"},
+		{(&APIError{StatusCode: 401, Code: "UNAUTHORIZED", Messages: []string{"Bad", "Worse"}}).Error(), "UNAUTHORIZED: Bad; Worse"},
+		{(&ValidationError{APIError{StatusCode: 400, Code: "INVALID_DATA"}}).Error(), "INVALID_DATA: "},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+}
+
+func TestNewAPIError(t *testing.T) {
+	resp := func(status int, body string) *http.Response {
+		return &http.Response{StatusCode: status, Body: io.NopCloser(strings.NewReader(body))}
+	}
+	verr, isValidation := newAPIError(resp(400, `{"error_code": "INVALID_DATA", "error_messages": ["Nope"]}`)).(*ValidationError)
+	aerr, isAPI := newAPIError(resp(403, `{"error_code": "FORBIDDEN", "error_messages": ["Nope"]}`)).(*APIError)
+	perr, isPlain := newAPIError(resp(502, `<html>Bad Gateway</html>`)).(*APIError)
+	for _, i := range [][]interface{}{
+		{isValidation, true},
+		{verr.StatusCode, 400},
+		{verr.Messages[0], "Nope"},
+		{isAPI, true},
+		{aerr.Code, "FORBIDDEN"},
+		{isPlain, true},
+		{perr.Error(), "Bad Gateway"},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+}
@@ -18,24 +18,41 @@
 Package goulash implements a Go client library for the Chef Supermarket API.
 
 This file defines an APIInstance struct, representing an API conection to be
-consumed by other Goulash components.
+consumed by other Goulash components. Every request a component makes goes
+through its APIInstance, so one with a Signer can reach a Chef Server.
 */
 package goulash
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
+	"io"
 	"net/http"
 
 	"github.com/RoboticCheese/goulash/common"
 )
 
-// APIInstance implements a struct for the API connection.
+// ErrNoAPIInstance is returned by requests made without an APIInstance, e.g.
+// updating a Universe built from cookbooks on disk or deleting a Cookbook
+// that wasn't fetched from an API.
+var ErrNoAPIInstance = errors.New("no APIInstance to make the request with")
+
+// APIInstance implements a struct for the API connection. Requests that
+// change a Supermarket, e.g. deleting a cookbook, are made as the user its
+// Signer signs for, who must be allowed to make them, usually by maintaining
+// the cookbook.
 type APIInstance struct {
 	Component
-	BaseURL string
-	Version string
+	BaseURL    string
+	Version    string
+	ChefServer bool    // Whether BaseURL is a Chef Server organization
+	Signer     *Signer `json:"-" goulash:"nodiff"`
 }
 
+var _ common.Supermarketer[*APIInstance] = (*APIInstance)(nil)
+
 // NewAPIInstance initializes and returns a new API instance based on a
 // Supermarket URL.
 func NewAPIInstance(url string) (i *APIInstance, err error) {
@@ -52,6 +69,34 @@ func NewAPIInstance(url string) (i *APIInstance, err error) {
 	if err != nil {
 		return
 	}
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		err = errors.New(resp.Status)
+	}
+	return
+}
+
+// NewChefServerAPIInstance initializes and returns a new API instance based
+// on a Chef Server organization URL, e.g.
+// https://chef.example.com/organizations/myorg, signing every request with a
+// Signer.
+func NewChefServerAPIInstance(url string, s *Signer) (i *APIInstance, err error) {
+	i = InitAPIInstance()
+	i.BaseURL = url
+	i.ChefServer = true
+	i.Signer = s
+	i.Component, err = newComponent(context.Background(), i, i.BaseURL)
+	if err != nil {
+		return
+	}
+	i.Endpoint = i.BaseURL
+	// A Chef Server has no /status for an organization; reading the
+	// organization checks both the URL and the credentials
+	resp, err := i.get(context.Background(), i.BaseURL)
+	if err != nil {
+		return
+	}
+	resp.Body.Close()
 	if resp.StatusCode != 200 {
 		err = errors.New(resp.Status)
 	}
@@ -70,3 +115,104 @@ func (a *APIInstance) Empty() (empty bool) {
 	empty = common.Empty(a)
 	return
 }
+
+// Equals implements an equality test for an APIInstance.
+func (a *APIInstance) Equals(a2 *APIInstance, opts ...common.Option) (res bool) {
+	res = common.Equals(a, a2, opts...)
+	return
+}
+
+// Diff returns any attributes that have changed from one APIInstance struct
+// to another.
+func (a *APIInstance) Diff(a2 *APIInstance, opts ...common.Option) (pos, neg *APIInstance) {
+	pos, neg = common.TypedDiff(a, a2, opts...)
+	return
+}
+
+// Clone returns a deep copy of an APIInstance struct.
+func (a *APIInstance) Clone() (res *APIInstance) {
+	res = common.Clone(a)
+	return
+}
+
+// get makes a GET request through an APIInstance, which may be nil.
+func (a *APIInstance) get(ctx context.Context, url string) (resp *http.Response, err error) {
+	resp, err = a.do(ctx, "GET", url)
+	return
+}
+
+// head makes a HEAD request through an APIInstance, which may be nil.
+func (a *APIInstance) head(ctx context.Context, url string) (resp *http.Response, err error) {
+	resp, err = a.do(ctx, "HEAD", url)
+	return
+}
+
+// do makes a request, signed if the APIInstance has a Signer.
+func (a *APIInstance) do(ctx context.Context, method, url string) (resp *http.Response, err error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return
+	}
+	resp, err = a.send(req)
+	return
+}
+
+// call makes a request as the user the APIInstance's Signer signs for, as
+// request does.
+func (a *APIInstance) call(ctx context.Context, method, url string, body, res interface{}) (err error) {
+	if a == nil {
+		return ErrNoAPIInstance
+	}
+	if a.Signer == nil {
+		return ErrNoSigner
+	}
+	err = a.request(ctx, method, url, body, res)
+	return
+}
+
+// request makes a request, with a JSON body if body isn't nil, and decodes a
+// JSON response into res if it isn't nil. An error response is returned as
+// an APIError.
+func (a *APIInstance) request(ctx context.Context, method, url string, body, res interface{}) (err error) {
+	var r io.Reader
+	if body != nil {
+		var data []byte
+		data, err = json.Marshal(body)
+		if err != nil {
+			return
+		}
+		r = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, r)
+	if err != nil {
+		return
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := a.send(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return newAPIError(resp)
+	}
+	if res != nil {
+		err = json.NewDecoder(resp.Body).Decode(res)
+	}
+	return
+}
+
+// send signs a request if the APIInstance has a Signer and sends it.
+func (a *APIInstance) send(req *http.Request) (resp *http.Response, err error) {
+	if a != nil && a.Signer != nil {
+		err = a.Signer.Sign(req)
+		if err != nil {
+			return
+		}
+	}
+	resp, err = http.DefaultClient.Do(req)
+	return
+}
@@ -96,3 +96,21 @@ func TestAPIInstanceEmptyHasVersion(t *testing.T) {
 		t.Fatalf("Expected false, got: %v", res)
 	}
 }
+
+func TestAPIInstanceEqualsDiffClone(t *testing.T) {
+	a1 := &APIInstance{BaseURL: "https://example.com", Version: "1"}
+	a2 := a1.Clone()
+	a2.Version = "2"
+	pos, neg := a1.Diff(a2)
+	for _, i := range [][]interface{}{
+		{a1.Equals(a1.Clone()), true},
+		{a1.Equals(a2), false},
+		{a1.Version, "1"},
+		{*pos, APIInstance{Version: "2"}},
+		{*neg, APIInstance{Version: "1"}},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+}
@@ -0,0 +1,83 @@
+// Author:: Jonathan Hartman (<j@p4nt5.com>)
+//
+// Copyright (C) 2014, Jonathan Hartman
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Command goulash-mirror syncs and serves a local, read-only Supermarket.
+
+Usage:
+
+	goulash-mirror sync [-dir DIR] [-source URL] [COOKBOOK...]
+	goulash-mirror serve [-dir DIR] [-listen ADDR] [-base-url URL]
+
+sync brings the mirror's universe up to date and downloads every version of
+each cookbook named. serve serves the mirror over HTTP, and needs no access to
+the original server.
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/RoboticCheese/goulash/mirror"
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage:")
+	fmt.Fprintln(os.Stderr, "  goulash-mirror sync [-dir DIR] [-source URL] [COOKBOOK...]")
+	fmt.Fprintln(os.Stderr, "  goulash-mirror serve [-dir DIR] [-listen ADDR] [-base-url URL]")
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	flags := flag.NewFlagSet(os.Args[1], flag.ExitOnError)
+	dir := flags.String("dir", "mirror", "directory to keep the mirror in")
+
+	switch os.Args[1] {
+	case "sync":
+		source := flags.String("source", "https://supermarket.chef.io", "Supermarket to mirror")
+		flags.Parse(os.Args[2:])
+		m, err := mirror.Open(*dir)
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = m.Sync(*source, flags.Args()...)
+		if err != nil {
+			log.Fatal(err)
+		}
+	case "serve":
+		listen := flags.String("listen", ":8080", "address to listen on")
+		baseURL := flags.String("base-url", "", "URL the mirror is reached at; defaults to each request's host")
+		flags.Parse(os.Args[2:])
+		m, err := mirror.Open(*dir)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if m.Universe() == nil {
+			log.Fatal(mirror.ErrNotSynced)
+		}
+		m.BaseURL = *baseURL
+		log.Fatal(http.ListenAndServe(*listen, m))
+	default:
+		usage()
+	}
+}
@@ -0,0 +1,94 @@
+// Author:: Jonathan Hartman (<j@p4nt5.com>)
+//
+// Copyright (C) 2014, Jonathan Hartman
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package goulash implements a Go client library for the Chef Supermarket API.
+
+This file defines the users around a Cookbook: its collaborators, who can
+share new versions of it alongside its maintainer, and its followers, who
+Metrics.Followers counts. Both are listed as users, e.g.
+
+https://supermarket.chef.io/api/v1/cookbooks/chef-dk/collaborators =>
+
+	[
+		{"username": "someuser"},
+		{"username": "otheruser"}
+	]
+*/
+package goulash
+
+import (
+	"context"
+	"net/url"
+)
+
+// apiUser is a user as a list of them represents it.
+type apiUser struct {
+	Username string `json:"username"`
+}
+
+// Collaborators returns the usernames of a cookbook's collaborators.
+func (c *Cookbook) Collaborators() (users []string, err error) {
+	users, err = c.users("/collaborators")
+	return
+}
+
+// AddCollaborator makes a user a collaborator on a cookbook.
+func (c *Cookbook) AddCollaborator(ctx context.Context, username string) (err error) {
+	body := map[string]string{"username": username}
+	err = c.api.call(ctx, "POST", c.Endpoint+"/collaborators", body, nil)
+	return
+}
+
+// RemoveCollaborator stops a user being a collaborator on a cookbook. A
+// maintainer can remove anyone and a collaborator can remove themself.
+func (c *Cookbook) RemoveCollaborator(ctx context.Context, username string) (err error) {
+	err = c.api.call(ctx, "DELETE", c.Endpoint+"/collaborators/"+url.PathEscape(username), nil, nil)
+	return
+}
+
+// Followers returns the usernames of a cookbook's followers.
+func (c *Cookbook) Followers() (users []string, err error) {
+	users, err = c.users("/followers")
+	return
+}
+
+// Follow makes the signed in user a follower of a cookbook.
+func (c *Cookbook) Follow(ctx context.Context) (err error) {
+	err = c.api.call(ctx, "PUT", c.Endpoint+"/follow", nil, nil)
+	return
+}
+
+// Unfollow stops the signed in user following a cookbook.
+func (c *Cookbook) Unfollow(ctx context.Context) (err error) {
+	err = c.api.call(ctx, "DELETE", c.Endpoint+"/unfollow", nil, nil)
+	return
+}
+
+// users returns the usernames in a list of users under a cookbook's
+// endpoint. The request is signed if the APIInstance has a Signer.
+func (c *Cookbook) users(path string) (users []string, err error) {
+	var res []apiUser
+	err = c.api.request(context.Background(), "GET", c.Endpoint+path, nil, &res)
+	if err != nil {
+		return
+	}
+	users = []string{}
+	for _, u := range res {
+		users = append(users, u.Username)
+	}
+	return
+}
@@ -0,0 +1,182 @@
+package goulash
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// startUsersServer starts a Supermarket where roboticcheese maintains
+// chef-dk and anyone signed in can follow it.
+func startUsersServer(t *testing.T) (ts *httptest.Server) {
+	users := map[string]map[string]bool{
+		"collaborators": {"someuser": true},
+		"followers":     {"someuser": true, "otheruser": true},
+	}
+	list := func(w http.ResponseWriter, kind string) {
+		res := []apiUser{}
+		for u := range users[kind] {
+			res = append(res, apiUser{u})
+		}
+		sort.Slice(res, func(i, j int) bool { return res[i].Username < res[j].Username })
+		json.NewEncoder(w).Encode(res)
+	}
+	ts = StartHTTP(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.Path, "/api/v1/cookbooks/chef-dk")
+		if r.Method == "GET" {
+			switch path {
+			case "":
+				fmt.Fprint(w, cjsonified())
+			case "/collaborators":
+				list(w, "collaborators")
+			case "/followers":
+				list(w, "followers")
+			}
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		if verifySignature(&signerKey(t).PublicKey, r) != nil {
+			w.WriteHeader(401)
+			fmt.Fprint(w, `{"error_code": "UNAUTHORIZED", "error_messages": ["Bad signature"]}`)
+			return
+		}
+		user := r.Header.Get("X-Ops-Userid")
+		switch {
+		case r.Method == "PUT" && path == "/follow":
+			users["followers"][user] = true
+		case r.Method == "DELETE" && path == "/unfollow":
+			delete(users["followers"], user)
+		case user != "roboticcheese" && !(r.Method == "DELETE" && path == "/collaborators/"+user):
+			w.WriteHeader(403)
+			fmt.Fprint(w, `{"error_code": "FORBIDDEN", "error_messages": ["You are not authorized to perform this action"]}`)
+		case r.Method == "POST" && path == "/collaborators":
+			params := map[string]string{}
+			json.Unmarshal(body, &params)
+			if params["username"] == "nobody" {
+				w.WriteHeader(400)
+				fmt.Fprint(w, `{"error_code": "INVALID_DATA", "error_messages": ["User does not exist"]}`)
+				return
+			}
+			users["collaborators"][params["username"]] = true
+			w.WriteHeader(201)
+		case r.Method == "DELETE" && strings.HasPrefix(path, "/collaborators/"):
+			delete(users["collaborators"], strings.TrimPrefix(path, "/collaborators/"))
+		default:
+			http.NotFound(w, r)
+		}
+	}, nil)
+	return
+}
+
+func TestCookbookCollaborators(t *testing.T) {
+	ts := startUsersServer(t)
+	defer ts.Close()
+	c, _ := NewCookbook(maintainerAPIInstance(t, ts, "roboticcheese"), "chef-dk")
+
+	before, err := c.Collaborators()
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	err = c.AddCollaborator(context.Background(), "newuser")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	err = c.RemoveCollaborator(context.Background(), "someuser")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	after, err := c.Collaborators()
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	for _, i := range [][]interface{}{
+		{len(before), 1},
+		{before[0], "someuser"},
+		{len(after), 1},
+		{after[0], "newuser"},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+
+	err = c.AddCollaborator(context.Background(), "nobody")
+	if _, ok := err.(*ValidationError); !ok {
+		t.Fatalf("Expected a ValidationError, got: %v", err)
+	}
+}
+
+func TestCookbookCollaboratorsNotMaintainer(t *testing.T) {
+	ts := startUsersServer(t)
+	defer ts.Close()
+	c, _ := NewCookbook(maintainerAPIInstance(t, ts, "someuser"), "chef-dk")
+
+	err := c.AddCollaborator(context.Background(), "newuser")
+	aerr, ok := err.(*APIError)
+	if !ok || aerr.StatusCode != 403 {
+		t.Fatalf("Expected a 403 APIError, got: %v", err)
+	}
+	err = c.RemoveCollaborator(context.Background(), "someuser")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	c.api.Signer = nil
+	err = c.RemoveCollaborator(context.Background(), "someuser")
+	if err != ErrNoSigner {
+		t.Fatalf("Expected: %v, got: %v", ErrNoSigner, err)
+	}
+	users, err := c.Collaborators()
+	if err != nil || len(users) != 0 {
+		t.Fatalf("Expected no collaborators, got: %v, %v", users, err)
+	}
+}
+
+func TestCookbookFollowers(t *testing.T) {
+	ts := startUsersServer(t)
+	defer ts.Close()
+	c, _ := NewCookbook(maintainerAPIInstance(t, ts, "newuser"), "chef-dk")
+
+	before, err := c.Followers()
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = c.Follow(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected: %v, got: %v", context.Canceled, err)
+	}
+	err = c.Follow(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	following, _ := c.Followers()
+	err = c.Unfollow(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	after, _ := c.Followers()
+	for _, i := range [][]interface{}{
+		{strings.Join(before, ","), "otheruser,someuser"},
+		{strings.Join(following, ","), "newuser,otheruser,someuser"},
+		{strings.Join(after, ","), "otheruser,someuser"},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+
+	_, err = InitCookbook().Followers()
+	if err == nil {
+		t.Fatalf("Expected an error, got: %v", err)
+	}
+}
@@ -0,0 +1,267 @@
+// Author:: Jonathan Hartman (<j@p4nt5.com>)
+//
+// Copyright (C) 2014, Jonathan Hartman
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package common implements a shared set of Goulash functionality.
+
+This file defines Apply, the inverse of Diff. Given a base struct and the
+positive and negative diffs from it to some other struct, Apply rebuilds that
+other struct, so a saved snapshot plus a sequence of diffs reconstructs the
+current state.
+*/
+package common
+
+import (
+	"reflect"
+)
+
+// Apply returns a new struct of the same type as base with a positive and
+// negative diff, as returned by Diff, applied to it. Either diff may be nil.
+// The base and diffs are left unmodified and nothing in the result is shared
+// with them. Slices are treated as sets, or matched by key, as they are by
+// Diff, so elements added to a slice are appended to it, and a slice emptied
+// by a diff comes back empty rather than nil.
+func Apply(base Emptier, pos Emptier, neg Emptier) Emptier {
+	vbase := reflect.ValueOf(base)
+	res := applyValue(vbase, reflect.ValueOf(pos), reflect.ValueOf(neg), vbase.Type())
+	return res.Interface().(Emptier)
+}
+
+// applyValue implements the iterable portion of Apply, returning a new value
+// of type t. Any of the base, positive, and negative values may be invalid.
+func applyValue(base reflect.Value, pos reflect.Value, neg reflect.Value, t reflect.Type) (res reflect.Value) {
+	kind := t.Kind()
+	if t == timeType {
+		kind = reflect.Invalid
+	}
+	switch kind {
+	case reflect.Ptr:
+		if nilValue(base) {
+			return cloneValue(pos, t)
+		}
+		res = reflect.New(t.Elem())
+		res.Elem().Set(applyValue(elemValue(base), elemValue(pos), elemValue(neg), t.Elem()))
+	case reflect.Struct:
+		res = reflect.New(t).Elem()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			res.Field(i).Set(applyValue(fieldValue(base, i), fieldValue(pos, i), fieldValue(neg, i), f.Type))
+		}
+	case reflect.Array:
+		res = reflect.New(t).Elem()
+		for i := 0; i < t.Len(); i++ {
+			res.Index(i).Set(applyValue(indexValue(base, i), indexValue(pos, i), indexValue(neg, i), t.Elem()))
+		}
+	case reflect.Map:
+		if nilValue(base) && nilValue(pos) {
+			return reflect.Zero(t)
+		}
+		res = reflect.MakeMap(t)
+		if !nilValue(base) {
+			for _, k := range base.MapKeys() {
+				b := base.MapIndex(k)
+				p := mapIndex(pos, k)
+				n := mapIndex(neg, k)
+				// Diff puts a removed entry in its entirety in the negative
+				// diff; anything less is a partial change to that entry
+				if !p.IsValid() && n.IsValid() && equalValue(b, n, nil, "") {
+					continue
+				}
+				res.SetMapIndex(k, applyValue(b, p, n, t.Elem()))
+			}
+		}
+		if !nilValue(pos) {
+			for _, k := range pos.MapKeys() {
+				if !mapIndex(base, k).IsValid() {
+					res.SetMapIndex(k, cloneValue(pos.MapIndex(k), t.Elem()))
+				}
+			}
+		}
+	case reflect.Slice:
+		if nilValue(base) && nilValue(pos) {
+			return reflect.Zero(t)
+		}
+		if key, ok := sliceKey(t); ok {
+			return applyKeyedSlice(base, pos, neg, t, key)
+		}
+		res = reflect.MakeSlice(t, 0, 0)
+		if !nilValue(base) {
+			for i := 0; i < base.Len(); i++ {
+				if nilValue(neg) || !containsValue(neg, base.Index(i), nil, "") {
+					res = reflect.Append(res, cloneValue(base.Index(i), t.Elem()))
+				}
+			}
+		}
+		if !nilValue(pos) {
+			for i := 0; i < pos.Len(); i++ {
+				if !containsValue(res, pos.Index(i), nil, "") {
+					res = reflect.Append(res, cloneValue(pos.Index(i), t.Elem()))
+				}
+			}
+		}
+	default:
+		switch {
+		case pos.IsValid() && !emptyValue(pos):
+			res = cloneValue(pos, t)
+		case neg.IsValid() && !emptyValue(neg) && equalValue(base, neg, nil, ""):
+			res = reflect.Zero(t)
+		default:
+			res = cloneValue(base, t)
+		}
+	}
+	return
+}
+
+// applyKeyedSlice implements the portion of Apply for slices whose elements
+// are matched by a key field. As with maps, an element is removed when the
+// negative diff holds it in its entirety; anything less is a partial change.
+func applyKeyedSlice(base reflect.Value, pos reflect.Value, neg reflect.Value, t reflect.Type, key int) (res reflect.Value) {
+	res = reflect.MakeSlice(t, 0, 0)
+	if !nilValue(base) {
+		for i := 0; i < base.Len(); i++ {
+			b := base.Index(i)
+			k := keyValue(b, key)
+			p := findKey(pos, key, k)
+			n := findKey(neg, key, k)
+			if !p.IsValid() && n.IsValid() && equalValue(b, n, nil, "") {
+				continue
+			}
+			res = reflect.Append(res, applyValue(b, p, n, t.Elem()))
+		}
+	}
+	if !nilValue(pos) {
+		for i := 0; i < pos.Len(); i++ {
+			p := pos.Index(i)
+			if !findKey(base, key, keyValue(p, key)).IsValid() {
+				res = reflect.Append(res, cloneValue(p, t.Elem()))
+			}
+		}
+	}
+	return
+}
+
+// cloneValue returns a deep copy of a value of type t, or the zero value of
+// t if the value is invalid. Unexported struct fields are left at their zero
+// values.
+func cloneValue(v reflect.Value, t reflect.Type) (res reflect.Value) {
+	if !v.IsValid() {
+		return reflect.Zero(t)
+	}
+	kind := v.Kind()
+	if v.Type() == timeType {
+		kind = reflect.Invalid
+	}
+	switch kind {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return reflect.Zero(t)
+		}
+		res = reflect.New(t.Elem())
+		res.Elem().Set(cloneValue(v.Elem(), t.Elem()))
+	case reflect.Interface:
+		if v.IsNil() {
+			return reflect.Zero(t)
+		}
+		res = reflect.New(t).Elem()
+		res.Set(cloneValue(v.Elem(), v.Elem().Type()))
+	case reflect.Struct:
+		res = reflect.New(t).Elem()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			res.Field(i).Set(cloneValue(v.Field(i), f.Type))
+		}
+	case reflect.Map:
+		if v.IsNil() {
+			return reflect.Zero(t)
+		}
+		res = reflect.MakeMapWithSize(t, v.Len())
+		for _, k := range v.MapKeys() {
+			res.SetMapIndex(k, cloneValue(v.MapIndex(k), t.Elem()))
+		}
+	case reflect.Slice:
+		if v.IsNil() {
+			return reflect.Zero(t)
+		}
+		res = reflect.MakeSlice(t, v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			res.Index(i).Set(cloneValue(v.Index(i), t.Elem()))
+		}
+	case reflect.Array:
+		res = reflect.New(t).Elem()
+		for i := 0; i < v.Len(); i++ {
+			res.Index(i).Set(cloneValue(v.Index(i), t.Elem()))
+		}
+	default:
+		res = reflect.New(t).Elem()
+		res.Set(v)
+	}
+	return
+}
+
+// nilValue checks whether a value is invalid or a nil map, slice, or
+// pointer.
+func nilValue(v reflect.Value) bool {
+	if !v.IsValid() {
+		return true
+	}
+	switch v.Kind() {
+	case reflect.Map, reflect.Slice, reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	}
+	return false
+}
+
+// elemValue returns the element of a pointer, or an invalid value if the
+// pointer is invalid or nil.
+func elemValue(v reflect.Value) reflect.Value {
+	if nilValue(v) {
+		return reflect.Value{}
+	}
+	return v.Elem()
+}
+
+// fieldValue returns a field of a struct, or an invalid value if the struct
+// is invalid.
+func fieldValue(v reflect.Value, i int) reflect.Value {
+	if !v.IsValid() {
+		return reflect.Value{}
+	}
+	return v.Field(i)
+}
+
+// indexValue returns an element of an array, or an invalid value if the
+// array is invalid.
+func indexValue(v reflect.Value, i int) reflect.Value {
+	if !v.IsValid() {
+		return reflect.Value{}
+	}
+	return v.Index(i)
+}
+
+// mapIndex returns a map entry, or an invalid value if the map is invalid,
+// nil, or has no such entry.
+func mapIndex(v reflect.Value, k reflect.Value) reflect.Value {
+	if nilValue(v) {
+		return reflect.Value{}
+	}
+	return v.MapIndex(k)
+}
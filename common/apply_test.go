@@ -0,0 +1,68 @@
+package common
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestApplyRoundTrip(t *testing.T) {
+	n1 := ndata()
+	n2 := ndata()
+	n2.Name = "other"
+	n2.Count = 0
+	n2.Tags = []string{"a", "b", "c"}
+	n2.Children["one"].Count = 3
+	n2.Children["two"] = &nested{Name: "two", Children: map[string]*nested{}}
+	n3 := ndata()
+	delete(n3.Children, "one")
+	for _, i := range [][]*nested{{n1, n2}, {n2, n1}, {n1, n3}, {n3, n1}, {n2, n3}} {
+		pos, neg := Diff(i[0], i[1], &nested{}, &nested{})
+		res := Apply(i[0], pos, neg)
+		if !Equals(res, i[1]) {
+			t.Fatalf("Expected %v, got: %v", i[1], res)
+		}
+	}
+}
+
+func TestApplyNilDiffs(t *testing.T) {
+	n := ndata()
+	res := Apply(n, nil, nil)
+	if !Equals(res, n) {
+		t.Fatalf("Expected %v, got: %v", n, res)
+	}
+	if res.(*nested) == n || res.(*nested).Children["one"] == n.Children["one"] {
+		t.Fatalf("Expected a copy, got the original")
+	}
+}
+
+func TestApplySequence(t *testing.T) {
+	states := []*nested{ndata(), ndata(), ndata(), ndata()}
+	states[1].Children["two"] = &nested{Name: "two"}
+	states[2].Children["two"] = &nested{Name: "two", Count: 2}
+	delete(states[2].Children, "one")
+	states[3].Children["two"] = &nested{Name: "two", Count: 2}
+	states[3].Tags = []string{}
+	type diff struct{ pos, neg Emptier }
+	diffs := []diff{}
+	for i := 1; i < len(states); i++ {
+		pos, neg := Diff(states[i-1], states[i], &nested{}, &nested{})
+		diffs = append(diffs, diff{pos, neg})
+	}
+	var res Emptier = states[0]
+	for _, d := range diffs {
+		res = Apply(res, d.pos, d.neg)
+	}
+	if !Equals(res, states[3]) {
+		t.Fatalf("Expected %v, got: %v", states[3], res)
+	}
+}
+
+func TestCloneValue(t *testing.T) {
+	n := ndata()
+	res := cloneValue(reflect.ValueOf(n), reflect.TypeOf(n)).Interface().(*nested)
+	res.Children["one"].Name = "changed"
+	res.Tags[0] = "changed"
+	if n.Children["one"].Name != "one" || n.Tags[0] != "a" {
+		t.Fatalf("Expected the original to be unmodified, got: %v", n)
+	}
+}
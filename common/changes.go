@@ -0,0 +1,261 @@
+// Author:: Jonathan Hartman (<j@p4nt5.com>)
+//
+// Copyright (C) 2014, Jonathan Hartman
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package common implements a shared set of Goulash functionality.
+
+This file defines a flat change list, an alternative to the positive and
+negative structs returned by Diff. Each Change names the path of what was
+added, removed, or modified, e.g.
+
+	Cookbooks["nginx"].Versions["2.7.4"].Dependencies["apt"]
+*/
+package common
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ChangeKind identifies whether a Change added, removed, or modified a value.
+type ChangeKind int
+
+// The kinds of Change.
+const (
+	Added ChangeKind = iota
+	Removed
+	Modified
+)
+
+// String returns the name of a ChangeKind.
+func (k ChangeKind) String() (res string) {
+	switch k {
+	case Added:
+		res = "added"
+	case Removed:
+		res = "removed"
+	case Modified:
+		res = "modified"
+	default:
+		res = "unknown"
+	}
+	return
+}
+
+// Change implements a single difference between two structs. Old is
+// nil for an Added change and New is nil for a Removed one.
+type Change struct {
+	Path string
+	Kind ChangeKind
+	Old  interface{}
+	New  interface{}
+}
+
+// String returns a one-line description of a Change.
+func (c Change) String() (res string) {
+	switch c.Kind {
+	case Added:
+		res = fmt.Sprintf("%v %v: %v", c.Kind, c.Path, c.New)
+	case Removed:
+		res = fmt.Sprintf("%v %v: %v", c.Kind, c.Path, c.Old)
+	default:
+		res = fmt.Sprintf("%v %v: %v => %v", c.Kind, c.Path, c.Old, c.New)
+	}
+	return
+}
+
+// Changes returns a list of every change from one struct to another,
+// sorted by path. Map entries and pointers are added or removed; anything
+// else that differs is modified. Slices are compared by membership, so each
+// element is either added or removed, with its index in the slice it came
+// from. Any Options are honored as they are by Diff.
+func Changes(s1 Emptier, s2 Emptier, opts ...Option) (changes []Change) {
+	changesValue("", reflect.ValueOf(s1), reflect.ValueOf(s2), newOptions(opts), &changes)
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+	return
+}
+
+// changesValue implements the iterable portion of a change list, appending a
+// Change for each difference found under a path.
+func changesValue(path string, v1 reflect.Value, v2 reflect.Value, o *options, changes *[]Change) {
+	if !v1.IsValid() && !v2.IsValid() {
+		return
+	}
+	if !v1.IsValid() {
+		*changes = append(*changes, Change{Path: path, Kind: Added, New: v2.Interface()})
+		return
+	}
+	if !v2.IsValid() {
+		*changes = append(*changes, Change{Path: path, Kind: Removed, Old: v1.Interface()})
+		return
+	}
+	if v1.Type() != v2.Type() {
+		*changes = append(*changes, Change{Path: path, Kind: Modified, Old: v1.Interface(), New: v2.Interface()})
+		return
+	}
+
+	if fn, ok := o.comparator(v1); ok {
+		if !fn(v1.Interface(), v2.Interface()) {
+			*changes = append(*changes, Change{Path: path, Kind: Modified, Old: v1.Interface(), New: v2.Interface()})
+		}
+		return
+	}
+
+	kind := v1.Kind()
+	if v1.Type() == timeType {
+		kind = reflect.Invalid
+	}
+	switch kind {
+	case reflect.Ptr, reflect.Interface:
+		switch {
+		case v1.IsNil() && v2.IsNil():
+		case v1.IsNil():
+			*changes = append(*changes, Change{Path: path, Kind: Added, New: v2.Interface()})
+		case v2.IsNil():
+			*changes = append(*changes, Change{Path: path, Kind: Removed, Old: v1.Interface()})
+		default:
+			changesValue(path, v1.Elem(), v2.Elem(), o, changes)
+		}
+	case reflect.Struct:
+		for i := 0; i < v1.NumField(); i++ {
+			f := v1.Type().Field(i)
+			if _, skip := o.skipField(fieldPath(path), f); skip {
+				continue
+			}
+			fpath := f.Name
+			if path != "" {
+				fpath = path + "." + f.Name
+			}
+			changesValue(fpath, v1.Field(i), v2.Field(i), o, changes)
+		}
+	case reflect.Map:
+		keys := append(v1.MapKeys(), v2.MapKeys()...)
+		seen := map[string]bool{}
+		for _, k := range keys {
+			kpath := path + "[" + formatKey(k) + "]"
+			if seen[kpath] {
+				continue
+			}
+			seen[kpath] = true
+			changesValue(kpath, v1.MapIndex(k), v2.MapIndex(k), o, changes)
+		}
+	case reflect.Array:
+		for i := 0; i < v1.Len(); i++ {
+			changesValue(fmt.Sprintf("%v[%v]", path, i), v1.Index(i), v2.Index(i), o, changes)
+		}
+	case reflect.Slice:
+		if key, ok := sliceKey(v1.Type()); ok {
+			keyedChanges(path, v1, v2, key, o, changes)
+			return
+		}
+		for i := 0; i < v1.Len(); i++ {
+			if !containsValue(v2, v1.Index(i), o, fieldPath(path)) {
+				*changes = append(*changes, Change{
+					Path: fmt.Sprintf("%v[%v]", path, i),
+					Kind: Removed,
+					Old:  v1.Index(i).Interface(),
+				})
+			}
+		}
+		for i := 0; i < v2.Len(); i++ {
+			if !containsValue(v1, v2.Index(i), o, fieldPath(path)) {
+				*changes = append(*changes, Change{
+					Path: fmt.Sprintf("%v[%v]", path, i),
+					Kind: Added,
+					New:  v2.Index(i).Interface(),
+				})
+			}
+		}
+	default:
+		if !equalValue(v1, v2, o, fieldPath(path)) {
+			*changes = append(*changes, Change{Path: path, Kind: Modified, Old: v1.Interface(), New: v2.Interface()})
+		}
+	}
+}
+
+// keyedChanges implements the portion of a change list for slices whose
+// elements are matched by a key field, naming each element by its key.
+func keyedChanges(path string, v1 reflect.Value, v2 reflect.Value, key int, o *options, changes *[]Change) {
+	for i := 0; i < v1.Len(); i++ {
+		k := keyValue(v1.Index(i), key)
+		kpath := fmt.Sprintf("%v[%v]", path, i)
+		if k.IsValid() {
+			kpath = path + "[" + formatKey(k) + "]"
+		}
+		changesValue(kpath, v1.Index(i), findKey(v2, key, k), o, changes)
+	}
+	for i := 0; i < v2.Len(); i++ {
+		k := keyValue(v2.Index(i), key)
+		if findKey(v1, key, k).IsValid() {
+			continue
+		}
+		kpath := fmt.Sprintf("%v[%v]", path, i)
+		if k.IsValid() {
+			kpath = path + "[" + formatKey(k) + "]"
+		}
+		*changes = append(*changes, Change{Path: kpath, Kind: Added, New: v2.Index(i).Interface()})
+	}
+}
+
+// containsValue checks whether a slice holds an element equal to a value.
+func containsValue(slice reflect.Value, v reflect.Value, o *options, path string) (found bool) {
+	for i := 0; i < slice.Len(); i++ {
+		if equalValue(slice.Index(i), v, o, path) {
+			found = true
+			break
+		}
+	}
+	return
+}
+
+// fieldPath strips the map keys and slice indexes out of a change path,
+// leaving the dotted struct field path that Options match against.
+func fieldPath(path string) string {
+	var b strings.Builder
+	depth := 0
+	quoted := false
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		switch {
+		case quoted && c == '\\':
+			i++
+		case c == '"' && depth > 0:
+			quoted = !quoted
+		case quoted:
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+		case depth == 0:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// formatKey renders a map key the way it would be written in Go source.
+func formatKey(k reflect.Value) (res string) {
+	if k.Kind() == reflect.String {
+		res = fmt.Sprintf("%q", k.String())
+	} else {
+		res = fmt.Sprint(k.Interface())
+	}
+	return
+}
@@ -0,0 +1,134 @@
+package common
+
+import (
+	"testing"
+)
+
+type nested struct {
+	Name     string
+	Count    int
+	Tags     []string
+	Children map[string]*nested
+}
+
+func (n *nested) Empty() (empty bool) {
+	empty = Empty(n)
+	return
+}
+
+func ndata() *nested {
+	return &nested{
+		Name:  "top",
+		Count: 1,
+		Tags:  []string{"a", "b"},
+		Children: map[string]*nested{
+			"one": {Name: "one", Children: map[string]*nested{}},
+		},
+	}
+}
+
+func TestChangeKindString(t *testing.T) {
+	for _, i := range [][]interface{}{
+		{Added.String(), "added"},
+		{Removed.String(), "removed"},
+		{Modified.String(), "modified"},
+		{ChangeKind(99).String(), "unknown"},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+}
+
+func TestChangeString(t *testing.T) {
+	for _, i := range [][]interface{}{
+		{Change{Path: "Name", Kind: Added, New: "x"}.String(), "added Name: x"},
+		{Change{Path: "Name", Kind: Removed, Old: "x"}.String(), "removed Name: x"},
+		{Change{Path: "Name", Kind: Modified, Old: "x", New: "y"}.String(), "modified Name: x => y"},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+}
+
+func TestChangesEqual(t *testing.T) {
+	res := Changes(ndata(), ndata())
+	if len(res) != 0 {
+		t.Fatalf("Expected no changes, got: %v", res)
+	}
+}
+
+func TestChangesAll(t *testing.T) {
+	n1 := ndata()
+	n2 := ndata()
+	n2.Name = "other"
+	n2.Tags = []string{"b", "c"}
+	n2.Children["one"].Count = 5
+	n2.Children["two"] = &nested{Name: "two"}
+	delete(n1.Children, "missing")
+	n1.Children["gone"] = &nested{Name: "gone"}
+	res := Changes(n1, n2)
+	expected := []Change{
+		{Path: `Children["gone"]`, Kind: Removed},
+		{Path: `Children["one"].Count`, Kind: Modified, Old: 0, New: 5},
+		{Path: `Children["two"]`, Kind: Added},
+		{Path: "Name", Kind: Modified, Old: "top", New: "other"},
+		{Path: "Tags[0]", Kind: Removed, Old: "a"},
+		{Path: "Tags[1]", Kind: Added, New: "c"},
+	}
+	if len(res) != len(expected) {
+		t.Fatalf("Expected %v changes, got: %v", len(expected), res)
+	}
+	for n, c := range expected {
+		for _, i := range [][]interface{}{
+			{res[n].Path, c.Path},
+			{res[n].Kind, c.Kind},
+		} {
+			if i[0] != i[1] {
+				t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+			}
+		}
+		if c.Kind != Added && c.Old != nil && res[n].Old != c.Old {
+			t.Fatalf("Expected: %v, got: %v", c.Old, res[n].Old)
+		}
+		if c.Kind != Removed && c.New != nil && res[n].New != c.New {
+			t.Fatalf("Expected: %v, got: %v", c.New, res[n].New)
+		}
+	}
+	if res[0].New != nil || res[0].Old.(*nested).Name != "gone" {
+		t.Fatalf("Expected the removed child, got: %v", res[0])
+	}
+	if res[2].Old != nil || res[2].New.(*nested).Name != "two" {
+		t.Fatalf("Expected the added child, got: %v", res[2])
+	}
+}
+
+func TestChangesNilPointers(t *testing.T) {
+	n1 := ndata()
+	n2 := ndata()
+	n2.Children["one"] = nil
+	res := Changes(n1, n2)
+	if len(res) != 1 || res[0].Kind != Removed || res[0].Path != `Children["one"]` {
+		t.Fatalf("Expected one removal, got: %v", res)
+	}
+}
+
+func TestChangesKeyedSlice(t *testing.T) {
+	k1 := &kinds{Keyed: []*keyed{{"a", "1.0", 1}, {"b", "1.0", 1}}}
+	k2 := &kinds{Keyed: []*keyed{{"a", "1.1", 1}, {"c", "1.0", 1}}}
+	paths := []string{}
+	for _, c := range Changes(k1, k2) {
+		paths = append(paths, c.Kind.String()+" "+c.Path)
+	}
+	for _, i := range [][]interface{}{
+		{len(paths), 3},
+		{paths[0], `modified Keyed["a"].Version`},
+		{paths[1], `removed Keyed["b"]`},
+		{paths[2], `added Keyed["c"]`},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+}
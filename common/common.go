@@ -23,34 +23,91 @@ package common
 
 import (
 	"reflect"
+	"time"
 )
 
-// Supermarketer implements an interface shared by all the Goulash structs.
-type Supermarketer interface {
+// timeType is compared, diffed, and copied as a single value rather than
+// field by field, since all of a time.Time's fields are unexported.
+var timeType = reflect.TypeOf(time.Time{})
+
+// Emptier implements the minimal interface shared by all the Goulash structs,
+// which the reflection-based functions in this package accept.
+type Emptier interface {
 	Empty() bool
-	// Lack of "covariant return types" for interfaces makes these args
-	// and return types too non-sensical.
-	// Equals(Supermarketer) bool
-	// Diff(Supermarketer) (Supermarketer, Supermarketer)
+}
+
+// Supermarketer implements the full interface shared by all the Goulash
+// structs, where T is the pointer type of the struct itself.
+type Supermarketer[T any] interface {
+	Emptier
+	Equals(T, ...Option) bool
+	Diff(T, ...Option) (T, T)
+	Clone() T
+}
+
+// TypedDiff calls Diff on two structs of the same type and returns the
+// positive and negative diffs as that type, or nil if they're empty.
+func TypedDiff[T Emptier](s1 T, s2 T, opts ...Option) (pos T, neg T) {
+	ipos, ineg := Diff(s1, s2, zeroOf[T](), zeroOf[T](), opts...)
+	if ipos != nil {
+		pos = ipos.(T)
+	}
+	if ineg != nil {
+		neg = ineg.(T)
+	}
+	return
+}
+
+// TypedApply calls Apply and returns the result as the type of the base.
+func TypedApply[T Emptier](base T, pos T, neg T) (res T) {
+	res = Apply(base, pos, neg).(T)
+	return
+}
+
+// TypedMerge calls Merge and returns the result as the type of the base.
+func TypedMerge[T Emptier](base T, ours T, theirs T) (res T, conflicts []Conflict) {
+	ires, conflicts := Merge(base, ours, theirs)
+	res = ires.(T)
+	return
+}
+
+// Clone returns a deep copy of a struct, with any unexported fields left at
+// their zero values, or nil if the struct is a nil pointer.
+func Clone[T Emptier](s T) (res T) {
+	v := reflect.ValueOf(s)
+	if nilValue(v) {
+		return
+	}
+	res = cloneValue(v, v.Type()).Interface().(T)
+	return
+}
+
+// zeroOf returns a pointer to a new zero value of the struct type a pointer
+// type T points to.
+func zeroOf[T Emptier]() T {
+	return reflect.New(reflect.TypeOf((*T)(nil)).Elem().Elem()).Interface().(T)
 }
 
 // Empty can be passed any reflect.Value and determines whether it's been
 // populated with anything or still holds all the base defaults.
-func Empty(s Supermarketer) (empty bool) {
+func Empty(s Emptier) (empty bool) {
 	empty = emptyValue(reflect.ValueOf(s))
 	return
 }
 
-// Equals does a deep comparison on two reflect.Values.
-func Equals(s1 Supermarketer, s2 Supermarketer) (equal bool) {
-	equal = reflect.DeepEqual(s1, s2)
+// Equals does a deep comparison on two reflect.Values, subject to any
+// Options.
+func Equals(s1 Emptier, s2 Emptier, opts ...Option) (equal bool) {
+	equal = equalValue(reflect.ValueOf(s1), reflect.ValueOf(s2), newOptions(opts), "")
 	return
 }
 
 // Diff returns any attributes that have been changed from one reflect.Value
-// to another.
-func Diff(s1 Supermarketer, s2 Supermarketer, pos Supermarketer, neg Supermarketer) (Supermarketer, Supermarketer) {
-	if Equals(s1, s2) {
+// to another, subject to any Options. Nothing in the diffs is shared with
+// either input.
+func Diff(s1 Emptier, s2 Emptier, pos Emptier, neg Emptier, opts ...Option) (Emptier, Emptier) {
+	o := newOptions(opts)
+	if equalValue(reflect.ValueOf(s1), reflect.ValueOf(s2), o, "") {
 		pos = nil
 		neg = nil
 		return pos, neg
@@ -60,12 +117,14 @@ func Diff(s1 Supermarketer, s2 Supermarketer, pos Supermarketer, neg Supermarket
 	v2 := reflect.ValueOf(s2)
 	vpos := reflect.ValueOf(&pos).Elem()
 	vneg := reflect.ValueOf(&neg).Elem()
-	p, n := diffValue(v1, v2)
+	p, n := diffValue(v1, v2, o, "")
+	// diffValue reuses whole values from its inputs where it can, so copy
+	// them to keep the diffs from sharing anything with either struct
 	if p.IsValid() {
-		vpos.Set(p)
+		vpos.Set(cloneValue(p, p.Type()))
 	}
 	if n.IsValid() {
-		vneg.Set(n)
+		vneg.Set(cloneValue(n, n.Type()))
 	}
 
 	if Empty(pos) {
@@ -78,8 +137,8 @@ func Diff(s1 Supermarketer, s2 Supermarketer, pos Supermarketer, neg Supermarket
 }
 
 // diffValue implements a diff check on two reflect.Values so the check can be
-// iterable.
-func diffValue(v1 reflect.Value, v2 reflect.Value) (vpos reflect.Value, vneg reflect.Value) {
+// iterable. The path is that of any struct fields leading to the values.
+func diffValue(v1 reflect.Value, v2 reflect.Value, o *options, path string) (vpos reflect.Value, vneg reflect.Value) {
 	if !v1.IsValid() && !v2.IsValid() {
 		return
 	}
@@ -111,27 +170,27 @@ func diffValue(v1 reflect.Value, v2 reflect.Value) (vpos reflect.Value, vneg ref
 	vpos = reflect.New(v1.Type()).Elem()
 	vneg = reflect.New(v1.Type()).Elem()
 
-	switch v1.Kind() {
-	case reflect.Bool:
-		if v1.Bool() != v2.Bool() {
+	fn, custom := o.comparator(v1)
+	switch {
+	case custom:
+		if !fn(v1.Interface(), v2.Interface()) {
 			vpos.Set(v2)
 			vneg.Set(v1)
 		}
-	case reflect.Int:
-		if v1.Int() != v2.Int() {
-			vpos.Set(v2)
-			vneg.Set(v1)
-		}
-	case reflect.String:
-		if v1.String() != v2.String() {
+	case v1.Type() == timeType:
+		if !equalValue(v1, v2, o, path) {
 			vpos.Set(v2)
 			vneg.Set(v1)
 		}
-	case reflect.Struct:
+	case v1.Kind() == reflect.Struct:
 		for i := 0; i < v1.NumField(); i++ {
+			fpath, skip := o.skipField(path, v1.Type().Field(i))
+			if skip {
+				continue
+			}
 			f1 := v1.Field(i)
 			f2 := v2.Field(i)
-			p, n := diffValue(f1, f2)
+			p, n := diffValue(f1, f2, o, fpath)
 			if p.IsValid() {
 				vpos.Field(i).Set(p)
 			}
@@ -139,56 +198,45 @@ func diffValue(v1 reflect.Value, v2 reflect.Value) (vpos reflect.Value, vneg ref
 				vneg.Field(i).Set(n)
 			}
 		}
-	case reflect.Ptr:
-		p, n := diffValue(v1.Elem(), v2.Elem())
+	case v1.Kind() == reflect.Array:
+		for i := 0; i < v1.Len(); i++ {
+			p, n := diffValue(v1.Index(i), v2.Index(i), o, path)
+			if p.IsValid() {
+				vpos.Index(i).Set(p)
+			}
+			if n.IsValid() {
+				vneg.Index(i).Set(n)
+			}
+		}
+	case v1.Kind() == reflect.Ptr:
+		p, n := diffValue(v1.Elem(), v2.Elem(), o, path)
+		// Diffs of slices and maps aren't addressable, so each side gets a
+		// new pointer
 		if p.IsValid() {
-			vpos.Set(p.Addr())
+			ptr := reflect.New(p.Type())
+			ptr.Elem().Set(p)
+			vpos.Set(ptr)
 		}
 		if n.IsValid() {
-			vneg.Set(n.Addr())
+			ptr := reflect.New(n.Type())
+			ptr.Elem().Set(n)
+			vneg.Set(ptr)
 		}
-	case reflect.Interface:
-		p, n := diffValue(v1.Elem(), v2.Elem())
+	case v1.Kind() == reflect.Interface:
+		p, n := diffValue(v1.Elem(), v2.Elem(), o, path)
 		if p.IsValid() {
 			vpos.Set(p)
 		}
 		if n.IsValid() {
 			vneg.Set(n)
 		}
-	case reflect.Slice:
-		vpos = reflect.MakeSlice(v1.Type(), 0, 0)
-		vneg = reflect.MakeSlice(v1.Type(), 0, 0)
-		for i := 0; i < v1.Len(); i++ {
-			found := false
-			for j := 0; j < v2.Len(); j++ {
-				// TODO: What if slice is not of strings?
-				if v2.Index(j).String() == v1.Index(i).String() {
-					found = true
-					break
-				}
-			}
-			if found == false {
-				vneg = reflect.Append(vneg, v1.Index(i))
-			}
-		}
-		for i := 0; i < v2.Len(); i++ {
-			found := false
-			for j := 0; j < v1.Len(); j++ {
-				// TODO: What if slice is not of strings?
-				if v1.Index(j).String() == v2.Index(i).String() {
-					found = true
-					break
-				}
-			}
-			if found == false {
-				vpos = reflect.Append(vpos, v2.Index(i))
-			}
-		}
-	case reflect.Map:
+	case v1.Kind() == reflect.Slice:
+		vpos, vneg = diffSlice(v1, v2, o, path)
+	case v1.Kind() == reflect.Map:
 		vpos = reflect.MakeMap(v1.Type())
 		vneg = reflect.MakeMap(v1.Type())
 		for _, k := range v1.MapKeys() {
-			p, n := diffValue(v1.MapIndex(k), v2.MapIndex(k))
+			p, n := diffValue(v1.MapIndex(k), v2.MapIndex(k), o, path)
 			if p.IsValid() {
 				if p.Kind() != reflect.String || p.String() != "" {
 					vpos.SetMapIndex(k, p)
@@ -205,6 +253,13 @@ func diffValue(v1 reflect.Value, v2 reflect.Value) (vpos reflect.Value, vneg ref
 				vpos.SetMapIndex(k, v2.MapIndex(k))
 			}
 		}
+	default:
+		// Bools, numbers, and strings, plus funcs and chans, which are only
+		// equal if they're the same one
+		if !equalValue(v1, v2, o, path) {
+			vpos.Set(v2)
+			vneg.Set(v1)
+		}
 	}
 	if emptyValue(vpos) {
 		vpos = reflect.ValueOf(nil)
@@ -215,27 +270,132 @@ func diffValue(v1 reflect.Value, v2 reflect.Value) (vpos reflect.Value, vneg ref
 	return
 }
 
+// diffSlice implements the slice portion of a diff. Slices are compared as
+// sets, so each element of one that's missing from the other goes in the
+// positive or negative diff. If the slice holds structs with a field tagged
+// `goulash:"key"`, elements are instead matched up by that field and any
+// matched pair that differs is diffed in turn, with the key kept in both
+// halves so the partial elements can still be identified.
+func diffSlice(v1 reflect.Value, v2 reflect.Value, o *options, path string) (vpos reflect.Value, vneg reflect.Value) {
+	vpos = reflect.MakeSlice(v1.Type(), 0, 0)
+	vneg = reflect.MakeSlice(v1.Type(), 0, 0)
+	key, keyed := sliceKey(v1.Type())
+	if !keyed {
+		for i := 0; i < v1.Len(); i++ {
+			if !containsValue(v2, v1.Index(i), o, path) {
+				vneg = reflect.Append(vneg, v1.Index(i))
+			}
+		}
+		for i := 0; i < v2.Len(); i++ {
+			if !containsValue(v1, v2.Index(i), o, path) {
+				vpos = reflect.Append(vpos, v2.Index(i))
+			}
+		}
+		return
+	}
+
+	for i := 0; i < v1.Len(); i++ {
+		e1 := v1.Index(i)
+		e2 := findKey(v2, key, keyValue(e1, key))
+		if !e2.IsValid() {
+			vneg = reflect.Append(vneg, e1)
+			continue
+		}
+		p, n := diffValue(e1, e2, o, path)
+		if p.IsValid() {
+			vpos = reflect.Append(vpos, withKey(p, key, keyValue(e2, key)))
+		}
+		if n.IsValid() {
+			vneg = reflect.Append(vneg, withKey(n, key, keyValue(e1, key)))
+		}
+	}
+	for i := 0; i < v2.Len(); i++ {
+		if !findKey(v1, key, keyValue(v2.Index(i), key)).IsValid() {
+			vpos = reflect.Append(vpos, v2.Index(i))
+		}
+	}
+	return
+}
+
+// sliceKey returns the index of the field tagged `goulash:"key"` in the
+// struct, or pointer to struct, element type of a slice.
+func sliceKey(t reflect.Type) (key int, ok bool) {
+	e := t.Elem()
+	if e.Kind() == reflect.Ptr {
+		e = e.Elem()
+	}
+	if e.Kind() != reflect.Struct {
+		return
+	}
+	for i := 0; i < e.NumField(); i++ {
+		if e.Field(i).IsExported() && e.Field(i).Tag.Get("goulash") == "key" {
+			return i, true
+		}
+	}
+	return
+}
+
+// keyValue returns the key field of a slice element, or an invalid value if
+// the element is a nil pointer.
+func keyValue(v reflect.Value, key int) reflect.Value {
+	v = reflect.Indirect(v)
+	if !v.IsValid() {
+		return v
+	}
+	return v.Field(key)
+}
+
+// findKey returns the element of a slice with a given key, or an invalid
+// value if there isn't one.
+func findKey(slice reflect.Value, key int, k reflect.Value) reflect.Value {
+	if !k.IsValid() || nilValue(slice) {
+		return reflect.Value{}
+	}
+	for i := 0; i < slice.Len(); i++ {
+		if equalValue(keyValue(slice.Index(i), key), k, nil, "") {
+			return slice.Index(i)
+		}
+	}
+	return reflect.Value{}
+}
+
+// withKey sets the key field of a partial slice element returned by
+// diffValue.
+func withKey(v reflect.Value, key int, k reflect.Value) reflect.Value {
+	if k.IsValid() {
+		reflect.Indirect(v).Field(key).Set(k)
+	}
+	return v
+}
+
 // emptyValue splits out the iterable portion of an emptiness check.
 func emptyValue(v reflect.Value) (empty bool) {
 	empty = true
 	if !v.IsValid() {
 		return
 	}
+	if v.Type() == timeType {
+		return v.Interface().(time.Time).IsZero()
+	}
 	switch v.Kind() {
 	case reflect.Bool:
-		if v.Bool() != false {
-			empty = false
-		}
-	case reflect.Int:
-		if v.Int() != 0 {
-			empty = false
-		}
+		empty = !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		empty = v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64, reflect.Uintptr:
+		empty = v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		empty = v.Float() == 0
+	case reflect.Complex64, reflect.Complex128:
+		empty = v.Complex() == 0
 	case reflect.String:
-		if v.String() != "" {
-			empty = false
-		}
+		empty = v.String() == ""
 	case reflect.Struct:
 		for i := 0; i < v.NumField(); i++ {
+			if !v.Type().Field(i).IsExported() {
+				continue
+			}
 			f := v.Field(i)
 			if !emptyValue(f) {
 				empty = false
@@ -253,13 +413,98 @@ func emptyValue(v reflect.Value) (empty bool) {
 				break
 			}
 		}
-	case reflect.Slice:
+	case reflect.Slice, reflect.Array:
 		for i := 0; i < v.Len(); i++ {
 			if !emptyValue(v.Index(i)) {
 				empty = false
 				break
 			}
 		}
+	case reflect.Func, reflect.Chan, reflect.UnsafePointer:
+		empty = v.IsNil()
+	}
+	return
+}
+
+// equalValue implements a deep comparison on two reflect.Values, in the same
+// spirit as reflect.DeepEqual but skipping any unexported struct fields, so
+// structs can carry internal state (locks, caches) without it being read or
+// counted as data. Any options are honored below the given path.
+func equalValue(v1 reflect.Value, v2 reflect.Value, o *options, path string) (equal bool) {
+	if !v1.IsValid() || !v2.IsValid() {
+		return v1.IsValid() == v2.IsValid()
+	}
+	if v1.Type() != v2.Type() {
+		return
+	}
+	if fn, ok := o.comparator(v1); ok {
+		return fn(v1.Interface(), v2.Interface())
+	}
+	if v1.Type() == timeType {
+		return v1.Interface().(time.Time).Equal(v2.Interface().(time.Time))
+	}
+	switch v1.Kind() {
+	case reflect.Bool:
+		equal = v1.Bool() == v2.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		equal = v1.Int() == v2.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64, reflect.Uintptr:
+		equal = v1.Uint() == v2.Uint()
+	case reflect.Float32, reflect.Float64:
+		equal = v1.Float() == v2.Float()
+	case reflect.Complex64, reflect.Complex128:
+		equal = v1.Complex() == v2.Complex()
+	case reflect.String:
+		equal = v1.String() == v2.String()
+	case reflect.Struct:
+		for i := 0; i < v1.NumField(); i++ {
+			fpath, skip := o.skipField(path, v1.Type().Field(i))
+			if skip {
+				continue
+			}
+			if !equalValue(v1.Field(i), v2.Field(i), o, fpath) {
+				return
+			}
+		}
+		equal = true
+	case reflect.Ptr, reflect.Interface:
+		if v1.IsNil() || v2.IsNil() {
+			return v1.IsNil() == v2.IsNil()
+		}
+		equal = equalValue(v1.Elem(), v2.Elem(), o, path)
+	case reflect.Array:
+		for i := 0; i < v1.Len(); i++ {
+			if !equalValue(v1.Index(i), v2.Index(i), o, path) {
+				return
+			}
+		}
+		equal = true
+	case reflect.Slice:
+		if v1.IsNil() != v2.IsNil() || v1.Len() != v2.Len() {
+			return
+		}
+		for i := 0; i < v1.Len(); i++ {
+			if !equalValue(v1.Index(i), v2.Index(i), o, path) {
+				return
+			}
+		}
+		equal = true
+	case reflect.Map:
+		if v1.IsNil() != v2.IsNil() || v1.Len() != v2.Len() {
+			return
+		}
+		for _, k := range v1.MapKeys() {
+			e2 := v2.MapIndex(k)
+			if !e2.IsValid() || !equalValue(v1.MapIndex(k), e2, o, path) {
+				return
+			}
+		}
+		equal = true
+	default:
+		// Funcs, chans, and unsafe pointers are only equal if they're the
+		// same one
+		equal = v1.Pointer() == v2.Pointer()
 	}
 	return
 }
@@ -3,6 +3,7 @@ package common
 import (
 	"reflect"
 	"testing"
+	"time"
 )
 
 type thing struct {
@@ -42,7 +43,7 @@ func TestDiffEqual(t *testing.T) {
 	c2 := thing{Endpoint: "abc", ETag: "def"}
 	pos1, neg1 := Diff(&c1, &c2, &thing{}, &thing{})
 	pos2, neg2 := Diff(&c2, &c1, &thing{}, &thing{})
-	for _, i := range []Supermarketer{pos1, neg1, pos2, neg2} {
+	for _, i := range []Emptier{pos1, neg1, pos2, neg2} {
 		if i != nil {
 			t.Fatalf("Expected nil, got: %v", i)
 		}
@@ -54,12 +55,12 @@ func TestDiffAddedAndDeletedData(t *testing.T) {
 	c2 := thing{Endpoint: "abc", ETag: "def"}
 	pos1, neg1 := Diff(&c1, &c2, &thing{}, &thing{})
 	pos2, neg2 := Diff(&c2, &c1, &thing{}, &thing{})
-	for _, i := range []Supermarketer{neg1, pos2} {
+	for _, i := range []Emptier{neg1, pos2} {
 		if i != nil {
 			t.Fatalf("Expected nil, got: %v", i)
 		}
 	}
-	for _, k := range [][]Supermarketer{
+	for _, k := range [][]Emptier{
 		{pos1, &thing{Endpoint: "abc", ETag: "def"}},
 		{neg2, &thing{Endpoint: "abc", ETag: "def"}},
 	} {
@@ -74,7 +75,7 @@ func TestDiffChangedData(t *testing.T) {
 	c2 := thing{Endpoint: "uvw", ETag: "xyz"}
 	pos1, neg1 := Diff(&c1, &c2, &thing{}, &thing{})
 	pos2, neg2 := Diff(&c2, &c1, &thing{}, &thing{})
-	for _, k := range [][]Supermarketer{
+	for _, k := range [][]Emptier{
 		{pos1, &thing{Endpoint: "uvw", ETag: "xyz"}},
 		{neg1, &thing{Endpoint: "abc", ETag: "def"}},
 		{pos2, &thing{Endpoint: "abc", ETag: "def"}},
@@ -130,3 +131,219 @@ func TestemptyValueNonEmptyMap(t *testing.T) {
 		t.Fatalf("Expected false, got: %v", res)
 	}
 }
+
+type lockedThing struct {
+	Endpoint string
+	internal *int
+}
+
+func (l *lockedThing) Empty() (empty bool) {
+	empty = Empty(l)
+	return
+}
+
+func TestUnexportedFieldsIgnored(t *testing.T) {
+	n1 := 1
+	n2 := 2
+	c1 := lockedThing{Endpoint: "abc", internal: &n1}
+	c2 := lockedThing{Endpoint: "abc", internal: &n2}
+	pos, neg := Diff(&c1, &c2, &lockedThing{}, &lockedThing{})
+	for _, i := range [][]interface{}{
+		{Equals(&c1, &c2), true},
+		{Empty(&lockedThing{internal: &n1}), true},
+		{pos, nil},
+		{neg, nil},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+}
+
+func TestEqualsNilAndEmptyMap(t *testing.T) {
+	res := equalValue(reflect.ValueOf(map[string]string(nil)), reflect.ValueOf(map[string]string{}), nil, "")
+	if res != false {
+		t.Fatalf("Expected false, got: %v", res)
+	}
+}
+
+func TestEqualsNestedValues(t *testing.T) {
+	v1 := map[string][]*thing{"a": {&thing{Endpoint: "abc"}}}
+	v2 := map[string][]*thing{"a": {&thing{Endpoint: "abc"}}}
+	v3 := map[string][]*thing{"a": {&thing{Endpoint: "xyz"}}}
+	for _, i := range [][]interface{}{
+		{equalValue(reflect.ValueOf(v1), reflect.ValueOf(v2), nil, ""), true},
+		{equalValue(reflect.ValueOf(v1), reflect.ValueOf(v3), nil, ""), false},
+		{equalValue(reflect.ValueOf(1.5), reflect.ValueOf(1.5), nil, ""), true},
+		{equalValue(reflect.ValueOf(uint(1)), reflect.ValueOf(uint(2)), nil, ""), false},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+}
+
+type keyed struct {
+	Name    string `goulash:"key"`
+	Version string
+	Count   uint
+}
+
+type kinds struct {
+	Bool    bool
+	Int8    int8
+	Uint32  uint32
+	Float32 float32
+	Float64 float64
+	Complex complex128
+	Time    time.Time
+	Array   [3]int
+	Ints    []int
+	Floats  []float64
+	Structs []thing
+	Keyed   []*keyed
+	Map     map[string]float64
+	IntsPtr *[]int
+	MapPtr  *map[string]int
+}
+
+func (k *kinds) Empty() (empty bool) {
+	empty = Empty(k)
+	return
+}
+
+func TestDiffKinds(t *testing.T) {
+	t1 := time.Date(2014, 9, 20, 4, 46, 0, 0, time.UTC)
+	t2 := t1.Add(time.Hour)
+	for _, i := range [][]interface{}{
+		{"bool", &kinds{}, &kinds{Bool: true}, &kinds{Bool: true}, nil},
+		{"int8", &kinds{Int8: 1}, &kinds{Int8: -2}, &kinds{Int8: -2}, &kinds{Int8: 1}},
+		{"uint32", &kinds{Uint32: 1}, &kinds{Uint32: 2}, &kinds{Uint32: 2}, &kinds{Uint32: 1}},
+		{"float32", &kinds{Float32: 0.5}, &kinds{Float32: 0.25}, &kinds{Float32: 0.25}, &kinds{Float32: 0.5}},
+		{"float64", &kinds{Float64: 1.5}, &kinds{}, nil, &kinds{Float64: 1.5}},
+		{"complex", &kinds{Complex: 1i}, &kinds{Complex: 2}, &kinds{Complex: 2}, &kinds{Complex: 1i}},
+		{"time", &kinds{Time: t1}, &kinds{Time: t2}, &kinds{Time: t2}, &kinds{Time: t1}},
+		{"time zone", &kinds{Time: t1}, &kinds{Time: t1.In(time.FixedZone("x", 3600))}, nil, nil},
+		{"array", &kinds{Array: [3]int{1, 2, 3}}, &kinds{Array: [3]int{1, 5, 3}},
+			&kinds{Array: [3]int{0, 5, 0}}, &kinds{Array: [3]int{0, 2, 0}}},
+		{"ints", &kinds{Ints: []int{1, 2}}, &kinds{Ints: []int{2, 3}},
+			&kinds{Ints: []int{3}}, &kinds{Ints: []int{1}}},
+		{"floats", &kinds{Floats: []float64{0.5}}, &kinds{Floats: []float64{0.5, 1.5}},
+			&kinds{Floats: []float64{1.5}}, nil},
+		{"structs", &kinds{Structs: []thing{{Endpoint: "a"}}}, &kinds{Structs: []thing{{Endpoint: "a"}, {Endpoint: "b"}}},
+			&kinds{Structs: []thing{{Endpoint: "b"}}}, nil},
+		{"keyed",
+			&kinds{Keyed: []*keyed{{"a", "1.0", 1}, {"b", "1.0", 1}}},
+			&kinds{Keyed: []*keyed{{"a", "1.1", 1}, {"c", "1.0", 1}}},
+			&kinds{Keyed: []*keyed{{"a", "1.1", 0}, {"c", "1.0", 1}}},
+			&kinds{Keyed: []*keyed{{"a", "1.0", 0}, {"b", "1.0", 1}}}},
+		{"map", &kinds{Map: map[string]float64{"a": 1.5}}, &kinds{Map: map[string]float64{"a": 2.5, "b": 1}},
+			&kinds{Map: map[string]float64{"a": 2.5, "b": 1}}, &kinds{Map: map[string]float64{"a": 1.5}}},
+		{"pointer to slice", &kinds{IntsPtr: &[]int{1, 2}}, &kinds{IntsPtr: &[]int{2, 3}},
+			&kinds{IntsPtr: &[]int{3}}, &kinds{IntsPtr: &[]int{1}}},
+		{"pointer to map", &kinds{MapPtr: &map[string]int{"a": 1}}, &kinds{MapPtr: &map[string]int{"a": 2, "b": 1}},
+			&kinds{MapPtr: &map[string]int{"a": 2, "b": 1}}, &kinds{MapPtr: &map[string]int{"a": 1}}},
+	} {
+		k1 := i[1].(*kinds)
+		k2 := i[2].(*kinds)
+		epos, _ := i[3].(Emptier)
+		eneg, _ := i[4].(Emptier)
+		pos, neg := Diff(k1, k2, &kinds{}, &kinds{})
+		if !Equals(pos, epos) {
+			t.Fatalf("%v: Expected: %v, got: %v", i[0], epos, pos)
+		}
+		if !Equals(neg, eneg) {
+			t.Fatalf("%v: Expected: %v, got: %v", i[0], eneg, neg)
+		}
+		if res := Apply(k1, pos, neg); !Equals(res, k2) {
+			t.Fatalf("%v: Expected: %v, got: %v", i[0], k2, res)
+		}
+		if res := Equals(k1, k2); res != (epos == nil && eneg == nil) {
+			t.Fatalf("%v: Expected: %v, got: %v", i[0], !res, res)
+		}
+	}
+}
+
+func TestEmptyKinds(t *testing.T) {
+	for _, i := range [][]interface{}{
+		{int16(0), true},
+		{int64(-1), false},
+		{uint8(0), true},
+		{uintptr(1), false},
+		{float32(0), true},
+		{0.1, false},
+		{complex64(0), true},
+		{time.Time{}, true},
+		{time.Unix(0, 0), false},
+		{[2]string{}, true},
+		{[2]string{"", "a"}, false},
+		{[]thing{{}}, true},
+		{[]thing{{ETag: "a"}}, false},
+		{(func())(nil), true},
+		{func() {}, false},
+		{make(chan int), false},
+	} {
+		res := emptyValue(reflect.ValueOf(i[0]))
+		if res != i[1] {
+			t.Fatalf("%T: Expected: %v, got: %v", i[0], i[1], res)
+		}
+	}
+}
+
+func TestTypedDiff(t *testing.T) {
+	c1 := &thing{Endpoint: "abc", ETag: "def"}
+	c2 := &thing{Endpoint: "abc", ETag: "xyz"}
+	pos, neg := TypedDiff(c1, c2)
+	epos, eneg := TypedDiff(c1, c1)
+	for _, i := range [][]interface{}{
+		{*pos, thing{ETag: "xyz"}},
+		{*neg, thing{ETag: "def"}},
+		{epos, (*thing)(nil)},
+		{eneg, (*thing)(nil)},
+		{*TypedApply(c1, pos, neg), *c2},
+		{*zeroOf[*thing](), thing{}},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+}
+
+func TestClone(t *testing.T) {
+	n := ndata()
+	res := Clone(n)
+	for _, i := range [][]interface{}{
+		{Equals(res, n), true},
+		{res == n, false},
+		{res.Children["one"] == n.Children["one"], false},
+		{&res.Tags[0] == &n.Tags[0], false},
+		{Clone((*nested)(nil)), (*nested)(nil)},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+}
+
+func TestDiffDoesNotAlias(t *testing.T) {
+	n1 := ndata()
+	n2 := ndata()
+	n2.Tags = []string{"c"}
+	n2.Children["two"] = &nested{Name: "two", Tags: []string{"x"}, Children: map[string]*nested{}}
+	pos, neg := Diff(n1, n2, &nested{}, &nested{})
+	p := pos.(*nested)
+	p.Children["two"].Name = "changed"
+	p.Children["two"].Tags[0] = "changed"
+	p.Tags[0] = "changed"
+	neg.(*nested).Tags[0] = "changed"
+	for _, i := range [][]interface{}{
+		{n2.Children["two"].Name, "two"},
+		{n2.Children["two"].Tags[0], "x"},
+		{n2.Tags[0], "c"},
+		{n1.Tags[0], "a"},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+}
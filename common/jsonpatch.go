@@ -0,0 +1,419 @@
+// Author:: Jonathan Hartman (<j@p4nt5.com>)
+//
+// Copyright (C) 2014, Jonathan Hartman
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package common implements a shared set of Goulash functionality.
+
+This file defines RFC 6902 JSON Patch support. Patches are computed between
+the JSON encodings of two Emptiers, so they follow the same field names
+and tags as the API data, e.g.
+
+	[
+		{"op": "replace", "path": "/metrics/followers", "value": 8},
+		{"op": "add", "path": "/versions/2", "value": "2.0.1"}
+	]
+*/
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Operation implements a single JSON Patch operation.
+type Operation struct {
+	Op    string
+	Path  string
+	From  string
+	Value interface{}
+}
+
+// MarshalJSON encodes an Operation with only the members its op uses.
+func (o Operation) MarshalJSON() ([]byte, error) {
+	m := map[string]interface{}{"op": o.Op, "path": o.Path}
+	switch o.Op {
+	case "add", "replace", "test":
+		m["value"] = o.Value
+	case "move", "copy":
+		m["from"] = o.From
+	}
+	return json.Marshal(m)
+}
+
+// UnmarshalJSON decodes an Operation, keeping numbers in the value as
+// json.Numbers so they survive a round trip unchanged.
+func (o *Operation) UnmarshalJSON(data []byte) (err error) {
+	tmp := struct {
+		Op    string          `json:"op"`
+		Path  string          `json:"path"`
+		From  string          `json:"from"`
+		Value json.RawMessage `json:"value"`
+	}{}
+	err = json.Unmarshal(data, &tmp)
+	if err != nil {
+		return
+	}
+	*o = Operation{Op: tmp.Op, Path: tmp.Path, From: tmp.From}
+	if len(tmp.Value) > 0 {
+		o.Value, err = decodeGeneric(tmp.Value)
+	}
+	return
+}
+
+// Patch implements an RFC 6902 JSON Patch document.
+type Patch []Operation
+
+// JSONPatch returns a Patch that turns the JSON encoding of one struct
+// into that of another.
+func JSONPatch(s1 Emptier, s2 Emptier) (p Patch, err error) {
+	d1, err := encodeGeneric(s1)
+	if err != nil {
+		return
+	}
+	d2, err := encodeGeneric(s2)
+	if err != nil {
+		return
+	}
+	p = Patch{}
+	patchValue("", d1, d2, &p)
+	return
+}
+
+// ApplyJSONPatch applies a Patch to the JSON encoding of a struct and
+// decodes the result into the res struct, leaving s unmodified.
+func ApplyJSONPatch(s Emptier, p Patch, res Emptier) (Emptier, error) {
+	doc, err := encodeGeneric(s)
+	if err != nil {
+		return nil, err
+	}
+	doc, err = p.ApplyDocument(doc)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, res)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// ApplyDocument applies a Patch to a generic JSON document, as decoded into
+// an interface{}, and returns the patched document. The document passed in
+// may be modified.
+func (p Patch) ApplyDocument(doc interface{}) (res interface{}, err error) {
+	res = doc
+	for _, o := range p {
+		res, err = applyOperation(res, o)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// applyOperation applies a single Operation to a generic JSON document.
+func applyOperation(doc interface{}, o Operation) (res interface{}, err error) {
+	path, err := parsePointer(o.Path)
+	if err != nil {
+		return
+	}
+	switch o.Op {
+	case "add":
+		res, err = setPointer(doc, path, o.Value, true)
+	case "remove":
+		res, _, err = removePointer(doc, path)
+	case "replace":
+		_, err = getPointer(doc, path)
+		if err == nil {
+			res, err = setPointer(doc, path, o.Value, false)
+		}
+	case "move", "copy":
+		var from []string
+		var v interface{}
+		from, err = parsePointer(o.From)
+		if err != nil {
+			return
+		}
+		if o.Op == "move" {
+			doc, v, err = removePointer(doc, from)
+		} else {
+			v, err = getPointer(doc, from)
+			if err == nil {
+				v, err = decodeGeneric(mustMarshal(v))
+			}
+		}
+		if err == nil {
+			res, err = setPointer(doc, path, v, true)
+		}
+	case "test":
+		var v interface{}
+		v, err = getPointer(doc, path)
+		if err == nil && !reflect.DeepEqual(normalizeGeneric(v), normalizeGeneric(o.Value)) {
+			err = errors.New("test failed at path: " + o.Path)
+		}
+		res = doc
+	default:
+		err = errors.New("unknown patch operation: " + o.Op)
+	}
+	return
+}
+
+// patchValue implements the iterable portion of building a Patch between two
+// generic JSON documents.
+func patchValue(path string, d1 interface{}, d2 interface{}, p *Patch) {
+	m1, ok1 := d1.(map[string]interface{})
+	m2, ok2 := d2.(map[string]interface{})
+	if ok1 && ok2 {
+		keys := []string{}
+		for k := range m1 {
+			keys = append(keys, k)
+		}
+		for k := range m2 {
+			if _, ok := m1[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			kpath := path + "/" + escapePointer(k)
+			v1, in1 := m1[k]
+			v2, in2 := m2[k]
+			switch {
+			case !in2:
+				*p = append(*p, Operation{Op: "remove", Path: kpath})
+			case !in1:
+				*p = append(*p, Operation{Op: "add", Path: kpath, Value: v2})
+			default:
+				patchValue(kpath, v1, v2, p)
+			}
+		}
+		return
+	}
+	a1, ok1 := d1.([]interface{})
+	a2, ok2 := d2.([]interface{})
+	if ok1 && ok2 {
+		shared := len(a1)
+		if len(a2) < shared {
+			shared = len(a2)
+		}
+		for i := 0; i < shared; i++ {
+			patchValue(path+"/"+strconv.Itoa(i), a1[i], a2[i], p)
+		}
+		for i := shared; i < len(a2); i++ {
+			*p = append(*p, Operation{Op: "add", Path: path + "/" + strconv.Itoa(i), Value: a2[i]})
+		}
+		// Remove from the end so earlier indexes stay valid
+		for i := len(a1) - 1; i >= shared; i-- {
+			*p = append(*p, Operation{Op: "remove", Path: path + "/" + strconv.Itoa(i)})
+		}
+		return
+	}
+	if !reflect.DeepEqual(d1, d2) {
+		*p = append(*p, Operation{Op: "replace", Path: path, Value: d2})
+	}
+}
+
+// getPointer returns the value at a parsed JSON Pointer.
+func getPointer(doc interface{}, path []string) (v interface{}, err error) {
+	v = doc
+	for _, tok := range path {
+		switch c := v.(type) {
+		case map[string]interface{}:
+			var ok bool
+			v, ok = c[tok]
+			if !ok {
+				err = errors.New("path not found: " + tok)
+				return
+			}
+		case []interface{}:
+			var i int
+			i, err = arrayIndex(tok, len(c)-1)
+			if err != nil {
+				return
+			}
+			v = c[i]
+		default:
+			err = errors.New("path not found: " + tok)
+			return
+		}
+	}
+	return
+}
+
+// setPointer sets the value at a parsed JSON Pointer and returns the updated
+// document. With insert set, array values are inserted rather than replaced.
+func setPointer(doc interface{}, path []string, v interface{}, insert bool) (res interface{}, err error) {
+	if len(path) == 0 {
+		res = v
+		return
+	}
+	tok := path[0]
+	switch c := doc.(type) {
+	case map[string]interface{}:
+		if len(path) == 1 {
+			c[tok] = v
+			res = c
+			return
+		}
+		child, ok := c[tok]
+		if !ok {
+			err = errors.New("path not found: " + tok)
+			return
+		}
+		c[tok], err = setPointer(child, path[1:], v, insert)
+		res = c
+	case []interface{}:
+		if len(path) == 1 && insert {
+			i := len(c)
+			if tok != "-" {
+				i, err = arrayIndex(tok, len(c))
+				if err != nil {
+					return
+				}
+			}
+			c = append(c, nil)
+			copy(c[i+1:], c[i:])
+			c[i] = v
+			res = c
+			return
+		}
+		var i int
+		i, err = arrayIndex(tok, len(c)-1)
+		if err != nil {
+			return
+		}
+		c[i], err = setPointer(c[i], path[1:], v, insert)
+		res = c
+	default:
+		err = errors.New("path not found: " + tok)
+	}
+	return
+}
+
+// removePointer removes the value at a parsed JSON Pointer and returns the
+// updated document and the removed value.
+func removePointer(doc interface{}, path []string) (res interface{}, removed interface{}, err error) {
+	if len(path) == 0 {
+		err = errors.New("can't remove the whole document")
+		return
+	}
+	tok := path[0]
+	switch c := doc.(type) {
+	case map[string]interface{}:
+		child, ok := c[tok]
+		if !ok {
+			err = errors.New("path not found: " + tok)
+			return
+		}
+		if len(path) == 1 {
+			removed = child
+			delete(c, tok)
+		} else {
+			c[tok], removed, err = removePointer(child, path[1:])
+		}
+		res = c
+	case []interface{}:
+		var i int
+		i, err = arrayIndex(tok, len(c)-1)
+		if err != nil {
+			return
+		}
+		if len(path) == 1 {
+			removed = c[i]
+			c = append(c[:i], c[i+1:]...)
+		} else {
+			c[i], removed, err = removePointer(c[i], path[1:])
+		}
+		res = c
+	default:
+		err = errors.New("path not found: " + tok)
+	}
+	return
+}
+
+// arrayIndex parses a JSON Pointer array index no greater than max.
+func arrayIndex(tok string, max int) (i int, err error) {
+	i, err = strconv.Atoi(tok)
+	if err != nil || i < 0 || i > max || (len(tok) > 1 && tok[0] == '0') {
+		err = errors.New("invalid array index: " + tok)
+	}
+	return
+}
+
+// parsePointer splits an RFC 6901 JSON Pointer into its unescaped tokens.
+func parsePointer(s string) (path []string, err error) {
+	if s == "" {
+		return
+	}
+	if s[0] != '/' {
+		err = errors.New("invalid JSON pointer: " + s)
+		return
+	}
+	for _, tok := range strings.Split(s[1:], "/") {
+		tok = strings.Replace(tok, "~1", "/", -1)
+		tok = strings.Replace(tok, "~0", "~", -1)
+		path = append(path, tok)
+	}
+	return
+}
+
+// escapePointer escapes a single JSON Pointer token.
+func escapePointer(tok string) string {
+	tok = strings.Replace(tok, "~", "~0", -1)
+	return strings.Replace(tok, "/", "~1", -1)
+}
+
+// encodeGeneric returns the JSON encoding of a value as a generic document.
+func encodeGeneric(v interface{}) (doc interface{}, err error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	doc, err = decodeGeneric(data)
+	return
+}
+
+// decodeGeneric decodes JSON data into a generic document, keeping numbers
+// as json.Numbers.
+func decodeGeneric(data []byte) (doc interface{}, err error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	err = decoder.Decode(&doc)
+	return
+}
+
+// normalizeGeneric round-trips a generic document through JSON so values
+// built in Go and values decoded from JSON compare the same.
+func normalizeGeneric(doc interface{}) (res interface{}) {
+	res, _ = decodeGeneric(mustMarshal(doc))
+	return
+}
+
+// mustMarshal returns the JSON encoding of a generic document, which can't
+// fail for anything decoded from JSON in the first place.
+func mustMarshal(doc interface{}) (data []byte) {
+	data, _ = json.Marshal(doc)
+	return
+}
@@ -0,0 +1,140 @@
+package common
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestJSONPatchEqual(t *testing.T) {
+	p, err := JSONPatch(ndata(), ndata())
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(p) != 0 {
+		t.Fatalf("Expected an empty patch, got: %v", p)
+	}
+}
+
+func TestJSONPatchOperations(t *testing.T) {
+	n1 := ndata()
+	n2 := ndata()
+	n2.Name = "other"
+	n2.Tags = []string{"a", "b", "c"}
+	n2.Children["a/b"] = &nested{Name: "slash"}
+	delete(n2.Children, "one")
+	p, err := JSONPatch(n1, n2)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	data, _ := json.Marshal(p)
+	expected := `[{"op":"add","path":"/Children/a~1b","value":{"Children":null,"Count":0,"Name":"slash","Tags":null}},` +
+		`{"op":"remove","path":"/Children/one"},` +
+		`{"op":"replace","path":"/Name","value":"other"},` +
+		`{"op":"add","path":"/Tags/2","value":"c"}]`
+	if string(data) != expected {
+		t.Fatalf("Expected: %v, got: %v", expected, string(data))
+	}
+}
+
+func TestJSONPatchRoundTrip(t *testing.T) {
+	n1 := ndata()
+	n2 := ndata()
+	n2.Count = 42
+	n2.Tags = []string{"z"}
+	n2.Children["one"].Children["deep"] = &nested{Name: "deep", Tags: []string{}}
+	n2.Children["two"] = &nested{Name: "two"}
+	for _, i := range [][]*nested{{n1, n2}, {n2, n1}} {
+		p, err := JSONPatch(i[0], i[1])
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		res, err := ApplyJSONPatch(i[0], p, &nested{})
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		if !Equals(res, i[1]) {
+			t.Fatalf("Expected %v, got: %v", i[1], res)
+		}
+	}
+}
+
+func TestJSONPatchSerializedRoundTrip(t *testing.T) {
+	n1 := ndata()
+	n2 := ndata()
+	n2.Count = 2150582
+	p, _ := JSONPatch(n1, n2)
+	data, _ := json.Marshal(p)
+	p2 := Patch{}
+	err := json.Unmarshal(data, &p2)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	res, err := ApplyJSONPatch(n1, p2, &nested{})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if !Equals(res, n2) {
+		t.Fatalf("Expected %v, got: %v", n2, res)
+	}
+}
+
+func TestApplyDocumentAllOperations(t *testing.T) {
+	doc, _ := decodeGeneric([]byte(`{"a": {"b": [1, 2, 3]}, "c": "x"}`))
+	p := Patch{}
+	err := json.Unmarshal([]byte(`[
+		{"op": "test", "path": "/c", "value": "x"},
+		{"op": "add", "path": "/a/b/1", "value": 9},
+		{"op": "add", "path": "/a/b/-", "value": 4},
+		{"op": "remove", "path": "/a/b/0"},
+		{"op": "replace", "path": "/c", "value": "y"},
+		{"op": "copy", "from": "/a/b", "path": "/d"},
+		{"op": "move", "from": "/c", "path": "/e"}
+	]`), &p)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	res, err := p.ApplyDocument(doc)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	data, _ := json.Marshal(res)
+	expected := `{"a":{"b":[9,2,3,4]},"d":[9,2,3,4],"e":"y"}`
+	if string(data) != expected {
+		t.Fatalf("Expected: %v, got: %v", expected, string(data))
+	}
+}
+
+func TestApplyDocumentErrors(t *testing.T) {
+	for _, o := range []Operation{
+		{Op: "test", Path: "/c", Value: "nope"},
+		{Op: "replace", Path: "/missing", Value: 1},
+		{Op: "remove", Path: "/a/b/7"},
+		{Op: "add", Path: "/missing/deeper", Value: 1},
+		{Op: "add", Path: "/a/b/01", Value: 1},
+		{Op: "move", From: "/missing", Path: "/x"},
+		{Op: "add", Path: "no-slash", Value: 1},
+		{Op: "frobnicate", Path: "/c"},
+	} {
+		doc, _ := decodeGeneric([]byte(`{"a": {"b": [1, 2, 3]}, "c": "x"}`))
+		_, err := Patch{o}.ApplyDocument(doc)
+		if err == nil {
+			t.Fatalf("Expected an error for %v but didn't get one", o)
+		}
+	}
+}
+
+func TestParsePointerEscapes(t *testing.T) {
+	path, err := parsePointer("/a~1b/c~0d")
+	for _, i := range [][]interface{}{
+		{err, nil},
+		{len(path), 2},
+		{path[0], "a/b"},
+		{path[1], "c~d"},
+		{escapePointer("a/b"), "a~1b"},
+		{escapePointer("c~d"), "c~0d"},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+}
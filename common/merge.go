@@ -0,0 +1,197 @@
+// Author:: Jonathan Hartman (<j@p4nt5.com>)
+//
+// Copyright (C) 2014, Jonathan Hartman
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package common implements a shared set of Goulash functionality.
+
+This file defines a three-way merge. Given a common base and two structs
+derived from it, "ours" and "theirs", Merge keeps every change made on either
+side and reports a Conflict wherever both sides changed the same value in
+different ways.
+*/
+package common
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// Conflict implements a single value changed on both sides of a merge. Any of
+// Base, Ours, and Theirs are nil where that side doesn't have the value.
+type Conflict struct {
+	Path   string
+	Base   interface{}
+	Ours   interface{}
+	Theirs interface{}
+}
+
+// String returns a one-line description of a Conflict.
+func (c Conflict) String() string {
+	return fmt.Sprintf("%v: base %v, ours %v, theirs %v", c.Path, c.Base, c.Ours, c.Theirs)
+}
+
+// Merge returns a new struct of the same type as base with the changes from
+// base to both ours and theirs, plus a list of conflicts sorted by path.
+// Conflicting values are left as they are in ours. Slices are merged as sets,
+// or matched by key, as they are by Diff. None of the inputs are modified and
+// nothing in the result is shared with them.
+func Merge(base Emptier, ours Emptier, theirs Emptier) (res Emptier, conflicts []Conflict) {
+	vours := reflect.ValueOf(ours)
+	v := mergeValue("", reflect.ValueOf(base), vours, reflect.ValueOf(theirs), vours.Type(), &conflicts)
+	res = v.Interface().(Emptier)
+	sort.SliceStable(conflicts, func(i, j int) bool {
+		return conflicts[i].Path < conflicts[j].Path
+	})
+	return
+}
+
+// mergeValue implements the iterable portion of Merge, returning a new value
+// of type t, or an invalid value if the merge removes it. Any of the base,
+// ours, and theirs values may be invalid where they don't exist.
+func mergeValue(path string, base, ours, theirs reflect.Value, t reflect.Type, conflicts *[]Conflict) reflect.Value {
+	switch {
+	case equalValue(ours, theirs, nil, ""):
+		return cloneMaybe(ours, t)
+	case equalValue(base, ours, nil, ""):
+		return cloneMaybe(theirs, t)
+	case equalValue(base, theirs, nil, ""):
+		return cloneMaybe(ours, t)
+	case !ours.IsValid() || !theirs.IsValid() || t == timeType:
+		return mergeConflict(path, base, ours, theirs, t, conflicts)
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		if ours.IsNil() || theirs.IsNil() {
+			return mergeConflict(path, base, ours, theirs, t, conflicts)
+		}
+		res := reflect.New(t.Elem())
+		res.Elem().Set(mergeValue(path, elemValue(base), ours.Elem(), theirs.Elem(), t.Elem(), conflicts))
+		return res
+	case reflect.Struct:
+		res := reflect.New(t).Elem()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			fpath := f.Name
+			if path != "" {
+				fpath = path + "." + f.Name
+			}
+			v := mergeValue(fpath, fieldValue(base, i), ours.Field(i), theirs.Field(i), f.Type, conflicts)
+			if v.IsValid() {
+				res.Field(i).Set(v)
+			}
+		}
+		return res
+	case reflect.Map:
+		res := reflect.MakeMap(t)
+		seen := map[interface{}]bool{}
+		for _, m := range []reflect.Value{base, ours, theirs} {
+			if nilValue(m) {
+				continue
+			}
+			for _, k := range m.MapKeys() {
+				if seen[k.Interface()] {
+					continue
+				}
+				seen[k.Interface()] = true
+				kpath := path + "[" + formatKey(k) + "]"
+				v := mergeValue(kpath, mapIndex(base, k), mapIndex(ours, k), mapIndex(theirs, k), t.Elem(), conflicts)
+				if v.IsValid() {
+					res.SetMapIndex(k, v)
+				}
+			}
+		}
+		return res
+	case reflect.Slice:
+		if key, ok := sliceKey(t); ok {
+			return mergeKeyedSlice(path, base, ours, theirs, t, key, conflicts)
+		}
+		// Keep everything of ours that theirs didn't remove, then add
+		// anything theirs added
+		res := reflect.MakeSlice(t, 0, 0)
+		for i := 0; i < ours.Len(); i++ {
+			e := ours.Index(i)
+			if !nilValue(base) && containsValue(base, e, nil, "") && !containsValue(theirs, e, nil, "") {
+				continue
+			}
+			res = reflect.Append(res, cloneValue(e, t.Elem()))
+		}
+		for i := 0; i < theirs.Len(); i++ {
+			e := theirs.Index(i)
+			if (nilValue(base) || !containsValue(base, e, nil, "")) && !containsValue(res, e, nil, "") {
+				res = reflect.Append(res, cloneValue(e, t.Elem()))
+			}
+		}
+		return res
+	}
+	return mergeConflict(path, base, ours, theirs, t, conflicts)
+}
+
+// mergeKeyedSlice implements the portion of Merge for slices whose elements
+// are matched by a key field, merging them the way map entries are.
+func mergeKeyedSlice(path string, base, ours, theirs reflect.Value, t reflect.Type, key int, conflicts *[]Conflict) reflect.Value {
+	res := reflect.MakeSlice(t, 0, 0)
+	for _, s := range []reflect.Value{ours, theirs, base} {
+		if nilValue(s) {
+			continue
+		}
+		for i := 0; i < s.Len(); i++ {
+			k := keyValue(s.Index(i), key)
+			if !k.IsValid() || findKey(res, key, k).IsValid() {
+				continue
+			}
+			kpath := path + "[" + formatKey(k) + "]"
+			v := mergeValue(kpath, findKey(base, key, k), findKey(ours, key, k), findKey(theirs, key, k), t.Elem(), conflicts)
+			if v.IsValid() {
+				res = reflect.Append(res, v)
+			}
+		}
+	}
+	return res
+}
+
+// mergeConflict records a Conflict and returns a copy of our side of it.
+func mergeConflict(path string, base, ours, theirs reflect.Value, t reflect.Type, conflicts *[]Conflict) reflect.Value {
+	*conflicts = append(*conflicts, Conflict{
+		Path:   path,
+		Base:   interfaceOf(base),
+		Ours:   interfaceOf(ours),
+		Theirs: interfaceOf(theirs),
+	})
+	return cloneMaybe(ours, t)
+}
+
+// cloneMaybe returns a deep copy of a value, or an invalid value if the value
+// is invalid.
+func cloneMaybe(v reflect.Value, t reflect.Type) reflect.Value {
+	if !v.IsValid() {
+		return v
+	}
+	return cloneValue(v, t)
+}
+
+// interfaceOf returns the interface{} held by a value, or nil if the value is
+// invalid.
+func interfaceOf(v reflect.Value) interface{} {
+	if !v.IsValid() {
+		return nil
+	}
+	return v.Interface()
+}
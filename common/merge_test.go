@@ -0,0 +1,99 @@
+package common
+
+import (
+	"testing"
+)
+
+func TestMergeNoConflicts(t *testing.T) {
+	base := ndata()
+	ours := ndata()
+	ours.Name = "ours"
+	ours.Tags = []string{"a", "b", "x"}
+	ours.Children["mine"] = &nested{Name: "mine"}
+	theirs := ndata()
+	theirs.Count = 5
+	theirs.Tags = []string{"b", "y"}
+	theirs.Children["one"].Count = 2
+	theirs.Children["theirs"] = &nested{Name: "theirs"}
+	res, conflicts := Merge(base, ours, theirs)
+	m := res.(*nested)
+	for _, i := range [][]interface{}{
+		{len(conflicts), 0},
+		{m.Name, "ours"},
+		{m.Count, 5},
+		{len(m.Tags), 3},
+		{m.Tags[0], "b"},
+		{m.Tags[1], "x"},
+		{m.Tags[2], "y"},
+		{m.Children["one"].Count, 2},
+		{m.Children["mine"].Name, "mine"},
+		{m.Children["theirs"].Name, "theirs"},
+		{m.Children["one"] == theirs.Children["one"], false},
+		{base.Count, 1},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+}
+
+func TestMergeConflicts(t *testing.T) {
+	base := ndata()
+	ours := ndata()
+	ours.Name = "ours"
+	ours.Children["one"].Count = 2
+	theirs := ndata()
+	theirs.Name = "theirs"
+	delete(theirs.Children, "one")
+	res, conflicts := Merge(base, ours, theirs)
+	m := res.(*nested)
+	for _, i := range [][]interface{}{
+		{len(conflicts), 2},
+		{conflicts[0].Path, `Children["one"]`},
+		{conflicts[0].Theirs, nil},
+		{conflicts[1].Path, "Name"},
+		{conflicts[1].Base, "top"},
+		{conflicts[1].Ours, "ours"},
+		{conflicts[1].Theirs, "theirs"},
+		{conflicts[1].String(), "Name: base top, ours ours, theirs theirs"},
+		{m.Name, "ours"},
+		{m.Children["one"].Count, 2},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+}
+
+func TestMergeBothAdded(t *testing.T) {
+	base := ndata()
+	ours := ndata()
+	ours.Children["new"] = &nested{Name: "new", Count: 1}
+	theirs := ndata()
+	theirs.Children["new"] = &nested{Name: "new", Count: 2}
+	res, conflicts := Merge(base, ours, theirs)
+	for _, i := range [][]interface{}{
+		{len(conflicts), 1},
+		{conflicts[0].Path, `Children["new"].Count`},
+		{conflicts[0].Base, nil},
+		{res.(*nested).Children["new"].Count, 1},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+}
+
+func TestMergeKeyedSlice(t *testing.T) {
+	base := &kinds{Keyed: []*keyed{{"a", "1.0", 1}, {"b", "1.0", 1}}}
+	ours := &kinds{Keyed: []*keyed{{"a", "1.0", 2}, {"b", "1.0", 1}, {"c", "1.0", 1}}}
+	theirs := &kinds{Keyed: []*keyed{{"a", "1.1", 1}}}
+	res, conflicts := Merge(base, ours, theirs)
+	exp := &kinds{Keyed: []*keyed{{"a", "1.1", 2}, {"c", "1.0", 1}}}
+	if len(conflicts) != 0 {
+		t.Fatalf("Expected no conflicts, got: %v", conflicts)
+	}
+	if !Equals(res, exp) {
+		t.Fatalf("Expected: %v, got: %v", exp, res)
+	}
+}
@@ -0,0 +1,114 @@
+// Author:: Jonathan Hartman (<j@p4nt5.com>)
+//
+// Copyright (C) 2014, Jonathan Hartman
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package common implements a shared set of Goulash functionality.
+
+This file defines the options that Diff, Equals, and Changes accept to skip
+fields or compare values of a type with a custom function, e.g.
+
+	pos, neg := c1.Diff(c2, common.IgnoreComponent(), common.IgnoreFields("Metrics"))
+
+Fields tagged `goulash:"nodiff"` are always skipped.
+*/
+package common
+
+import (
+	"reflect"
+	"strings"
+)
+
+// Option implements a single setting for a comparison.
+type Option func(*options)
+
+// options holds the combined settings of a list of Options. A nil *options
+// holds the defaults.
+type options struct {
+	ignore      map[string]bool
+	comparators map[reflect.Type]func(a, b interface{}) bool
+}
+
+// IgnoreFields skips any struct fields with the given names. A plain name,
+// e.g. "ETag", matches a field of that name at any depth; a dotted path, e.g.
+// "Metrics.Downloads", matches the field names leading down to it from the
+// top-level struct, with map keys and slice indexes left out.
+func IgnoreFields(names ...string) Option {
+	return func(o *options) {
+		for _, n := range names {
+			o.ignore[n] = true
+		}
+	}
+}
+
+// IgnoreComponent skips the Component fields (Endpoint and ETag) shared by
+// all the Goulash structs, which change with every fetch.
+func IgnoreComponent() Option {
+	return IgnoreFields("Component")
+}
+
+// CustomComparator compares any values of type t with a function that
+// reports whether they're equal. Values it considers different are diffed as
+// a whole rather than field by field.
+func CustomComparator(t reflect.Type, fn func(a, b interface{}) bool) Option {
+	return func(o *options) {
+		o.comparators[t] = fn
+	}
+}
+
+// newOptions combines a list of Options, returning nil if there are none.
+func newOptions(opts []Option) (o *options) {
+	if len(opts) == 0 {
+		return
+	}
+	o = &options{
+		ignore:      map[string]bool{},
+		comparators: map[reflect.Type]func(a, b interface{}) bool{},
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return
+}
+
+// skipField checks whether a struct field is left out of a comparison, and
+// returns its path for use further down.
+func (o *options) skipField(path string, f reflect.StructField) (fpath string, skip bool) {
+	fpath = f.Name
+	if path != "" {
+		fpath = path + "." + f.Name
+	}
+	if !f.IsExported() {
+		return fpath, true
+	}
+	for _, t := range strings.Split(f.Tag.Get("goulash"), ",") {
+		if t == "nodiff" {
+			return fpath, true
+		}
+	}
+	if o != nil && (o.ignore[f.Name] || o.ignore[fpath]) {
+		skip = true
+	}
+	return
+}
+
+// comparator returns any custom comparison function for a value's type.
+func (o *options) comparator(v reflect.Value) (fn func(a, b interface{}) bool, ok bool) {
+	if o == nil {
+		return
+	}
+	fn, ok = o.comparators[v.Type()]
+	return
+}
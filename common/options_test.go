@@ -0,0 +1,125 @@
+package common
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type tagged struct {
+	Name    string
+	Fetched string `goulash:"nodiff"`
+	Meta    thing
+	Other   thing
+}
+
+func (t *tagged) Empty() (empty bool) {
+	empty = Empty(t)
+	return
+}
+
+func TestNoDiffTag(t *testing.T) {
+	t1 := &tagged{Name: "a", Fetched: "monday"}
+	t2 := &tagged{Name: "a", Fetched: "tuesday"}
+	pos, neg := Diff(t1, t2, &tagged{}, &tagged{})
+	for _, i := range [][]interface{}{
+		{Equals(t1, t2), true},
+		{pos, nil},
+		{neg, nil},
+		{len(Changes(t1, t2)), 0},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+}
+
+func TestIgnoreFields(t *testing.T) {
+	t1 := &tagged{Name: "a", Meta: thing{ETag: "1"}, Other: thing{ETag: "1"}}
+	t2 := &tagged{Name: "a", Meta: thing{ETag: "2"}, Other: thing{ETag: "2"}}
+	pos, neg := Diff(t1, t2, &tagged{}, &tagged{}, IgnoreFields("Meta.ETag"))
+	for _, i := range [][]interface{}{
+		{Equals(t1, t2, IgnoreFields("ETag")), true},
+		{Equals(t1, t2, IgnoreFields("Meta")), false},
+		{Equals(t1, t2, IgnoreFields("Meta", "Other")), true},
+		{Equals(t1, t2, IgnoreFields("Other.Endpoint")), false},
+		{pos.(*tagged).Meta.ETag, ""},
+		{pos.(*tagged).Other.ETag, "2"},
+		{neg.(*tagged).Other.ETag, "1"},
+		{len(Changes(t1, t2, IgnoreFields("Other.ETag"))), 1},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+}
+
+func TestIgnoreFieldsUnderMaps(t *testing.T) {
+	n1 := ndata()
+	n2 := ndata()
+	n2.Children["one"].Count = 3
+	for _, i := range [][]interface{}{
+		{Equals(n1, n2, IgnoreFields("Children.Count")), true},
+		{Equals(n1, n2, IgnoreFields("Count")), true},
+		{Equals(n1, n2, IgnoreFields("Children.Name")), false},
+		{len(Changes(n1, n2, IgnoreFields("Children.Count"))), 0},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+}
+
+func TestIgnoreComponent(t *testing.T) {
+	type component struct {
+		Endpoint string
+	}
+	type wrapper struct {
+		component
+		Component thing
+		Name      string
+	}
+	w1 := &wrapper{Component: thing{ETag: "1"}, Name: "a"}
+	w2 := &wrapper{Component: thing{ETag: "2"}, Name: "a"}
+	res := equalValue(reflect.ValueOf(w1), reflect.ValueOf(w2), newOptions([]Option{IgnoreComponent()}), "")
+	if res != true {
+		t.Fatalf("Expected true, got: %v", res)
+	}
+}
+
+func TestCustomComparator(t *testing.T) {
+	fold := CustomComparator(reflect.TypeOf(thing{}), func(a, b interface{}) bool {
+		return strings.EqualFold(a.(thing).Endpoint, b.(thing).Endpoint)
+	})
+	t1 := &tagged{Name: "a", Meta: thing{Endpoint: "abc", ETag: "1"}}
+	t2 := &tagged{Name: "a", Meta: thing{Endpoint: "ABC", ETag: "2"}}
+	t3 := &tagged{Name: "a", Meta: thing{Endpoint: "xyz", ETag: "1"}}
+	pos, neg := Diff(t1, t3, &tagged{}, &tagged{}, fold)
+	changes := Changes(t1, t3, fold)
+	for _, i := range [][]interface{}{
+		{Equals(t1, t2, fold), true},
+		{Equals(t1, t2), false},
+		{Equals(t1, t3, fold), false},
+		{pos.(*tagged).Meta, thing{Endpoint: "xyz", ETag: "1"}},
+		{neg.(*tagged).Meta, thing{Endpoint: "abc", ETag: "1"}},
+		{len(changes), 1},
+		{changes[0].Path, "Meta"},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+}
+
+func TestFieldPath(t *testing.T) {
+	for _, i := range [][]interface{}{
+		{fieldPath(`Cookbooks["nginx"].Versions["2.7.4"].Dependencies["apt"]`), "Cookbooks.Versions.Dependencies"},
+		{fieldPath(`Keyed["a]\"b"].Version`), "Keyed.Version"},
+		{fieldPath(`Versions[3]`), "Versions"},
+		{fieldPath(""), ""},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+}
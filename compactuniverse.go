@@ -0,0 +1,117 @@
+// Author:: Jonathan Hartman (<j@p4nt5.com>)
+//
+// Copyright (C) 2014, Jonathan Hartman
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package goulash implements a Go client library for the Chef Supermarket API.
+
+This file defines a CompactUniverse struct, a read-only alternative to
+Universe for holding a full public universe in memory. It decodes the same
+universe endpoint, but stores each cookbook as a universe.CompactCookbook
+that shares its strings and constraints with every other cookbook.
+*/
+package goulash
+
+import (
+	"context"
+	"sort"
+
+	"github.com/RoboticCheese/goulash/universe"
+)
+
+// CompactUniverse contains a map of cookbook name strings to compact
+// Cookbook items, accessible through its methods.
+type CompactUniverse struct {
+	Component
+	APIInstance *APIInstance
+	cookbooks   map[string]*universe.CompactCookbook
+}
+
+// NewCompactUniverse accepts a pointer to an APIInstance struct and uses it
+// to initialize and return a pointer to a new CompactUniverse struct.
+func NewCompactUniverse(i *APIInstance) (u *CompactUniverse, err error) {
+	u = InitCompactUniverse()
+	u.APIInstance = i
+	u.Component, err = newComponent(context.Background(), i, u.APIInstance.BaseURL+"/universe")
+	if err != nil {
+		return
+	}
+
+	resp, err := i.get(context.Background(), u.Endpoint)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	tempU := map[string]map[string]*universe.CookbookVersion{}
+	err = decodeUniverseJSON(resp.Body, &tempU)
+	if err != nil {
+		return
+	}
+	in := universe.NewInterner()
+	for cbName, cb := range tempU {
+		c := universe.NewCookbook()
+		c.Name = cbName
+		for cvName, cv := range cb {
+			cv.Version = cvName
+			c.Versions[cvName] = cv
+		}
+		u.cookbooks[cbName] = universe.NewCompactCookbook(in, c)
+		// Let each cookbook's uncompacted data be collected as we go
+		delete(tempU, cbName)
+	}
+	return
+}
+
+// InitCompactUniverse generates an empty CompactUniverse struct.
+func InitCompactUniverse() (u *CompactUniverse) {
+	u = new(CompactUniverse)
+	u.cookbooks = map[string]*universe.CompactCookbook{}
+	return
+}
+
+// Cookbook returns a single compact Cookbook by name, or nil if it doesn't
+// exist.
+func (u *CompactUniverse) Cookbook(name string) *universe.CompactCookbook {
+	return u.cookbooks[name]
+}
+
+// CookbookNames returns the sorted names of every cookbook in a
+// CompactUniverse.
+func (u *CompactUniverse) CookbookNames() (names []string) {
+	names = make([]string, 0, len(u.cookbooks))
+	for name := range u.cookbooks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return
+}
+
+// Len returns the number of cookbooks in a CompactUniverse.
+func (u *CompactUniverse) Len() int {
+	return len(u.cookbooks)
+}
+
+// Expand returns a pointer to a new, regular Universe struct with the same
+// data as a CompactUniverse.
+func (u *CompactUniverse) Expand() (u2 *Universe) {
+	u2 = InitUniverse()
+	u2.Component = u.Component
+	u2.APIInstance = u.APIInstance
+	for name, cc := range u.cookbooks {
+		u2.Cookbooks[name] = cc.Expand()
+	}
+	return
+}
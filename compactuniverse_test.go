@@ -0,0 +1,196 @@
+package goulash
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime"
+	"testing"
+
+	"github.com/RoboticCheese/goulash/universe"
+)
+
+func TestNewCompactUniverseNoError(t *testing.T) {
+	ts := StartHTTP(uhttpBody(ujsonData()), nil)
+	defer ts.Close()
+
+	i := new(APIInstance)
+	i.BaseURL = ts.URL
+	u, err := NewCompactUniverse(i)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	cv := u.Cookbook("chef").Version("0.12.0")
+	c, _ := cv.Dependency("runit")
+	for _, i := range [][]interface{}{
+		{u.Len(), 2},
+		{u.Endpoint, ts.URL + "/universe"},
+		{u.CookbookNames()[0], "chef"},
+		{u.CookbookNames()[1], "djbdns"},
+		{u.Cookbook("chef").Name(), "chef"},
+		{cv.Version(), "0.12.0"},
+		{cv.LocationType(), "opscode"},
+		{cv.LocationPath(), "https://supermarket.chef.io/api/v1"},
+		{cv.DownloadURL(), "https://supermarket.chef.io/api/v1/cookbooks/chef/versions/0.12.0/download"},
+		{c.String(), ">= 0.0.0"},
+		{u.Cookbook("nope") == nil, true},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+}
+
+func TestNewCompactUniverseMatchesNewUniverse(t *testing.T) {
+	ts := StartHTTP(uhttpBody(ujsonData()), nil)
+	defer ts.Close()
+
+	i := new(APIInstance)
+	i.BaseURL = ts.URL
+	u1, _ := NewUniverse(i)
+	u2, err := NewCompactUniverse(i)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if !u1.Equals(u2.Expand()) {
+		t.Fatalf("Expected %v, got: %v", u1, u2.Expand())
+	}
+}
+
+func TestNewCompactUniverseConnError(t *testing.T) {
+	ts := StartHTTP(uhttpBody(ujsonData()), nil)
+	ts.Close()
+
+	i := new(APIInstance)
+	i.BaseURL = ts.URL
+	_, err := NewCompactUniverse(i)
+	if err == nil {
+		t.Fatalf("Expected an error but didn't get one")
+	}
+}
+
+func TestNewCompactUniverse404Error(t *testing.T) {
+	ts := StartHTTP(http.NotFound, nil)
+	defer ts.Close()
+
+	i := new(APIInstance)
+	i.BaseURL = ts.URL
+	_, err := NewCompactUniverse(i)
+	if err == nil {
+		t.Fatalf("Expected an error but didn't get one")
+	}
+}
+
+func TestNewCompactUniverseBadConstraint(t *testing.T) {
+	data := ujsonData()
+	data["chef"]["0.12.0"].Dependencies["runit"] = "?? 1.0.0"
+	ts := StartHTTP(uhttpBody(data), nil)
+	defer ts.Close()
+
+	i := new(APIInstance)
+	i.BaseURL = ts.URL
+	u, err := NewCompactUniverse(i)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	c, _ := u.Cookbook("chef").Version("0.12.0").Dependency("runit")
+	if c.String() != "?? 1.0.0" {
+		t.Fatalf("Expected: ?? 1.0.0, got: %v", c.String())
+	}
+}
+
+func TestNewCompactUniverseBadVersion(t *testing.T) {
+	data := ujsonData()
+	data["chef"]["1.0.0.rc1"] = data["chef"]["0.12.0"].Clone()
+	ts := StartHTTP(uhttpBody(data), nil)
+	defer ts.Close()
+
+	i := new(APIInstance)
+	i.BaseURL = ts.URL
+	u1, _ := NewUniverse(i)
+	u2, err := NewCompactUniverse(i)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	for _, i := range [][]interface{}{
+		{u2.Len(), 2},
+		{u2.Cookbook("chef").Version("1.0.0.rc1").Version(), "1.0.0.rc1"},
+		{u2.Cookbook("chef").Version("0.12.0").Version(), "0.12.0"},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+	if !u1.Equals(u2.Expand()) {
+		t.Fatalf("Expected %v, got: %v", u1, u2.Expand())
+	}
+}
+
+// benchUniverseBody generates a universe JSON body roughly shaped like the
+// public Supermarket one, with a given number of cookbooks and versions.
+func benchUniverseBody(cookbooks int, versions int) string {
+	data := map[string]map[string]*universe.CookbookVersion{}
+	for c := 0; c < cookbooks; c++ {
+		name := fmt.Sprintf("cookbook%d", c)
+		data[name] = map[string]*universe.CookbookVersion{}
+		for v := 0; v < versions; v++ {
+			ver := fmt.Sprintf("%d.%d.0", v/10, v%10)
+			data[name][ver] = &universe.CookbookVersion{
+				LocationType: "opscode",
+				LocationPath: "https://supermarket.chef.io/api/v1",
+				DownloadURL:  "https://supermarket.chef.io/api/v1/cookbooks/" + name + "/versions/" + ver + "/download",
+				Dependencies: map[string]string{
+					"apt":             ">= 0.0.0",
+					"build-essential": "~> 2.0",
+					fmt.Sprintf("cookbook%d", (c+1)%cookbooks): ">= 0.0.0",
+				},
+			}
+		}
+	}
+	res, _ := json.Marshal(data)
+	return string(res)
+}
+
+// benchUniverse runs a universe constructor against a generated universe,
+// reporting the heap retained by a single result alongside the usual
+// allocation stats.
+func benchUniverse(b *testing.B, f func(*APIInstance) (interface{}, error)) {
+	ts := StartHTTP(benchUniverseBody(2000, 20), nil)
+	defer ts.Close()
+	i := new(APIInstance)
+	i.BaseURL = ts.URL
+
+	var with, without runtime.MemStats
+	u, err := f(i)
+	if err != nil {
+		b.Fatalf("Expected no error, got: %v", err)
+	}
+	runtime.GC()
+	runtime.ReadMemStats(&with)
+	runtime.KeepAlive(u)
+	u = nil
+	runtime.GC()
+	runtime.ReadMemStats(&without)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		_, err = f(i)
+		if err != nil {
+			b.Fatalf("Expected no error, got: %v", err)
+		}
+	}
+	b.ReportMetric(float64(with.HeapAlloc)-float64(without.HeapAlloc), "retained-B")
+}
+
+func BenchmarkNewUniverse(b *testing.B) {
+	benchUniverse(b, func(i *APIInstance) (interface{}, error) {
+		return NewUniverse(i)
+	})
+}
+
+func BenchmarkNewCompactUniverse(b *testing.B) {
+	benchUniverse(b, func(i *APIInstance) (interface{}, error) {
+		return NewCompactUniverse(i)
+	})
+}
@@ -23,7 +23,7 @@ by any other Goulash structs.
 package goulash
 
 import (
-	"net/http"
+	"context"
 
 	"github.com/RoboticCheese/goulash/common"
 )
@@ -34,12 +34,21 @@ type Component struct {
 	ETag     string
 }
 
+var _ common.Supermarketer[*Component] = (*Component)(nil)
+
 // NewComponent creates a new Component struct from a given endpoint string and
 // returns that struct and any error.
 func NewComponent(endpoint string) (c Component, err error) {
+	c, err = newComponent(context.Background(), nil, endpoint)
+	return
+}
+
+// newComponent creates a new Component struct from a given endpoint string,
+// making any requests through an APIInstance, which may be nil.
+func newComponent(ctx context.Context, i *APIInstance, endpoint string) (c Component, err error) {
 	c = InitComponent()
 	c.Endpoint = endpoint
-	err = c.getETag()
+	err = c.getETag(ctx, i)
 	return
 }
 
@@ -57,35 +66,32 @@ func (c *Component) Empty() (empty bool) {
 }
 
 // Equals checks whether one Component struct is equal to another.
-func (c *Component) Equals(c2 *Component) (equal bool) {
-	equal = common.Equals(c, c2)
+func (c *Component) Equals(c2 *Component, opts ...common.Option) (equal bool) {
+	equal = common.Equals(c, c2, opts...)
 	return
 }
 
 // Diff returns any attributes that have been changed from one Component struct
 // to another.
-func (c *Component) Diff(c2 *Component) (pos, neg *Component) {
-	ipos, ineg := common.Diff(c, c2, &Component{}, &Component{})
-	if ipos != nil {
-		pos = ipos.(*Component)
-	} else {
-		pos = nil
-	}
-	if ineg != nil {
-		neg = ineg.(*Component)
-	} else {
-		neg = nil
-	}
+func (c *Component) Diff(c2 *Component, opts ...common.Option) (pos, neg *Component) {
+	pos, neg = common.TypedDiff(c, c2, opts...)
+	return
+}
+
+// Clone returns a deep copy of a Component struct.
+func (c *Component) Clone() (res *Component) {
+	res = common.Clone(c)
 	return
 }
 
-// getETag accepts a URL string and returns any ETag header and error returned
-// from an HTTP HEAD on that URL.
-func (c *Component) getETag() (err error) {
-	resp, err := http.Head(c.Endpoint)
+// getETag sets the ETag header returned from an HTTP HEAD on the endpoint,
+// made through an APIInstance, which may be nil.
+func (c *Component) getETag(ctx context.Context, i *APIInstance) (err error) {
+	resp, err := i.head(ctx, c.Endpoint)
 	if err != nil {
 		return
 	}
+	resp.Body.Close()
 	c.ETag = resp.Header.Get("etag")
 	return
 }
@@ -133,7 +133,7 @@ func TestComponentDiffChangedData(t *testing.T) {
 	c2 := Component{Endpoint: "uvw", ETag: "xyz"}
 	pos1, neg1 := c1.Diff(&c2)
 	pos2, neg2 := c2.Diff(&c1)
-	for _, k := range [][]common.Supermarketer{
+	for _, k := range [][]common.Emptier{
 		{pos1, &Component{Endpoint: "uvw", ETag: "xyz"}},
 		{neg1, &Component{Endpoint: "abc", ETag: "def"}},
 		{pos2, &Component{Endpoint: "abc", ETag: "def"}},
@@ -144,3 +144,17 @@ func TestComponentDiffChangedData(t *testing.T) {
 		}
 	}
 }
+
+func TestComponentClone(t *testing.T) {
+	c := &Component{Endpoint: "https://example.com", ETag: "abc"}
+	res := c.Clone()
+	res.ETag = "def"
+	for _, i := range [][]interface{}{
+		{c.ETag, "abc"},
+		{res.Endpoint, "https://example.com"},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+}
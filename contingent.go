@@ -0,0 +1,117 @@
+// Author:: Jonathan Hartman (<j@p4nt5.com>)
+//
+// Copyright (C) 2014, Jonathan Hartman
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package goulash implements a Go client library for the Chef Supermarket API.
+
+This file defines a cookbook's contingent list, the versions of other
+cookbooks that depend on it, e.g.
+
+https://supermarket.chef.io/api/v1/cookbooks/dmg/contingent =>
+
+	{
+		"contingents": [
+			{"name": "chef-dk", "version": "2.0.1"},
+			{"name": "chef-dk", "version": "2.0.0"}
+		]
+	}
+
+The same list can be worked out from the dependencies in a Universe, and the
+two compared.
+*/
+package goulash
+
+import (
+	"context"
+	"sort"
+
+	"github.com/RoboticCheese/goulash/universe"
+)
+
+// Contingent implements a single version of a cookbook that depends on
+// another.
+type Contingent struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// Contingent returns the versions of other cookbooks that depend on a
+// cookbook, according to the Supermarket.
+func (c *Cookbook) Contingent() (res []Contingent, err error) {
+	var data struct {
+		Contingents []Contingent `json:"contingents"`
+	}
+	err = c.api.request(context.Background(), "GET", c.Endpoint+"/contingent", nil, &data)
+	if err != nil {
+		return
+	}
+	res = data.Contingents
+	if res == nil {
+		res = []Contingent{}
+	}
+	return
+}
+
+// Dependents returns the versions of cookbooks in a Lookup whose dependencies
+// include a named cookbook, sorted by name and then version.
+func Dependents(l Lookup, name string) (res []Contingent) {
+	res = []Contingent{}
+	for _, n := range l.CookbookNames() {
+		for v, cv := range l.Cookbook(n).Versions {
+			if _, ok := cv.Dependencies[name]; ok {
+				res = append(res, Contingent{Name: n, Version: v})
+			}
+		}
+	}
+	sortContingents(res)
+	return
+}
+
+// CheckContingent compares a cookbook's contingent list with its dependents
+// in a Lookup, e.g. a fetched Universe, and returns the versions only the
+// contingent list has and the versions only the Lookup has.
+func CheckContingent(l Lookup, name string, contingent []Contingent) (missingFromLookup, missingFromContingent []Contingent) {
+	missingFromLookup = []Contingent{}
+	missingFromContingent = []Contingent{}
+	listed := map[Contingent]bool{}
+	for _, c := range contingent {
+		listed[c] = true
+	}
+	found := map[Contingent]bool{}
+	for _, c := range Dependents(l, name) {
+		found[c] = true
+		if !listed[c] {
+			missingFromContingent = append(missingFromContingent, c)
+		}
+	}
+	for c := range listed {
+		if !found[c] {
+			missingFromLookup = append(missingFromLookup, c)
+		}
+	}
+	sortContingents(missingFromLookup)
+	return
+}
+
+// sortContingents sorts a list of Contingents by name and then version.
+func sortContingents(cs []Contingent) {
+	sort.Slice(cs, func(i, j int) bool {
+		if cs[i].Name != cs[j].Name {
+			return cs[i].Name < cs[j].Name
+		}
+		return universe.CompareVersions(cs[i].Version, cs[j].Version) < 0
+	})
+}
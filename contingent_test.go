@@ -0,0 +1,123 @@
+package goulash
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/RoboticCheese/goulash/universe"
+)
+
+func contingentUniverse() (u *Universe) {
+	u = InitUniverse()
+	u.Cookbooks["chef-dk"] = &universe.Cookbook{
+		Name: "chef-dk",
+		Versions: map[string]*universe.CookbookVersion{
+			"2.0.0":  &universe.CookbookVersion{Version: "2.0.0", Dependencies: map[string]string{"dmg": "~> 2.2"}},
+			"10.0.0": &universe.CookbookVersion{Version: "10.0.0", Dependencies: map[string]string{"dmg": "~> 4.0"}},
+			"1.0.0":  &universe.CookbookVersion{Version: "1.0.0", Dependencies: map[string]string{}},
+		},
+	}
+	u.Cookbooks["apt"] = &universe.Cookbook{
+		Name: "apt",
+		Versions: map[string]*universe.CookbookVersion{
+			"1.0.0": &universe.CookbookVersion{Version: "1.0.0", Dependencies: map[string]string{"dmg": ">= 0.0.0"}},
+		},
+	}
+	u.Cookbooks["dmg"] = &universe.Cookbook{
+		Name: "dmg",
+		Versions: map[string]*universe.CookbookVersion{
+			"2.2.0": &universe.CookbookVersion{Version: "2.2.0", Dependencies: map[string]string{}},
+		},
+	}
+	return
+}
+
+func TestCookbookContingent(t *testing.T) {
+	ts := StartHTTP(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/cookbooks/dmg":
+			fmt.Fprint(w, `{"name": "dmg"}`)
+		case "/api/v1/cookbooks/dmg/contingent":
+			fmt.Fprint(w, `{"contingents": [
+				{"name": "chef-dk", "version": "2.0.0"},
+				{"name": "homebrew", "version": "1.5.0"}
+			]}`)
+		case "/api/v1/cookbooks/apt/contingent":
+			fmt.Fprint(w, `{"contingents": []}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}, nil)
+	defer ts.Close()
+	i := new(APIInstance)
+	i.Endpoint = ts.URL + "/api/v1"
+
+	c, _ := NewCookbook(i, "dmg")
+	res, err := c.Contingent()
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	c.Endpoint = ts.URL + "/api/v1/cookbooks/apt"
+	none, err := c.Contingent()
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	for _, i := range [][]interface{}{
+		{len(res), 2},
+		{res[0], Contingent{Name: "chef-dk", Version: "2.0.0"}},
+		{res[1], Contingent{Name: "homebrew", Version: "1.5.0"}},
+		{len(none), 0},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+
+	c.Endpoint = ts.URL + "/api/v1/cookbooks/nope"
+	_, err = c.Contingent()
+	if aerr, ok := err.(*APIError); !ok || aerr.StatusCode != 404 {
+		t.Fatalf("Expected a 404 APIError, got: %v", err)
+	}
+}
+
+func TestDependents(t *testing.T) {
+	res := Dependents(contingentUniverse(), "dmg")
+	for _, i := range [][]interface{}{
+		{len(res), 3},
+		{res[0], Contingent{Name: "apt", Version: "1.0.0"}},
+		{res[1], Contingent{Name: "chef-dk", Version: "2.0.0"}},
+		{res[2], Contingent{Name: "chef-dk", Version: "10.0.0"}},
+		{len(Dependents(contingentUniverse(), "apt")), 0},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+}
+
+func TestCheckContingent(t *testing.T) {
+	u := contingentUniverse()
+	fromLookup, fromContingent := CheckContingent(u, "dmg", []Contingent{
+		{Name: "homebrew", Version: "1.5.0"},
+		{Name: "chef-dk", Version: "2.0.0"},
+		{Name: "chef-dk", Version: "1.0.0"},
+	})
+	for _, i := range [][]interface{}{
+		{len(fromLookup), 2},
+		{fromLookup[0], Contingent{Name: "chef-dk", Version: "1.0.0"}},
+		{fromLookup[1], Contingent{Name: "homebrew", Version: "1.5.0"}},
+		{len(fromContingent), 2},
+		{fromContingent[0], Contingent{Name: "apt", Version: "1.0.0"}},
+		{fromContingent[1], Contingent{Name: "chef-dk", Version: "10.0.0"}},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+
+	fromLookup, fromContingent = CheckContingent(NewMultiUniverse(u), "dmg", Dependents(u, "dmg"))
+	if len(fromLookup) != 0 || len(fromContingent) != 0 {
+		t.Fatalf("Expected no differences, got: %v, %v", fromLookup, fromContingent)
+	}
+}
@@ -33,6 +33,7 @@ https://supermarket.chef.io/api/v1/cookbooks/chef-dk =>
 	"created_at": "2014-06-24T01:14:49.000Z",
 	"updated_at": "2014-09-20T04:46:00.780Z",
 	"deprecated": false,
+	"replacement": null,
 	"foodcritic_failure": false,
 	"versions": [
 		"https://supermarket.chef.io/api/v1/cookbooks/chef-dk/versions/2.0.1",
@@ -65,9 +66,9 @@ https://supermarket.chef.io/api/v1/cookbooks/chef-dk =>
 package goulash
 
 import (
+	"context"
 	"encoding/json"
 	"io"
-	"net/http"
 
 	"github.com/RoboticCheese/goulash/common"
 )
@@ -97,27 +98,44 @@ type Cookbook struct {
 	CreatedAt         string   `json:"created_at"`
 	UpdatedAt         string   `json:"updated_at"`
 	Deprecated        bool     `json:"deprecated"`
+	Replacement       string   `json:"replacement"` // The URL of a deprecated cookbook's replacement
 	FoodcriticFailure bool     `json:"foodcritic_failure"` // TODO: How to distinguish nil and false?
 	Versions          []string `json:"versions"`
 	Metrics           Metrics  `json:"metrics"`
+	api               *APIInstance
 }
 
+var _ common.Supermarketer[*Cookbook] = (*Cookbook)(nil)
+
 // NewCookbook initializes and returns a new Cookbook struct based on a
-// Supermarket struct and cookbook name.
+// Supermarket struct and cookbook name. From a Chef Server, only the name,
+// versions, and latest version are filled in.
 func NewCookbook(i *APIInstance, name string) (c *Cookbook, err error) {
+	c, err = newCookbook(context.Background(), i, name)
+	return
+}
+
+// newCookbook fetches a Cookbook as NewCookbook does, with a Context for its
+// requests.
+func newCookbook(ctx context.Context, i *APIInstance, name string) (c *Cookbook, err error) {
 	c = InitCookbook()
+	c.api = i
 	c.Endpoint = i.Endpoint + "/cookbooks/" + name
-	c.Component, err = NewComponent(c.Endpoint)
+	c.Component, err = newComponent(ctx, i, c.Endpoint)
 	if err != nil {
 		return
 	}
 
-	resp, err := http.Get(c.Endpoint)
+	resp, err := i.get(ctx, c.Endpoint)
 	if err != nil {
 		return
 	}
 	defer resp.Body.Close()
 
+	if i.ChefServer {
+		err = c.decodeChefServerJSON(resp.Body, name)
+		return
+	}
 	err = c.decodeJSON(resp.Body)
 	return
 }
@@ -139,31 +157,142 @@ func (c *Cookbook) Empty() (empty bool) {
 }
 
 // Equals implements an equality test for a Cookbook.
-func (c *Cookbook) Equals(c2 common.Supermarketer) (res bool) {
-	res = common.Equals(c, c2)
+func (c *Cookbook) Equals(c2 *Cookbook, opts ...common.Option) (res bool) {
+	res = common.Equals(c, c2, opts...)
 	return
 }
 
 // Diff returns any attributes added/changed/removed from one Cookbook struct
 // to another, represented by a positive and negative diff Cookbook.
-func (c *Cookbook) Diff(c2 *Cookbook) (pos, neg *Cookbook) {
-	ipos, ineg := common.Diff(c, c2, &Cookbook{}, &Cookbook{})
-	if ipos != nil {
-		pos = ipos.(*Cookbook)
-	} else {
-		pos = nil
-	}
-	if ineg != nil {
-		neg = ineg.(*Cookbook)
-	} else {
-		neg = nil
+func (c *Cookbook) Diff(c2 *Cookbook, opts ...common.Option) (pos, neg *Cookbook) {
+	pos, neg = common.TypedDiff(c, c2, opts...)
+	return
+}
+
+// Clone returns a deep copy of a Cookbook struct, made through the same
+// APIInstance.
+func (c *Cookbook) Clone() (res *Cookbook) {
+	res = common.Clone(c)
+	res.keepAPI(c)
+	return
+}
+
+// Apply returns a new Cookbook struct with a positive and negative diff, as
+// returned by Diff, applied to it. Either diff may be nil.
+func (c *Cookbook) Apply(pos, neg *Cookbook) (res *Cookbook) {
+	res = common.TypedApply(c, pos, neg)
+	res.keepAPI(c)
+	return
+}
+
+// Changes returns a flat list of every change from one Cookbook struct to
+// another.
+func (c *Cookbook) Changes(c2 *Cookbook, opts ...common.Option) (changes []common.Change) {
+	changes = common.Changes(c, c2, opts...)
+	return
+}
+
+// JSONPatch returns an RFC 6902 JSON Patch from one Cookbook struct to
+// another.
+func (c *Cookbook) JSONPatch(c2 *Cookbook) (p common.Patch, err error) {
+	p, err = common.JSONPatch(c, c2)
+	return
+}
+
+// ApplyJSONPatch applies an RFC 6902 JSON Patch to a Cookbook struct and
+// returns the result as a new Cookbook.
+func (c *Cookbook) ApplyJSONPatch(p common.Patch) (res *Cookbook, err error) {
+	ires, err := common.ApplyJSONPatch(c, p, &Cookbook{})
+	if err != nil {
+		return
 	}
+	res = ires.(*Cookbook)
+	res.keepAPI(c)
 	return
 }
 
+// keepAPI makes a Cookbook derived from another one use the same APIInstance,
+// which the common functions don't copy.
+func (c *Cookbook) keepAPI(from *Cookbook) {
+	if c != nil && from != nil {
+		c.api = from.api
+	}
+}
+
 // decodeJSON accepts an IO reader and a Cookbook struct and populates that
 // struct with the JSON data.
 func (c *Cookbook) decodeJSON(r io.Reader) (err error) {
 	decoder := json.NewDecoder(r)
 	return decoder.Decode(c)
 }
+
+// chefServerCookbook is a Cookbook as a Chef Server represents it, keyed by
+// name, with its versions newest first.
+type chefServerCookbook map[string]struct {
+	URL      string `json:"url"`
+	Versions []struct {
+		URL     string `json:"url"`
+		Version string `json:"version"`
+	} `json:"versions"`
+}
+
+// decodeChefServerJSON accepts an IO reader and populates a Cookbook struct
+// with the Chef Server JSON data for a named cookbook.
+func (c *Cookbook) decodeChefServerJSON(r io.Reader, name string) (err error) {
+	data := chefServerCookbook{}
+	err = json.NewDecoder(r).Decode(&data)
+	if err != nil {
+		return
+	}
+	c.Name = name
+	for _, v := range data[name].Versions {
+		c.Versions = append(c.Versions, v.URL)
+	}
+	if len(c.Versions) > 0 {
+		c.LatestVersion = c.Versions[0]
+	}
+	return
+}
+
+// Deprecate marks a cookbook deprecated, in favor of a replacement cookbook if
+// its name isn't empty, and returns the Cookbook as the Supermarket now has
+// it.
+func (c *Cookbook) Deprecate(ctx context.Context, replacement string) (res *Cookbook, err error) {
+	body := map[string]string{}
+	if replacement != "" {
+		body["replacement"] = replacement
+	}
+	res = c.refreshed()
+	err = c.api.call(ctx, "PUT", c.Endpoint+"/deprecate", body, res)
+	if err != nil {
+		res = nil
+	}
+	return
+}
+
+// Undeprecate marks a deprecated cookbook current again and returns the
+// Cookbook as the Supermarket now has it.
+func (c *Cookbook) Undeprecate(ctx context.Context) (res *Cookbook, err error) {
+	res = c.refreshed()
+	err = c.api.call(ctx, "DELETE", c.Endpoint+"/deprecate", nil, res)
+	if err != nil {
+		res = nil
+	}
+	return
+}
+
+// Delete removes a cookbook and every version of it from the Supermarket, as
+// `knife supermarket unshare` does.
+func (c *Cookbook) Delete(ctx context.Context) (err error) {
+	err = c.api.call(ctx, "DELETE", c.Endpoint, nil, nil)
+	return
+}
+
+// refreshed returns a new, empty Cookbook for the same endpoint and
+// APIInstance as a Cookbook, for a response to decode into.
+func (c *Cookbook) refreshed() (res *Cookbook) {
+	res = InitCookbook()
+	res.Endpoint = c.Endpoint
+	res.api = c.api
+	return
+}
@@ -1,8 +1,18 @@
 package goulash
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+
+	"github.com/RoboticCheese/goulash/common"
 )
 
 func cdata() (data Cookbook) {
@@ -544,3 +554,283 @@ func TestCookbookDiffDifferentMetrics(t *testing.T) {
 		}
 	}
 }
+
+func TestCookbookChanges(t *testing.T) {
+	data1 := cdata()
+	data2 := cdata()
+	data2.Deprecated = true
+	data2.Versions = []string{"1.2.3", "1.2.0", "1.1.0", "2.0.0"}
+	data2.Metrics.Downloads.Versions["1.1.0"] = 35
+	res := data1.Changes(&data2)
+	for _, i := range [][]interface{}{
+		{len(res), 3},
+		{res[0].Path, "Deprecated"},
+		{res[0].Kind, common.Modified},
+		{res[0].New, true},
+		{res[1].Path, `Metrics.Downloads.Versions["1.1.0"]`},
+		{res[1].Old, 34},
+		{res[1].New, 35},
+		{res[2].Path, "Versions[3]"},
+		{res[2].Kind, common.Added},
+		{res[2].New, "2.0.0"},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+}
+
+func TestCookbookJSONPatchRoundTrip(t *testing.T) {
+	data1 := cdata()
+	data2 := cdata()
+	data2.ETag = "abc"
+	data2.Deprecated = true
+	data2.Versions = []string{"2.0.0", "1.2.3"}
+	data2.Metrics.Downloads.Versions["2.0.0"] = 1
+	delete(data2.Metrics.Downloads.Versions, "1.1.0")
+	for _, i := range [][]*Cookbook{{&data1, &data2}, {&data2, &data1}} {
+		p, err := i[0].JSONPatch(i[1])
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		res, err := i[0].ApplyJSONPatch(p)
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		if !res.Equals(i[1]) {
+			t.Fatalf("Expected %v, got: %v", i[1], res)
+		}
+	}
+	if data1.Deprecated != false {
+		t.Fatalf("Expected the original to be unmodified, got: %v", data1)
+	}
+}
+
+func TestCookbookApply(t *testing.T) {
+	data1 := cdata()
+	data2 := cdata()
+	data2.Deprecated = true
+	data2.Versions = []string{"1.2.3", "2.0.0"}
+	data2.Metrics.Downloads.Versions["2.0.0"] = 1
+	data2.Metrics.Followers = 0
+	for _, i := range [][]*Cookbook{{&data1, &data2}, {&data2, &data1}} {
+		pos, neg := i[0].Diff(i[1])
+		res := i[0].Apply(pos, neg)
+		if !res.Equals(i[1]) {
+			t.Fatalf("Expected %v, got: %v", i[1], res)
+		}
+	}
+}
+
+func TestCookbookDiffOptions(t *testing.T) {
+	data1 := cdata()
+	data2 := cdata()
+	data2.ETag = "newtag"
+	data2.Metrics.Downloads.Versions["1.1.0"] = 35
+	data2.Metrics.Followers = 100
+	pos, neg := data1.Diff(&data2, common.IgnoreComponent(), common.IgnoreFields("Metrics.Downloads"))
+	for _, i := range [][]interface{}{
+		{data1.Equals(&data2, common.IgnoreComponent(), common.IgnoreFields("Metrics")), true},
+		{data1.Equals(&data2, common.IgnoreComponent()), false},
+		{pos.Metrics.Followers, 100},
+		{neg.Metrics.Followers, 123},
+		{pos.ETag, ""},
+		{len(pos.Metrics.Downloads.Versions), 0},
+		{len(data1.Changes(&data2, common.IgnoreFields("ETag", "Downloads"))), 1},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+}
+
+func TestCookbookClone(t *testing.T) {
+	data := cdata()
+	res := data.Clone()
+	res.Versions[0] = "9.9.9"
+	res.Metrics.Downloads.Versions["1.1.0"] = 0
+	for _, i := range [][]interface{}{
+		{data.Versions[0] != "9.9.9", true},
+		{data.Metrics.Downloads.Versions["1.1.0"], 34},
+		{data.Clone().Equals(&data), true},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+}
+
+// startMaintainerServer starts a Supermarket where roboticcheese maintains
+// chef-dk and can deprecate it or delete it or its 2.0.0 version, once.
+func startMaintainerServer(t *testing.T) (ts *httptest.Server) {
+	deleted := map[string]bool{}
+	ts = StartHTTP(func(w http.ResponseWriter, r *http.Request) {
+		cookbook := ts.URL + "/api/v1/cookbooks/chef-dk"
+		if r.Method == "GET" {
+			switch r.URL.Path {
+			case "/api/v1/cookbooks/chef-dk":
+				fmt.Fprint(w, cjsonified())
+			case "/api/v1/cookbooks/chef-dk/versions/2.0.0":
+				fmt.Fprint(w, cvjsonified())
+			}
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		if verifySignature(&signerKey(t).PublicKey, r) != nil {
+			w.WriteHeader(401)
+			fmt.Fprint(w, `{"error_code": "UNAUTHORIZED", "error_messages": ["Bad signature"]}`)
+			return
+		}
+		if r.Header.Get("X-Ops-Userid") != "roboticcheese" {
+			w.WriteHeader(403)
+			fmt.Fprint(w, `{"error_code": "FORBIDDEN", "error_messages": ["You are not authorized to perform this action"]}`)
+			return
+		}
+		if deleted[r.URL.Path] {
+			w.WriteHeader(404)
+			fmt.Fprint(w, `{"error_code": "NOT_FOUND", "error_messages": ["Resource does not exist"]}`)
+			return
+		}
+		switch r.Method + " " + r.URL.Path {
+		case "PUT /api/v1/cookbooks/chef-dk/deprecate":
+			params := map[string]string{}
+			json.Unmarshal(body, &params)
+			if params["replacement"] == "nope" {
+				w.WriteHeader(400)
+				fmt.Fprint(w, `{"error_code": "INVALID_DATA", "error_messages": ["Replacement cookbook does not exist"]}`)
+				return
+			}
+			replacement := "null"
+			if params["replacement"] != "" {
+				replacement = `"` + ts.URL + "/api/v1/cookbooks/" + params["replacement"] + `"`
+			}
+			res := strings.Replace(cjsonified(), `"deprecated": false`, `"deprecated": true`, 1)
+			fmt.Fprint(w, strings.TrimSuffix(res, "}")+`, "replacement": `+replacement+"}")
+		case "DELETE /api/v1/cookbooks/chef-dk/deprecate":
+			fmt.Fprint(w, cjsonified())
+		case "DELETE /api/v1/cookbooks/chef-dk":
+			deleted[r.URL.Path] = true
+			fmt.Fprint(w, `{"uri": "`+cookbook+`"}`)
+		case "DELETE /api/v1/cookbooks/chef-dk/versions/2.0.0":
+			deleted[r.URL.Path] = true
+			fmt.Fprint(w, `{"uri": "`+cookbook+`/versions/2.0.0"}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}, nil)
+	return
+}
+
+// maintainerAPIInstance returns an APIInstance for a Supermarket that signs
+// for a user.
+func maintainerAPIInstance(t *testing.T, ts *httptest.Server, user string) (i *APIInstance) {
+	i = new(APIInstance)
+	i.Endpoint = ts.URL + "/api/v1"
+	i.Signer, _ = NewSigner(user, pkcs1PEM(t), "")
+	return
+}
+
+func TestCookbookDeprecate(t *testing.T) {
+	ts := startMaintainerServer(t)
+	defer ts.Close()
+	c, _ := NewCookbook(maintainerAPIInstance(t, ts, "roboticcheese"), "chef-dk")
+
+	res, err := c.Deprecate(context.Background(), "chef-workstation")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	bare, err := c.Deprecate(context.Background(), "")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	undep, err := res.Undeprecate(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	for _, i := range [][]interface{}{
+		{res.Endpoint, c.Endpoint},
+		{res.Name, "chef-dk"},
+		{res.Deprecated, true},
+		{res.Replacement, ts.URL + "/api/v1/cookbooks/chef-workstation"},
+		{bare.Deprecated, true},
+		{bare.Replacement, ""},
+		{undep.Deprecated, false},
+		{undep.Replacement, ""},
+		{c.Deprecated, false},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+
+	res, err = c.Deprecate(context.Background(), "nope")
+	if _, ok := err.(*ValidationError); !ok || res != nil {
+		t.Fatalf("Expected a ValidationError, got: %v", err)
+	}
+}
+
+func TestCookbookDelete(t *testing.T) {
+	ts := startMaintainerServer(t)
+	defer ts.Close()
+	c, _ := NewCookbook(maintainerAPIInstance(t, ts, "roboticcheese"), "chef-dk")
+
+	err := c.Delete(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	err = c.Delete(context.Background())
+	aerr, ok := err.(*APIError)
+	if !ok || aerr.StatusCode != 404 || aerr.Code != "NOT_FOUND" {
+		t.Fatalf("Expected a 404 APIError, got: %v", err)
+	}
+}
+
+func TestCookbookCopiesDelete(t *testing.T) {
+	ts := startMaintainerServer(t)
+	defer ts.Close()
+	c, _ := NewCookbook(maintainerAPIInstance(t, ts, "roboticcheese"), "chef-dk")
+	patched, err := c.ApplyJSONPatch(common.Patch{})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	for _, res := range []*Cookbook{c.Clone(), c.Apply(nil, nil), patched} {
+		if res.api != c.api {
+			t.Fatalf("Expected: %v, got: %v", c.api, res.api)
+		}
+	}
+	err = c.Clone().Delete(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+}
+
+func TestCookbookMaintainerErrors(t *testing.T) {
+	ts := startMaintainerServer(t)
+	defer ts.Close()
+
+	c, _ := NewCookbook(maintainerAPIInstance(t, ts, "someoneelse"), "chef-dk")
+	_, err := c.Undeprecate(context.Background())
+	aerr, ok := err.(*APIError)
+	if !ok || aerr.StatusCode != 403 {
+		t.Fatalf("Expected a 403 APIError, got: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = c.Deprecate(ctx, "")
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected: %v, got: %v", context.Canceled, err)
+	}
+
+	c.api.Signer = nil
+	_, err = c.Deprecate(context.Background(), "")
+	if err != ErrNoSigner {
+		t.Fatalf("Expected: %v, got: %v", ErrNoSigner, err)
+	}
+	err = InitCookbook().Delete(context.Background())
+	if err != ErrNoAPIInstance {
+		t.Fatalf("Expected: %v, got: %v", ErrNoAPIInstance, err)
+	}
+}
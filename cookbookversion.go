@@ -37,9 +37,9 @@ https://supermarket.chef.io/api/v1/cookbooks/chef-dk/versions/2.0.0 =>
 package goulash
 
 import (
+	"context"
 	"encoding/json"
 	"io"
-	"net/http"
 
 	"github.com/RoboticCheese/goulash/common"
 )
@@ -54,24 +54,45 @@ type CookbookVersion struct {
 	Cookbook        string            `json:"cookbook"`
 	File            string            `json:"file"`
 	Dependencies    map[string]string `json:"dependencies"`
+	api             *APIInstance
 }
 
+var _ common.Supermarketer[*CookbookVersion] = (*CookbookVersion)(nil)
+
 // NewCookbookVersion initializes and returns a new CookbookVersion struct
-// based on a Cookbook.
+// based on a Cookbook. From a Chef Server, the tarball size, rating, and file
+// aren't filled in.
 func NewCookbookVersion(cb *Cookbook, v string) (cv *CookbookVersion, err error) {
+	cv, err = newCookbookVersion(context.Background(), cb, v)
+	return
+}
+
+// newCookbookVersion fetches a CookbookVersion as NewCookbookVersion does,
+// with a Context for its requests.
+func newCookbookVersion(ctx context.Context, cb *Cookbook, v string) (cv *CookbookVersion, err error) {
 	cv = InitCookbookVersion()
+	cv.api = cb.api
+	chefServer := cb.api != nil && cb.api.ChefServer
 	cv.Endpoint = cb.Endpoint + "/versions/" + v
-	cv.Component, err = NewComponent(cv.Endpoint)
+	if chefServer {
+		cv.Endpoint = cb.Endpoint + "/" + v
+	}
+	cv.Component, err = newComponent(ctx, cb.api, cv.Endpoint)
 	if err != nil {
 		return
 	}
 
-	resp, err := http.Get(cv.Endpoint)
+	resp, err := cb.api.get(ctx, cv.Endpoint)
 	if err != nil {
 		return
 	}
 	defer resp.Body.Close()
 
+	if chefServer {
+		err = cv.decodeChefServerJSON(resp.Body)
+		cv.Cookbook = cb.Endpoint
+		return
+	}
 	err = cv.decodeJSON(resp.Body)
 	return
 }
@@ -91,32 +112,104 @@ func (cv *CookbookVersion) Empty() (empty bool) {
 }
 
 // Equals implements an equality test for a CookbookVersion.
-func (cv *CookbookVersion) Equals(cv2 common.Supermarketer) (res bool) {
-	res = common.Equals(cv, cv2)
+func (cv *CookbookVersion) Equals(cv2 *CookbookVersion, opts ...common.Option) (res bool) {
+	res = common.Equals(cv, cv2, opts...)
 	return
 }
 
 // Diff returns any attributes added/changed/removed from one CookbookVersion
 // struct to another, represented by a positive and negative diff
 // CookbookVersion.
-func (cv *CookbookVersion) Diff(cv2 *CookbookVersion) (pos, neg *CookbookVersion) {
-	ipos, ineg := common.Diff(cv, cv2, &CookbookVersion{}, &CookbookVersion{})
-	if ipos != nil {
-		pos = ipos.(*CookbookVersion)
-	} else {
-		pos = nil
-	}
-	if ineg != nil {
-		neg = ineg.(*CookbookVersion)
-	} else {
-		neg = nil
+func (cv *CookbookVersion) Diff(cv2 *CookbookVersion, opts ...common.Option) (pos, neg *CookbookVersion) {
+	pos, neg = common.TypedDiff(cv, cv2, opts...)
+	return
+}
+
+// Clone returns a deep copy of a CookbookVersion struct, made through the same
+// APIInstance.
+func (cv *CookbookVersion) Clone() (res *CookbookVersion) {
+	res = common.Clone(cv)
+	res.keepAPI(cv)
+	return
+}
+
+// Apply returns a new CookbookVersion struct with a positive and negative
+// diff, as returned by Diff, applied to it. Either diff may be nil.
+func (cv *CookbookVersion) Apply(pos, neg *CookbookVersion) (res *CookbookVersion) {
+	res = common.TypedApply(cv, pos, neg)
+	res.keepAPI(cv)
+	return
+}
+
+// Changes returns a flat list of every change from one CookbookVersion struct
+// to another.
+func (cv *CookbookVersion) Changes(cv2 *CookbookVersion, opts ...common.Option) (changes []common.Change) {
+	changes = common.Changes(cv, cv2, opts...)
+	return
+}
+
+// JSONPatch returns an RFC 6902 JSON Patch from one CookbookVersion struct to
+// another.
+func (cv *CookbookVersion) JSONPatch(cv2 *CookbookVersion) (p common.Patch, err error) {
+	p, err = common.JSONPatch(cv, cv2)
+	return
+}
+
+// ApplyJSONPatch applies an RFC 6902 JSON Patch to a CookbookVersion struct
+// and returns the result as a new CookbookVersion.
+func (cv *CookbookVersion) ApplyJSONPatch(p common.Patch) (res *CookbookVersion, err error) {
+	ires, err := common.ApplyJSONPatch(cv, p, &CookbookVersion{})
+	if err != nil {
+		return
 	}
+	res = ires.(*CookbookVersion)
+	res.keepAPI(cv)
 	return
 }
 
+// keepAPI makes a CookbookVersion derived from another one use the same
+// APIInstance, which the common functions don't copy.
+func (cv *CookbookVersion) keepAPI(from *CookbookVersion) {
+	if cv != nil && from != nil {
+		cv.api = from.api
+	}
+}
+
 // decodeJSON accepts an IO reader and a CookbookVersion struct and populates
 // that struct with the JSON data.
 func (cv *CookbookVersion) decodeJSON(r io.Reader) (err error) {
 	decoder := json.NewDecoder(r)
 	return decoder.Decode(cv)
 }
+
+// chefServerCookbookVersion is the part of a Chef Server cookbook version
+// manifest that a CookbookVersion holds.
+type chefServerCookbookVersion struct {
+	Version  string `json:"version"`
+	Metadata struct {
+		License      string            `json:"license"`
+		Dependencies map[string]string `json:"dependencies"`
+	} `json:"metadata"`
+}
+
+// decodeChefServerJSON accepts an IO reader and populates a CookbookVersion
+// struct with the data from a Chef Server cookbook version manifest.
+func (cv *CookbookVersion) decodeChefServerJSON(r io.Reader) (err error) {
+	data := chefServerCookbookVersion{}
+	err = json.NewDecoder(r).Decode(&data)
+	if err != nil {
+		return
+	}
+	cv.Version = data.Version
+	cv.License = data.Metadata.License
+	if data.Metadata.Dependencies != nil {
+		cv.Dependencies = data.Metadata.Dependencies
+	}
+	return
+}
+
+// Delete removes a single version of a cookbook from the Supermarket.
+func (cv *CookbookVersion) Delete(ctx context.Context) (err error) {
+	err = cv.api.call(ctx, "DELETE", cv.Endpoint, nil, nil)
+	return
+}
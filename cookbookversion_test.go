@@ -1,8 +1,11 @@
 package goulash
 
 import (
+	"context"
 	"net/http"
 	"testing"
+
+	"github.com/RoboticCheese/goulash/common"
 )
 
 func cvdata() (data CookbookVersion) {
@@ -337,3 +340,138 @@ func TestCookbookVersionDiffDataAddedAndDeleted(t *testing.T) {
 		}
 	}
 }
+
+func TestCookbookVersionChanges(t *testing.T) {
+	data1 := cvdata()
+	data2 := cvdata()
+	data2.ETag = "abc"
+	data2.Dependencies["thing2"] = "~> 1.0"
+	res := data1.Changes(&data2)
+	for _, i := range [][]interface{}{
+		{len(res), 2},
+		{res[0].Path, "Component.ETag"},
+		{res[0].Kind, common.Modified},
+		{res[0].Old, ""},
+		{res[0].New, "abc"},
+		{res[1].Path, `Dependencies["thing2"]`},
+		{res[1].Kind, common.Added},
+		{res[1].New, "~> 1.0"},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+}
+
+func TestCookbookVersionJSONPatchRoundTrip(t *testing.T) {
+	data1 := cvdata()
+	data2 := cvdata()
+	data2.License = "Apache v2.0"
+	data2.TarballFileSize = 5913
+	data2.Dependencies = map[string]string{"thing2": "~> 1.0"}
+	for _, i := range [][]*CookbookVersion{{&data1, &data2}, {&data2, &data1}} {
+		p, err := i[0].JSONPatch(i[1])
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		res, err := i[0].ApplyJSONPatch(p)
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		if !res.Equals(i[1]) {
+			t.Fatalf("Expected %v, got: %v", i[1], res)
+		}
+	}
+}
+
+func TestCookbookVersionApplyJSONPatchError(t *testing.T) {
+	data := cvdata()
+	_, err := data.ApplyJSONPatch(common.Patch{{Op: "remove", Path: "/nope"}})
+	if err == nil {
+		t.Fatalf("Expected an error but didn't get one")
+	}
+}
+
+func TestCookbookVersionApply(t *testing.T) {
+	data1 := cvdata()
+	data2 := cvdata()
+	data2.License = ""
+	data2.File = "otherfile"
+	data2.Dependencies["thing2"] = "~> 1.0"
+	for _, i := range [][]*CookbookVersion{{&data1, &data2}, {&data2, &data1}, {&data1, &data1}} {
+		pos, neg := i[0].Diff(i[1])
+		res := i[0].Apply(pos, neg)
+		if !res.Equals(i[1]) {
+			t.Fatalf("Expected %v, got: %v", i[1], res)
+		}
+	}
+}
+
+func TestCookbookVersionClone(t *testing.T) {
+	data := cvdata()
+	res := data.Clone()
+	res.Dependencies["thing1"] = "= 1.0"
+	res.Endpoint = "https://example2.com"
+	for _, i := range [][]interface{}{
+		{data.Dependencies["thing1"], ">= 0.0.0"},
+		{data.Endpoint, "https://example1.com"},
+		{data.Clone().Equals(&data), true},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+}
+
+func TestCookbookVersionDiffDoesNotAlias(t *testing.T) {
+	data1 := cvdata()
+	data1.Dependencies = map[string]string{}
+	data2 := cvdata()
+	pos, _ := data1.Diff(&data2)
+	pos.Dependencies["thing1"] = "= 1.0"
+	if data2.Dependencies["thing1"] != ">= 0.0.0" {
+		t.Fatalf("Expected the original to be unmodified, got: %v", data2.Dependencies)
+	}
+}
+
+func TestCookbookVersionCopiesDelete(t *testing.T) {
+	ts := startMaintainerServer(t)
+	defer ts.Close()
+	c, _ := NewCookbook(maintainerAPIInstance(t, ts, "roboticcheese"), "chef-dk")
+	cv, _ := NewCookbookVersion(c, "2.0.0")
+	patched, err := cv.ApplyJSONPatch(common.Patch{})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	for _, res := range []*CookbookVersion{cv.Clone(), cv.Apply(nil, nil), patched} {
+		if res.api != cv.api {
+			t.Fatalf("Expected: %v, got: %v", cv.api, res.api)
+		}
+	}
+	err = cv.Clone().Delete(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+}
+
+func TestCookbookVersionDelete(t *testing.T) {
+	ts := startMaintainerServer(t)
+	defer ts.Close()
+	c, _ := NewCookbook(maintainerAPIInstance(t, ts, "roboticcheese"), "chef-dk")
+	cv, _ := NewCookbookVersion(c, "2.0.0")
+
+	err := cv.Delete(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	err = cv.Delete(context.Background())
+	aerr, ok := err.(*APIError)
+	if !ok || aerr.StatusCode != 404 {
+		t.Fatalf("Expected a 404 APIError, got: %v", err)
+	}
+	err = InitCookbookVersion().Delete(context.Background())
+	if err != ErrNoAPIInstance {
+		t.Fatalf("Expected: %v, got: %v", ErrNoAPIInstance, err)
+	}
+}
@@ -0,0 +1,415 @@
+// Author:: Jonathan Hartman (<j@p4nt5.com>)
+//
+// Copyright (C) 2014, Jonathan Hartman
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package goulashtest implements an in-memory Supermarket for testing code that
+uses goulash without the network.
+
+A Server is seeded with Cookbook and CookbookVersion fixtures and serves them
+the way the real API does, e.g.
+
+	s := goulashtest.NewServer()
+	defer s.Close()
+	s.AddCookbook(&goulash.Cookbook{Name: "chef-dk", Maintainer: "roboticcheese"},
+		&goulash.CookbookVersion{Version: "2.0.1", License: "Apache v2.0"})
+	i, err := goulash.NewAPIInstance(s.URL)
+
+It serves:
+
+	/status
+	/universe
+	/api/v1/cookbooks
+	/api/v1/cookbooks/:name
+	/api/v1/cookbooks/:name/versions/:version
+	/api/v1/cookbooks/:name/versions/:version/download
+
+Every response carries an ETag and a matching If-None-Match gets a 304. Faults
+can be injected to slow down or fail requests.
+*/
+package goulashtest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/RoboticCheese/goulash"
+	"github.com/RoboticCheese/goulash/internal/apiserve"
+	"github.com/RoboticCheese/goulash/universe"
+)
+
+// Fault implements a failure to inject into requests to a Server.
+type Fault struct {
+	Path    string        // A path prefix to match; empty matches every request
+	Status  int           // A status to respond with instead, e.g. 404 or 500
+	Latency time.Duration // How long to wait before responding
+	Times   int           // How many requests to affect; 0 means all of them
+}
+
+// Server implements a fake Supermarket API server.
+type Server struct {
+	*httptest.Server
+	lock      sync.Mutex
+	cookbooks map[string]*goulash.Cookbook
+	versions  map[string]map[string]*goulash.CookbookVersion
+	tarballs  map[string][]byte
+	faults    []*Fault
+	requests  int
+}
+
+// apiCookbook is a Cookbook as the API encodes it.
+type apiCookbook struct {
+	Name              string          `json:"name"`
+	Maintainer        string          `json:"maintainer"`
+	Description       string          `json:"description"`
+	Category          string          `json:"category"`
+	LatestVersion     string          `json:"latest_version"`
+	ExternalURL       string          `json:"external_url"`
+	AverageRating     int             `json:"average_rating"`
+	CreatedAt         string          `json:"created_at"`
+	UpdatedAt         string          `json:"updated_at"`
+	Deprecated        bool            `json:"deprecated"`
+	Replacement       string          `json:"replacement"`
+	FoodcriticFailure bool            `json:"foodcritic_failure"`
+	Versions          []string        `json:"versions"`
+	Metrics           goulash.Metrics `json:"metrics"`
+}
+
+// apiCookbookVersion is a CookbookVersion as the API encodes it.
+type apiCookbookVersion struct {
+	License         string            `json:"license"`
+	TarballFileSize int               `json:"tarball_file_size"`
+	Version         string            `json:"version"`
+	AverageRating   int               `json:"average_rating"`
+	Cookbook        string            `json:"cookbook"`
+	File            string            `json:"file"`
+	Dependencies    map[string]string `json:"dependencies"`
+}
+
+// NewServer starts and returns a new Server with no cookbooks. It should be
+// closed when it's no longer needed.
+func NewServer() (s *Server) {
+	s = new(Server)
+	s.cookbooks = map[string]*goulash.Cookbook{}
+	s.versions = map[string]map[string]*goulash.CookbookVersion{}
+	s.tarballs = map[string][]byte{}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return
+}
+
+// APIInstance returns a new APIInstance connected to the Server.
+func (s *Server) APIInstance() (i *goulash.APIInstance, err error) {
+	i, err = goulash.NewAPIInstance(s.URL)
+	return
+}
+
+// AddCookbook seeds the Server with a Cookbook fixture and any versions of
+// it, replacing a cookbook of the same name. If the fixture has no Versions
+// or LatestVersion, they're filled in from the versions given.
+func (s *Server) AddCookbook(c *goulash.Cookbook, versions ...*goulash.CookbookVersion) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.cookbooks[c.Name] = c.Clone()
+	s.versions[c.Name] = map[string]*goulash.CookbookVersion{}
+	for _, cv := range versions {
+		s.versions[c.Name][cv.Version] = cv.Clone()
+	}
+}
+
+// AddCookbookVersion seeds the Server with a CookbookVersion fixture for an
+// already added cookbook, replacing a version of the same number. If the
+// fixture has no Cookbook or File URLs, they're filled in with the Server's.
+func (s *Server) AddCookbookVersion(name string, cv *goulash.CookbookVersion) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.cookbooks[name] == nil {
+		s.cookbooks[name] = goulash.InitCookbook()
+		s.cookbooks[name].Name = name
+		s.versions[name] = map[string]*goulash.CookbookVersion{}
+	}
+	s.versions[name][cv.Version] = cv.Clone()
+}
+
+// RemoveCookbook removes a cookbook and all its versions from the Server.
+func (s *Server) RemoveCookbook(name string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.cookbooks, name)
+	delete(s.versions, name)
+}
+
+// RemoveCookbookVersion removes a single version of a cookbook from the
+// Server.
+func (s *Server) RemoveCookbookVersion(name, version string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.versions[name], version)
+}
+
+// AddTarball seeds the Server with the tarball to serve as a cookbook
+// version's download.
+func (s *Server) AddTarball(name, version string, data []byte) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.tarballs[name+"/"+version] = append([]byte(nil), data...)
+}
+
+// Inject adds a Fault to the Server. When several match a request, the
+// first one added is used.
+func (s *Server) Inject(f Fault) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.faults = append(s.faults, &f)
+}
+
+// ClearFaults removes every Fault from the Server.
+func (s *Server) ClearFaults() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.faults = nil
+}
+
+// Requests returns the number of requests the Server has received.
+func (s *Server) Requests() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.requests
+}
+
+// serveHTTP routes a request to the right endpoint, after applying any
+// matching Fault.
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	s.requests++
+	f := s.fault(r.URL.Path)
+	s.lock.Unlock()
+
+	if f.Latency > 0 {
+		select {
+		case <-time.After(f.Latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if f.Status != 0 {
+		http.Error(w, http.StatusText(f.Status), f.Status)
+		return
+	}
+
+	s.lock.Lock()
+	body, found := s.route(r)
+	s.lock.Unlock()
+	if !found {
+		http.NotFound(w, r)
+		return
+	}
+	contentType := "application/json"
+	data, raw := body.([]byte)
+	if raw {
+		contentType = "application/x-gzip"
+	} else {
+		var err error
+		data, err = json.Marshal(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	apiserve.Write(w, r, data, contentType)
+}
+
+// fault returns the first Fault matching a path, or an empty one. It counts
+// the request against the Fault and removes it once it's used up. It must be
+// called with the lock held.
+func (s *Server) fault(path string) (f Fault) {
+	for i, cur := range s.faults {
+		if !strings.HasPrefix(path, cur.Path) {
+			continue
+		}
+		f = *cur
+		if cur.Times > 0 {
+			cur.Times--
+			if cur.Times == 0 {
+				s.faults = append(s.faults[:i:i], s.faults[i+1:]...)
+			}
+		}
+		return
+	}
+	return
+}
+
+// route returns the data for a request's endpoint and whether it exists.
+// Tarballs are returned as bytes and everything else as data to encode as
+// JSON. It must be called with the lock held.
+func (s *Server) route(r *http.Request) (body interface{}, found bool) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		return
+	}
+	path := strings.TrimSuffix(r.URL.Path, "/")
+	switch {
+	case path == "":
+		body, found = map[string]string{}, true
+	case path == "/status":
+		body, found = map[string]string{"status": "ok"}, true
+	case path == "/universe":
+		body, found = s.universe(), true
+	case path == "/api/v1/cookbooks":
+		body, found = s.list(r), true
+	case strings.HasPrefix(path, "/api/v1/cookbooks/"):
+		parts := strings.Split(strings.TrimPrefix(path, "/api/v1/cookbooks/"), "/")
+		switch {
+		case len(parts) == 1:
+			body, found = s.cookbook(parts[0])
+		case len(parts) == 3 && parts[1] == "versions":
+			body, found = s.cookbookVersion(parts[0], parts[2])
+		case len(parts) == 4 && parts[1] == "versions" && parts[3] == "download":
+			body, found = s.tarballs[parts[0]+"/"+parts[2]]
+		}
+	}
+	return
+}
+
+// cookbookURL returns the Server's API URL for a cookbook.
+func (s *Server) cookbookURL(name string) string {
+	return s.URL + "/api/v1/cookbooks/" + name
+}
+
+// versionURL returns the Server's API URL for a cookbook version.
+func (s *Server) versionURL(name, version string) string {
+	return s.cookbookURL(name) + "/versions/" + version
+}
+
+// sortedVersions returns the version numbers of a cookbook, newest first.
+func (s *Server) sortedVersions(name string) (res []string) {
+	for v := range s.versions[name] {
+		res = append(res, v)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return universe.CompareVersions(res[i], res[j]) > 0
+	})
+	return
+}
+
+// universe returns the universe endpoint's data for every seeded version.
+func (s *Server) universe() (res map[string]*universe.Cookbook) {
+	res = map[string]*universe.Cookbook{}
+	for name, versions := range s.versions {
+		c := universe.NewCookbook()
+		c.Name = name
+		for v, cv := range versions {
+			ucv := universe.NewCookbookVersion()
+			ucv.Version = v
+			ucv.LocationType = "opscode"
+			ucv.LocationPath = s.URL + "/api/v1"
+			ucv.DownloadURL = s.versionURL(name, v) + "/download"
+			for dep, constraint := range cv.Dependencies {
+				ucv.Dependencies[dep] = constraint
+			}
+			c.Versions[v] = ucv
+		}
+		res[name] = c
+	}
+	return
+}
+
+// list returns a page of the cookbook list, sorted by name, honoring the
+// start and items query parameters.
+func (s *Server) list(r *http.Request) (res apiserve.List) {
+	names := []string{}
+	for name := range s.cookbooks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	res = apiserve.Page(r, names, func(name string) apiserve.ListItem {
+		c := s.cookbooks[name]
+		return apiserve.ListItem{
+			Name:        c.Name,
+			Maintainer:  c.Maintainer,
+			Description: c.Description,
+			Cookbook:    s.cookbookURL(name),
+		}
+	})
+	return
+}
+
+// cookbook returns the data for a single cookbook and whether it exists.
+func (s *Server) cookbook(name string) (res *apiCookbook, found bool) {
+	c := s.cookbooks[name]
+	if c == nil {
+		return
+	}
+	found = true
+	res = &apiCookbook{
+		Name:              c.Name,
+		Maintainer:        c.Maintainer,
+		Description:       c.Description,
+		Category:          c.Category,
+		LatestVersion:     c.LatestVersion,
+		ExternalURL:       c.ExternalURL,
+		AverageRating:     c.AverageRating,
+		CreatedAt:         c.CreatedAt,
+		UpdatedAt:         c.UpdatedAt,
+		Deprecated:        c.Deprecated,
+		Replacement:       c.Replacement,
+		FoodcriticFailure: c.FoodcriticFailure,
+		Versions:          c.Versions,
+		Metrics:           c.Metrics,
+	}
+	if len(res.Versions) == 0 {
+		res.Versions = []string{}
+		for _, v := range s.sortedVersions(name) {
+			res.Versions = append(res.Versions, s.versionURL(name, v))
+		}
+	}
+	if res.LatestVersion == "" && len(res.Versions) > 0 {
+		res.LatestVersion = res.Versions[0]
+	}
+	return
+}
+
+// cookbookVersion returns the data for a single cookbook version and whether
+// it exists.
+func (s *Server) cookbookVersion(name, version string) (res *apiCookbookVersion, found bool) {
+	cv := s.versions[name][version]
+	if cv == nil {
+		return
+	}
+	found = true
+	res = &apiCookbookVersion{
+		License:         cv.License,
+		TarballFileSize: cv.TarballFileSize,
+		Version:         cv.Version,
+		AverageRating:   cv.AverageRating,
+		Cookbook:        cv.Cookbook,
+		File:            cv.File,
+		Dependencies:    cv.Dependencies,
+	}
+	if res.Cookbook == "" {
+		res.Cookbook = s.cookbookURL(name)
+	}
+	if res.File == "" {
+		res.File = s.versionURL(name, version) + "/download"
+	}
+	if res.Dependencies == nil {
+		res.Dependencies = map[string]string{}
+	}
+	return
+}
@@ -0,0 +1,296 @@
+package goulashtest
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/RoboticCheese/goulash"
+	"github.com/RoboticCheese/goulash/internal/apiserve"
+)
+
+func seeded() (s *Server) {
+	s = NewServer()
+	s.AddCookbook(&goulash.Cookbook{
+		Name:       "chef-dk",
+		Maintainer: "roboticcheese",
+		Category:   "Other",
+	}, &goulash.CookbookVersion{
+		Version:      "2.0.0",
+		License:      "Apache v2.0",
+		Dependencies: map[string]string{"dmg": "~> 2.2"},
+	}, &goulash.CookbookVersion{
+		Version: "10.0.0",
+		License: "Apache v2.0",
+	})
+	s.AddCookbookVersion("dmg", &goulash.CookbookVersion{Version: "2.2.0"})
+	return
+}
+
+func TestServerCookbook(t *testing.T) {
+	s := seeded()
+	defer s.Close()
+
+	i, err := s.APIInstance()
+	if err != nil {
+		t.Fatalf("Expected: nil, got: %v", err)
+	}
+	c, err := goulash.NewCookbook(i, "chef-dk")
+	if err != nil {
+		t.Fatalf("Expected: nil, got: %v", err)
+	}
+	for _, i := range [][]interface{}{
+		{c.Name, "chef-dk"},
+		{c.Maintainer, "roboticcheese"},
+		{c.Category, "Other"},
+		{c.LatestVersion, s.URL + "/api/v1/cookbooks/chef-dk/versions/10.0.0"},
+		{len(c.Versions), 2},
+		{c.Versions[1], s.URL + "/api/v1/cookbooks/chef-dk/versions/2.0.0"},
+		{c.ETag != "", true},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+
+	cv, err := goulash.NewCookbookVersion(c, "2.0.0")
+	if err != nil {
+		t.Fatalf("Expected: nil, got: %v", err)
+	}
+	for _, i := range [][]interface{}{
+		{cv.Version, "2.0.0"},
+		{cv.License, "Apache v2.0"},
+		{cv.Cookbook, s.URL + "/api/v1/cookbooks/chef-dk"},
+		{cv.File, s.URL + "/api/v1/cookbooks/chef-dk/versions/2.0.0/download"},
+		{cv.Dependencies["dmg"], "~> 2.2"},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+}
+
+func TestServerUniverse(t *testing.T) {
+	s := seeded()
+	defer s.Close()
+
+	i, _ := s.APIInstance()
+	u, err := goulash.NewUniverse(i)
+	if err != nil {
+		t.Fatalf("Expected: nil, got: %v", err)
+	}
+	cv := u.Cookbook("chef-dk").Versions["2.0.0"]
+	for _, i := range [][]interface{}{
+		{u.Len(), 2},
+		{len(u.Cookbook("chef-dk").Versions), 2},
+		{cv.LocationType, "opscode"},
+		{cv.LocationPath, s.URL + "/api/v1"},
+		{cv.DownloadURL, s.URL + "/api/v1/cookbooks/chef-dk/versions/2.0.0/download"},
+		{cv.Dependencies["dmg"], "~> 2.2"},
+		{u.Cookbook("dmg").Versions["2.2.0"] != nil, true},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+
+	s.AddCookbookVersion("dmg", &goulash.CookbookVersion{Version: "2.3.0"})
+	s.RemoveCookbook("chef-dk")
+	pos, neg, err := u.Update()
+	if err != nil {
+		t.Fatalf("Expected: nil, got: %v", err)
+	}
+	for _, i := range [][]interface{}{
+		{pos.Cookbook("dmg").Versions["2.3.0"] != nil, true},
+		{neg.Cookbook("chef-dk") != nil, true},
+		{u.Len(), 1},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+}
+
+func TestServerUniverseUnchanged(t *testing.T) {
+	s := seeded()
+	defer s.Close()
+
+	i, _ := s.APIInstance()
+	u, _ := goulash.NewUniverse(i)
+	before := s.Requests()
+	pos, neg, err := u.Update()
+	if err != nil {
+		t.Fatalf("Expected: nil, got: %v", err)
+	}
+	for _, i := range [][]interface{}{
+		{pos == nil, true},
+		{neg == nil, true},
+		// Just the HEAD for the ETag; the universe isn't downloaded again
+		{s.Requests() - before, 1},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+}
+
+func TestServerETag(t *testing.T) {
+	s := seeded()
+	defer s.Close()
+
+	resp, err := http.Get(s.URL + "/universe")
+	if err != nil {
+		t.Fatalf("Expected: nil, got: %v", err)
+	}
+	resp.Body.Close()
+	etag := resp.Header.Get("ETag")
+
+	req, _ := http.NewRequest("GET", s.URL+"/universe", nil)
+	req.Header.Set("If-None-Match", etag)
+	resp2, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Expected: nil, got: %v", err)
+	}
+	resp2.Body.Close()
+
+	s.AddCookbookVersion("dmg", &goulash.CookbookVersion{Version: "2.3.0"})
+	resp3, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Expected: nil, got: %v", err)
+	}
+	resp3.Body.Close()
+	for _, i := range [][]interface{}{
+		{etag != "", true},
+		{resp2.StatusCode, http.StatusNotModified},
+		{resp3.StatusCode, http.StatusOK},
+		{resp3.Header.Get("ETag") != etag, true},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+}
+
+func TestServerTarball(t *testing.T) {
+	s := seeded()
+	defer s.Close()
+	s.AddTarball("chef-dk", "2.0.0", []byte("tarball"))
+
+	resp, err := http.Get(s.URL + "/api/v1/cookbooks/chef-dk/versions/2.0.0/download")
+	if err != nil {
+		t.Fatalf("Expected: nil, got: %v", err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	for _, i := range [][]interface{}{
+		{resp.StatusCode, http.StatusOK},
+		{string(data), "tarball"},
+		{resp.Header.Get("Content-Type"), "application/x-gzip"},
+		{status(s, "/api/v1/cookbooks/chef-dk/versions/10.0.0/download"), http.StatusNotFound},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+}
+
+func TestServerList(t *testing.T) {
+	s := seeded()
+	defer s.Close()
+
+	resp, err := http.Get(s.URL + "/api/v1/cookbooks?start=1&items=5")
+	if err != nil {
+		t.Fatalf("Expected: nil, got: %v", err)
+	}
+	defer resp.Body.Close()
+	var res apiserve.List
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		t.Fatalf("Expected: nil, got: %v", err)
+	}
+	for _, i := range [][]interface{}{
+		{res.Start, 1},
+		{res.Total, 2},
+		{len(res.Items), 1},
+		{res.Items[0].Name, "dmg"},
+		{res.Items[0].Cookbook, s.URL + "/api/v1/cookbooks/dmg"},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+}
+
+func TestServerNotFound(t *testing.T) {
+	s := seeded()
+	defer s.Close()
+
+	i, _ := s.APIInstance()
+	for _, path := range []string{
+		"/api/v1/cookbooks/nope",
+		"/api/v1/cookbooks/chef-dk/versions/9.9.9",
+		"/api/v1/cookbooks/chef-dk/nope",
+		"/nope",
+	} {
+		resp, err := http.Get(s.URL + path)
+		if err != nil {
+			t.Fatalf("Expected: nil, got: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Fatalf("Expected: %v, got: %v", http.StatusNotFound, resp.StatusCode)
+		}
+	}
+	_, err := goulash.NewCookbook(i, "nope")
+	if err == nil {
+		t.Fatalf("Expected: an error, got: %v", err)
+	}
+}
+
+func TestServerFaults(t *testing.T) {
+	s := seeded()
+	defer s.Close()
+
+	s.Inject(Fault{Path: "/status", Status: http.StatusServiceUnavailable, Times: 1})
+	_, err := s.APIInstance()
+	if err == nil {
+		t.Fatalf("Expected: an error, got: %v", err)
+	}
+	_, err = s.APIInstance()
+	if err != nil {
+		t.Fatalf("Expected: nil, got: %v", err)
+	}
+
+	s.Inject(Fault{Path: "/api/v1/cookbooks/dmg", Status: http.StatusNotFound})
+	for _, i := range [][]interface{}{
+		{status(s, "/api/v1/cookbooks/dmg"), http.StatusNotFound},
+		{status(s, "/api/v1/cookbooks/dmg"), http.StatusNotFound},
+		{status(s, "/api/v1/cookbooks/chef-dk"), http.StatusOK},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+	s.ClearFaults()
+	if res := status(s, "/api/v1/cookbooks/dmg"); res != http.StatusOK {
+		t.Fatalf("Expected: %v, got: %v", http.StatusOK, res)
+	}
+
+	s.Inject(Fault{Latency: 50 * time.Millisecond})
+	start := time.Now()
+	status(s, "/status")
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Fatalf("Expected: at least %v, got: %v", 50*time.Millisecond, elapsed)
+	}
+}
+
+func status(s *Server, path string) int {
+	resp, err := http.Get(s.URL + path)
+	if err != nil {
+		return 0
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
@@ -0,0 +1,346 @@
+// Author:: Jonathan Hartman (<j@p4nt5.com>)
+//
+// Copyright (C) 2014, Jonathan Hartman
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package history implements an archive of a Universe over time.
+
+A Store keeps a directory holding a base snapshot of the first Universe
+recorded and a log with one entry per recorded change, each a JSON Patch from
+the previous state to the new one, e.g.
+
+	archive/base.json.gz
+	archive/log.jsonl =>
+
+	{"time":"2014-09-20T04:46:00Z","patch":[]}
+	{"time":"2014-09-21T04:46:00Z","patch":[{"op":"add","path":"/chef/0.21.0","value":{...}}]}
+
+Replaying the log on top of the base answers questions like what the universe
+looked like on a given date, or when each version of a cookbook appeared.
+*/
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/RoboticCheese/goulash"
+	"github.com/RoboticCheese/goulash/common"
+	"github.com/RoboticCheese/goulash/universe"
+)
+
+// ErrNoHistory is returned when the Store has nothing recorded as of the
+// time asked about.
+var ErrNoHistory = errors.New("no history recorded for that time")
+
+// ErrOutOfOrder is returned when recording a Universe as of a time before the
+// last change logged.
+var ErrOutOfOrder = errors.New("can't record before the last logged change")
+
+// Kind identifies whether an Event is a version appearing or disappearing.
+type Kind int
+
+// The kinds of Event.
+const (
+	Appeared Kind = iota
+	Disappeared
+)
+
+// String returns the name of a Kind.
+func (k Kind) String() (res string) {
+	switch k {
+	case Appeared:
+		res = "appeared"
+	case Disappeared:
+		res = "disappeared"
+	default:
+		res = "unknown"
+	}
+	return
+}
+
+// Event implements a single version of a cookbook appearing in or
+// disappearing from the universe.
+type Event struct {
+	Time    time.Time
+	Version string
+	Kind    Kind
+}
+
+// entry implements a single line of the log. The first entry marks when the
+// base snapshot was recorded and has an empty patch.
+type entry struct {
+	Time  time.Time    `json:"time"`
+	Patch common.Patch `json:"patch"`
+}
+
+// Store implements a Universe archive in a directory.
+type Store struct {
+	Dir  string
+	lock sync.Mutex
+	head *goulash.Universe
+	last time.Time // When the last entry was logged
+}
+
+// Open accepts a directory, creating it if it doesn't exist, and returns a
+// pointer to a Store for it and any error reading what's already there.
+func Open(dir string) (s *Store, err error) {
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return
+	}
+	s = &Store{Dir: dir}
+	_, err = os.Stat(s.basePath())
+	if os.IsNotExist(err) {
+		err = nil
+		return
+	}
+	if err != nil {
+		return
+	}
+	s.head, _, err = s.replay(maxTime, func(at time.Time, _ interface{}) {
+		s.last = at
+	})
+	return
+}
+
+// Record adds a Universe to the Store as of a given time, which can't be
+// before the last change logged. The first Universe recorded becomes the base
+// snapshot; after that, only the changes from the last one recorded are
+// logged, and nothing is logged if there aren't any.
+func (s *Store) Record(at time.Time, u *goulash.Universe) (err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.head != nil && at.Before(s.last) {
+		return ErrOutOfOrder
+	}
+	head := u.Clone()
+	if s.head == nil {
+		err = s.recordBase(at, u.Snapshot())
+		if err == nil {
+			s.head, s.last = head, at
+		}
+		return
+	}
+	p, err := s.head.JSONPatch(head)
+	if err != nil || len(p) == 0 {
+		return
+	}
+	err = s.appendEntry(entry{Time: at, Patch: p})
+	if err == nil {
+		s.head, s.last = head, at
+	}
+	return
+}
+
+// recordBase starts a new log with an entry for a base snapshot and then
+// saves the snapshot. The Store only counts as started once the snapshot
+// exists, so the log is removed again if it can't be saved.
+func (s *Store) recordBase(at time.Time, snap *goulash.Universe) (err error) {
+	err = os.Remove(s.logPath())
+	if err != nil && !os.IsNotExist(err) {
+		return
+	}
+	err = s.appendEntry(entry{Time: at, Patch: common.Patch{}})
+	if err != nil {
+		return
+	}
+	err = snap.SaveSnapshot(s.basePath())
+	if err != nil {
+		os.Remove(s.logPath())
+	}
+	return
+}
+
+// Update updates a Universe and records the result as of its fetch time,
+// returning the diffs from Update.
+func (s *Store) Update(u *goulash.Universe) (pos, neg *goulash.Universe, err error) {
+	pos, neg, err = u.Update()
+	if err != nil || (pos == nil && neg == nil) {
+		return
+	}
+	at := u.FetchedAt()
+	if at.IsZero() {
+		at = time.Now()
+	}
+	err = s.Record(at, u)
+	return
+}
+
+// AsOf returns the Universe as it was recorded at a given time, or
+// ErrNoHistory if the time is before anything was recorded.
+func (s *Store) AsOf(t time.Time) (u *goulash.Universe, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.head == nil {
+		err = ErrNoHistory
+		return
+	}
+	u, n, err := s.replay(t, nil)
+	if err == nil && n == 0 {
+		u = nil
+		err = ErrNoHistory
+	}
+	return
+}
+
+// History returns every time a version of a cookbook appeared or
+// disappeared, in order. Versions in the base snapshot appear at the time it
+// was recorded.
+func (s *Store) History(cookbook string) (events []Event, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.head == nil {
+		return
+	}
+	prev := map[string]bool{}
+	_, _, err = s.replay(maxTime, func(at time.Time, doc interface{}) {
+		cur := versionSet(doc, cookbook)
+		for _, v := range sortedKeys(cur) {
+			if !prev[v] {
+				events = append(events, Event{Time: at, Version: v, Kind: Appeared})
+			}
+		}
+		for _, v := range sortedKeys(prev) {
+			if !cur[v] {
+				events = append(events, Event{Time: at, Version: v, Kind: Disappeared})
+			}
+		}
+		prev = cur
+	})
+	return
+}
+
+// maxTime is later than any log entry.
+var maxTime = time.Unix(1<<62, 0)
+
+// replay applies each log entry up to a given time to the base snapshot,
+// passing the document after each one to a function if there is one, and
+// returns the resulting Universe and the number of entries applied.
+func (s *Store) replay(until time.Time, fn func(time.Time, interface{})) (u *goulash.Universe, n int, err error) {
+	base, err := goulash.LoadSnapshot(s.basePath())
+	if err != nil {
+		return
+	}
+	data, err := json.Marshal(base)
+	if err != nil {
+		return
+	}
+	var doc interface{}
+	err = json.Unmarshal(data, &doc)
+	if err != nil {
+		return
+	}
+
+	f, err := os.Open(s.logPath())
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<30)
+	for scanner.Scan() {
+		e := entry{}
+		err = json.Unmarshal(scanner.Bytes(), &e)
+		if err != nil {
+			return
+		}
+		if e.Time.After(until) {
+			break
+		}
+		doc, err = e.Patch.ApplyDocument(doc)
+		if err != nil {
+			return
+		}
+		n++
+		if fn != nil {
+			fn(e.Time, doc)
+		}
+	}
+	err = scanner.Err()
+	if err != nil {
+		return
+	}
+
+	data, err = json.Marshal(doc)
+	if err != nil {
+		return
+	}
+	u = goulash.InitUniverse()
+	err = json.Unmarshal(data, u)
+	if err != nil {
+		return
+	}
+	u.Component = base.Component
+	u.APIInstance = base.APIInstance
+	return
+}
+
+// appendEntry adds an entry to the end of the log.
+func (s *Store) appendEntry(e entry) (err error) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	f, err := os.OpenFile(s.logPath(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return
+	}
+	_, err = f.Write(append(data, '\n'))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return
+}
+
+// basePath returns the path of the base snapshot.
+func (s *Store) basePath() string {
+	return filepath.Join(s.Dir, "base.json.gz")
+}
+
+// logPath returns the path of the log.
+func (s *Store) logPath() string {
+	return filepath.Join(s.Dir, "log.jsonl")
+}
+
+// versionSet returns the set of versions of a cookbook in a universe
+// document.
+func versionSet(doc interface{}, cookbook string) (res map[string]bool) {
+	res = map[string]bool{}
+	cookbooks, _ := doc.(map[string]interface{})
+	versions, _ := cookbooks[cookbook].(map[string]interface{})
+	for v := range versions {
+		res[v] = true
+	}
+	return
+}
+
+// sortedKeys returns the keys of a set in version order, falling back to
+// string order for any that can't be parsed.
+func sortedKeys(set map[string]bool) (res []string) {
+	for k := range set {
+		res = append(res, k)
+	}
+	universe.SortVersions(res)
+	return
+}
@@ -0,0 +1,250 @@
+package history
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/RoboticCheese/goulash"
+	"github.com/RoboticCheese/goulash/common"
+	"github.com/RoboticCheese/goulash/universe"
+)
+
+func udata(versions ...string) (u *goulash.Universe) {
+	u = goulash.InitUniverse()
+	u.Component = goulash.Component{Endpoint: "https://example.com/universe"}
+	u.APIInstance = &goulash.APIInstance{BaseURL: "https://example.com", Version: "1"}
+	c := universe.NewCookbook()
+	c.Name = "chef"
+	for _, v := range versions {
+		cv := universe.NewCookbookVersion()
+		cv.Version = v
+		cv.LocationType = "opscode"
+		c.Versions[v] = cv
+	}
+	u.Cookbooks["chef"] = c
+	return
+}
+
+var day = time.Date(2014, 9, 20, 0, 0, 0, 0, time.UTC)
+
+func record(t *testing.T, s *Store) {
+	for i, u := range []*goulash.Universe{
+		udata("0.1.0"),
+		udata("0.1.0", "0.2.0"),
+		udata("0.1.0", "0.2.0"),
+		udata("0.2.0", "0.3.0"),
+	} {
+		err := s.Record(day.AddDate(0, 0, i), u)
+		if err != nil {
+			t.Fatalf("Expected no err, got: %v", err)
+		}
+	}
+}
+
+func TestAsOf(t *testing.T) {
+	s, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Expected no err, got: %v", err)
+	}
+	_, err = s.AsOf(day)
+	if err != ErrNoHistory {
+		t.Fatalf("Expected: %v, got: %v", ErrNoHistory, err)
+	}
+	record(t, s)
+	for _, i := range [][]interface{}{
+		{day.Add(-time.Hour), nil},
+		{day, udata("0.1.0")},
+		{day.Add(36 * time.Hour), udata("0.1.0", "0.2.0")},
+		{day.AddDate(1, 0, 0), udata("0.2.0", "0.3.0")},
+	} {
+		res, err := s.AsOf(i[0].(time.Time))
+		if i[1] == nil {
+			if err != ErrNoHistory {
+				t.Fatalf("Expected: %v, got: %v", ErrNoHistory, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Expected no err, got: %v", err)
+		}
+		// Loaded snapshots fill in the APIInstance endpoint
+		if !res.Equals(i[1].(*goulash.Universe), common.IgnoreFields("APIInstance")) {
+			t.Fatalf("Expected: %v, got: %v", i[1], res)
+		}
+	}
+}
+
+func TestHistory(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Expected no err, got: %v", err)
+	}
+	record(t, s)
+	// Reopening replays the log from disk
+	s, err = Open(dir)
+	if err != nil {
+		t.Fatalf("Expected no err, got: %v", err)
+	}
+	err = s.Record(day.AddDate(0, 0, 4), udata("0.2.0", "0.3.0", "1.0.0"))
+	if err != nil {
+		t.Fatalf("Expected no err, got: %v", err)
+	}
+	events, err := s.History("chef")
+	if err != nil {
+		t.Fatalf("Expected no err, got: %v", err)
+	}
+	exp := []Event{
+		{day, "0.1.0", Appeared},
+		{day.AddDate(0, 0, 1), "0.2.0", Appeared},
+		{day.AddDate(0, 0, 3), "0.3.0", Appeared},
+		{day.AddDate(0, 0, 3), "0.1.0", Disappeared},
+		{day.AddDate(0, 0, 4), "1.0.0", Appeared},
+	}
+	if len(events) != len(exp) {
+		t.Fatalf("Expected: %v, got: %v", exp, events)
+	}
+	for i, e := range exp {
+		if !events[i].Time.Equal(e.Time) || events[i].Version != e.Version || events[i].Kind != e.Kind {
+			t.Fatalf("Expected: %v, got: %v", e, events[i])
+		}
+	}
+	none, err := s.History("nginx")
+	if err != nil || len(none) != 0 {
+		t.Fatalf("Expected no events, got: %v, %v", none, err)
+	}
+}
+
+func TestRecordOutOfOrder(t *testing.T) {
+	dir := t.TempDir()
+	s, _ := Open(dir)
+	record(t, s)
+	err := s.Record(day.AddDate(0, 0, 2), udata("1.0.0"))
+	if err != ErrOutOfOrder {
+		t.Fatalf("Expected: %v, got: %v", ErrOutOfOrder, err)
+	}
+	// The same time as the last change is fine
+	err = s.Record(day.AddDate(0, 0, 3), udata("0.2.0", "0.3.0"))
+	if err != nil {
+		t.Fatalf("Expected no err, got: %v", err)
+	}
+
+	// Reopening picks up the time of the last change from the log
+	s, _ = Open(dir)
+	err = s.Record(day.AddDate(0, 0, 2), udata("1.0.0"))
+	if err != ErrOutOfOrder {
+		t.Fatalf("Expected: %v, got: %v", ErrOutOfOrder, err)
+	}
+}
+
+func TestRecordKeepsCopy(t *testing.T) {
+	s, _ := Open(t.TempDir())
+	u := udata("0.1.0")
+	err := s.Record(day, u)
+	if err != nil {
+		t.Fatalf("Expected no err, got: %v", err)
+	}
+	// Changing the Universe in place afterwards doesn't change what's
+	// recorded, so recording it again logs the change
+	cv := universe.NewCookbookVersion()
+	cv.Version = "0.2.0"
+	cv.LocationType = "opscode"
+	u.Cookbooks["chef"].Versions["0.2.0"] = cv
+	err = s.Record(day.AddDate(0, 0, 1), u)
+	if err != nil {
+		t.Fatalf("Expected no err, got: %v", err)
+	}
+	events, err := s.History("chef")
+	if err != nil || len(events) != 2 || events[1].Version != "0.2.0" {
+		t.Fatalf("Expected 0.2.0 to appear, got: %v, %v", events, err)
+	}
+}
+
+func TestRecordBaseFailure(t *testing.T) {
+	dir := t.TempDir()
+	s, _ := Open(dir)
+	// A directory in the way stops the base snapshot being saved
+	os.MkdirAll(filepath.Join(s.basePath(), "in-the-way"), 0755)
+	err := s.Record(day, udata("0.1.0"))
+	if err == nil {
+		t.Fatalf("Expected an error, got: %v", err)
+	}
+	_, err = os.Stat(s.logPath())
+	if !os.IsNotExist(err) {
+		t.Fatalf("Expected no log, got: %v", err)
+	}
+
+	os.RemoveAll(s.basePath())
+	err = s.Record(day, udata("0.1.0"))
+	if err != nil {
+		t.Fatalf("Expected no err, got: %v", err)
+	}
+	s, err = Open(dir)
+	if err != nil {
+		t.Fatalf("Expected no err, got: %v", err)
+	}
+	events, err := s.History("chef")
+	if err != nil || len(events) != 1 {
+		t.Fatalf("Expected one event, got: %v, %v", events, err)
+	}
+}
+
+func TestKindString(t *testing.T) {
+	for _, i := range [][]interface{}{
+		{Appeared.String(), "appeared"},
+		{Disappeared.String(), "disappeared"},
+		{Kind(9).String(), "unknown"},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+}
+
+func TestStoreUpdate(t *testing.T) {
+	var body atomic.Value
+	body.Store(`{"chef": {"0.1.0": {"location_type": "opscode"}}}`)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body.Load().(string)))
+	}))
+	defer ts.Close()
+	a, err := goulash.NewAPIInstance(ts.URL)
+	if err != nil {
+		t.Fatalf("Expected no err, got: %v", err)
+	}
+	u, err := goulash.NewUniverse(a)
+	if err != nil {
+		t.Fatalf("Expected no err, got: %v", err)
+	}
+	s, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Expected no err, got: %v", err)
+	}
+	err = s.Record(u.FetchedAt(), u)
+	if err != nil {
+		t.Fatalf("Expected no err, got: %v", err)
+	}
+
+	body.Store(`{"chef": {"0.1.0": {"location_type": "opscode"}, "0.2.0": {"location_type": "opscode"}}}`)
+	pos, _, err := s.Update(u)
+	if err != nil {
+		t.Fatalf("Expected no err, got: %v", err)
+	}
+	events, err := s.History("chef")
+	for _, i := range [][]interface{}{
+		{err, nil},
+		{pos.Cookbooks["chef"].Versions["0.2.0"] != nil, true},
+		{len(events), 2},
+		{events[1].Version, "0.2.0"},
+		{events[1].Time.Equal(u.FetchedAt()), true},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+}
@@ -0,0 +1,121 @@
+// Author:: Jonathan Hartman (<j@p4nt5.com>)
+//
+// Copyright (C) 2014, Jonathan Hartman
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package apiserve implements the pieces shared by goulash's servers of the
+Supermarket API: goulashtest, mirror and proxy.
+
+This file defines writing responses with an ETag, working out the URL a
+server is reached at, and paging through the cookbook list, e.g.
+
+/api/v1/cookbooks?start=0&items=2 =>
+
+	{
+		"start": 0,
+		"total": 3,
+		"items": [
+			{"cookbook_name": "chef-dk", ...},
+			{"cookbook_name": "dmg", ...}
+		]
+	}
+*/
+package apiserve
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ListItem implements a single cookbook in the API's cookbook list.
+type ListItem struct {
+	Name        string `json:"cookbook_name"`
+	Maintainer  string `json:"cookbook_maintainer"`
+	Description string `json:"cookbook_description"`
+	Cookbook    string `json:"cookbook"`
+}
+
+// List implements a page of the API's cookbook list.
+type List struct {
+	Start int        `json:"start"`
+	Total int        `json:"total"`
+	Items []ListItem `json:"items"`
+}
+
+// Page returns the page of a sorted list of cookbook names a request's start
+// and items query parameters ask for, 10 items by default, with each name
+// made into a ListItem by a function.
+func Page(r *http.Request, names []string, item func(name string) ListItem) (res List) {
+	res.Total = len(names)
+	res.Start, _ = strconv.Atoi(r.URL.Query().Get("start"))
+	if res.Start < 0 || res.Start > len(names) {
+		res.Start = len(names)
+	}
+	items, err := strconv.Atoi(r.URL.Query().Get("items"))
+	if err != nil || items < 0 {
+		items = 10
+	}
+	end := res.Start + items
+	if end > len(names) {
+		end = len(names)
+	}
+	res.Items = []ListItem{}
+	for _, name := range names[res.Start:end] {
+		res.Items = append(res.Items, item(name))
+	}
+	return
+}
+
+// BaseURL returns the URL a server is reached at: the configured one if it's
+// set, or else the scheme and host a request was made to.
+func BaseURL(configured string, r *http.Request) string {
+	if configured != "" {
+		return strings.TrimSuffix(configured, "/")
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// WriteJSON writes data to a response as JSON, with an ETag so clients can
+// skip downloading it again if it hasn't changed.
+func WriteJSON(w http.ResponseWriter, r *http.Request, data interface{}) {
+	body, err := json.Marshal(data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	Write(w, r, body, "application/json")
+}
+
+// Write writes a body to a response with an ETag, or just a 304 if the
+// request's If-None-Match already has it.
+func Write(w http.ResponseWriter, r *http.Request, body []byte, contentType string) {
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:]) + `"`
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Write(body)
+}
@@ -0,0 +1,82 @@
+package apiserve
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPage(t *testing.T) {
+	names := []string{"a", "b", "c"}
+	item := func(name string) ListItem {
+		return ListItem{Name: name, Cookbook: "/api/v1/cookbooks/" + name}
+	}
+	for _, i := range [][]interface{}{
+		{"/api/v1/cookbooks", 0, 3, "a"},
+		{"/api/v1/cookbooks?start=1&items=1", 1, 1, "b"},
+		{"/api/v1/cookbooks?start=2&items=bad", 2, 1, "c"},
+		{"/api/v1/cookbooks?start=5", 3, 0, ""},
+		{"/api/v1/cookbooks?start=-1", 3, 0, ""},
+	} {
+		res := Page(httptest.NewRequest("GET", i[0].(string), nil), names, item)
+		if res.Total != 3 || res.Start != i[1] || len(res.Items) != i[2] {
+			t.Fatalf("Expected: %v, got: %v", i, res)
+		}
+		if len(res.Items) > 0 && res.Items[0].Name != i[3] {
+			t.Fatalf("Expected: %v, got: %v", i[3], res.Items[0].Name)
+		}
+	}
+}
+
+func TestBaseURL(t *testing.T) {
+	r := httptest.NewRequest("GET", "/universe", nil)
+	r.Host = "mirror.example.com:8080"
+	tr := httptest.NewRequest("GET", "/universe", nil)
+	tr.Host = "mirror.example.com"
+	tr.TLS = &tls.ConnectionState{}
+	for _, i := range [][]interface{}{
+		{BaseURL("", r), "http://mirror.example.com:8080"},
+		{BaseURL("", tr), "https://mirror.example.com"},
+		{BaseURL("https://example.com/", r), "https://example.com"},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	w := httptest.NewRecorder()
+	WriteJSON(w, httptest.NewRequest("GET", "/status", nil), map[string]string{"status": "ok"})
+	etag := w.Header().Get("ETag")
+	for _, i := range [][]interface{}{
+		{w.Code, 200},
+		{w.Header().Get("Content-Type"), "application/json"},
+		{w.Body.String(), `{"status":"ok"}`},
+		{etag != "", true},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+
+	r := httptest.NewRequest("GET", "/status", nil)
+	r.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	WriteJSON(w, r, map[string]string{"status": "ok"})
+	for _, i := range [][]interface{}{
+		{w.Code, http.StatusNotModified},
+		{w.Body.Len(), 0},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+
+	w = httptest.NewRecorder()
+	WriteJSON(w, r, func() {})
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("Expected: %v, got: %v", http.StatusInternalServerError, w.Code)
+	}
+}
@@ -0,0 +1,255 @@
+// Author:: Jonathan Hartman (<j@p4nt5.com>)
+//
+// Copyright (C) 2014, Jonathan Hartman
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package goulash implements a Go client library for the Chef Supermarket API.
+
+This file defines building a Universe from cookbooks on disk, e.g. the
+cookbooks directory of a chef-repo, so they can be diffed and resolved
+alongside ones from a Supermarket. Each cookbook's metadata.json is read if
+it has one. Otherwise, a safe subset of its metadata.rb is parsed without
+running it:
+
+	name 'chef-dk'
+	version '2.0.1'
+	depends 'dmg', '~> 2.2'
+	depends 'windows'
+
+Every other line of a metadata.rb is ignored, and one of those lines with
+anything but plain string arguments is an error. Each version is added with the
+"path" location type and the cookbook's directory as its location path.
+*/
+package goulash
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/RoboticCheese/goulash/universe"
+)
+
+// localMetadata implements the parts of a cookbook's metadata that make up
+// a universe entry.
+type localMetadata struct {
+	Name         string                     `json:"name"`
+	Version      string                     `json:"version"`
+	Dependencies map[string]json.RawMessage `json:"dependencies"`
+	deps         map[string]string
+}
+
+// metadataRBLine matches a name, version, or depends line of a metadata.rb,
+// with or without parentheses, and captures the method and its arguments.
+var metadataRBLine = regexp.MustCompile(`^\s*(name|version|depends)[\s(]+(.*?)\)?\s*(#.*)?$`)
+
+// metadataRBArg matches a single- or double-quoted string argument.
+var metadataRBArg = regexp.MustCompile(`^\s*(?:'([^'\\]*)'|"([^"\\#]*)")\s*(?:,|$)`)
+
+// NewLocalUniverse initializes and returns a new Universe struct from
+// cookbooks on disk. Each directory given may be a cookbook itself or hold
+// cookbooks in its subdirectories. If the same version of a cookbook is
+// found more than once, the first one found is used. A local Universe has no
+// APIInstance, so updating it returns ErrNoAPIInstance; load it again instead.
+func NewLocalUniverse(dirs ...string) (u *Universe, err error) {
+	u = InitUniverse()
+	u.fetchedAt = time.Now()
+	for _, dir := range dirs {
+		var cookbooks []string
+		cookbooks, err = findCookbooks(dir)
+		if err != nil {
+			return
+		}
+		for _, path := range cookbooks {
+			var md *localMetadata
+			md, err = loadMetadata(path)
+			if err != nil {
+				return
+			}
+			addLocalVersion(u, path, md)
+		}
+	}
+	return
+}
+
+// findCookbooks returns the cookbook directory a directory is, or else the
+// cookbook directories inside of it.
+func findCookbooks(dir string) (cookbooks []string, err error) {
+	dir, err = filepath.Abs(dir)
+	if err != nil {
+		return
+	}
+	if isCookbook(dir) {
+		cookbooks = []string{dir}
+		return
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		path := filepath.Join(dir, e.Name())
+		if e.IsDir() && isCookbook(path) {
+			cookbooks = append(cookbooks, path)
+		}
+	}
+	return
+}
+
+// isCookbook checks whether a directory has cookbook metadata.
+func isCookbook(dir string) bool {
+	for _, f := range []string{"metadata.json", "metadata.rb"} {
+		if _, err := os.Stat(filepath.Join(dir, f)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// loadMetadata reads a cookbook's metadata.json, or its metadata.rb if it
+// doesn't have one.
+func loadMetadata(dir string) (md *localMetadata, err error) {
+	var rbData []byte
+	jsonData, err := os.ReadFile(filepath.Join(dir, "metadata.json"))
+	if os.IsNotExist(err) {
+		rbData, err = os.ReadFile(filepath.Join(dir, "metadata.rb"))
+	}
+	if err == nil {
+		md, err = decodeMetadata(filepath.Base(dir), jsonData, rbData)
+	}
+	if err != nil {
+		err = errors.New(dir + ": " + err.Error())
+	}
+	return
+}
+
+// decodeMetadata returns a new localMetadata from the contents of a
+// metadata.json, or a metadata.rb if there's no metadata.json. A cookbook
+// without a name is named for its directory and one without a version is
+// 0.0.0, as Chef does.
+func decodeMetadata(dir string, jsonData, rbData []byte) (md *localMetadata, err error) {
+	md = new(localMetadata)
+	md.deps = map[string]string{}
+	if jsonData != nil {
+		err = md.decodeJSON(jsonData)
+	} else {
+		err = md.parseRB(string(rbData))
+	}
+	if err != nil {
+		return
+	}
+	if md.Name == "" {
+		md.Name = dir
+	}
+	if md.Version == "" {
+		md.Version = "0.0.0"
+	}
+	return
+}
+
+// decodeJSON populates a localMetadata from a metadata.json. A dependency's
+// constraint may be a string or a list of strings.
+func (md *localMetadata) decodeJSON(data []byte) (err error) {
+	err = json.Unmarshal(data, md)
+	if err != nil {
+		return
+	}
+	for name, raw := range md.Dependencies {
+		var c string
+		if json.Unmarshal(raw, &c) == nil {
+			md.deps[name] = c
+			continue
+		}
+		var cs []string
+		err = json.Unmarshal(raw, &cs)
+		if err != nil {
+			return errors.New("invalid constraint for dependency: " + name)
+		}
+		md.deps[name] = strings.Join(cs, ", ")
+	}
+	return
+}
+
+// parseRB populates a localMetadata from the name, version, and depends
+// lines of a metadata.rb. Arguments must be plain string literals.
+func (md *localMetadata) parseRB(data string) (err error) {
+	for _, line := range strings.Split(data, "\n") {
+		m := metadataRBLine.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		var args []string
+		args, err = parseRBArgs(m[2])
+		if err != nil || len(args) == 0 {
+			return errors.New("unsupported metadata.rb line: " + strings.TrimSpace(line))
+		}
+		switch m[1] {
+		case "name":
+			md.Name = args[0]
+		case "version":
+			md.Version = args[0]
+		case "depends":
+			c := ">= 0.0.0"
+			if len(args) > 1 {
+				c = strings.Join(args[1:], ", ")
+			}
+			md.deps[args[0]] = c
+		}
+	}
+	return
+}
+
+// parseRBArgs splits a comma-separated list of Ruby string literals,
+// refusing anything else, e.g. interpolation or method calls.
+func parseRBArgs(s string) (args []string, err error) {
+	for strings.TrimSpace(s) != "" {
+		m := metadataRBArg.FindStringSubmatchIndex(s)
+		if m == nil {
+			err = errors.New("unsupported argument: " + s)
+			return
+		}
+		if m[2] >= 0 {
+			args = append(args, s[m[2]:m[3]])
+		} else {
+			args = append(args, s[m[4]:m[5]])
+		}
+		s = s[m[1]:]
+	}
+	return
+}
+
+// addLocalVersion adds a cookbook on disk to a Universe, unless that version
+// of it is already there.
+func addLocalVersion(u *Universe, path string, md *localMetadata) {
+	c := u.Cookbooks[md.Name]
+	if c == nil {
+		c = universe.NewCookbook()
+		c.Name = md.Name
+		u.Cookbooks[md.Name] = c
+	}
+	if _, ok := c.Versions[md.Version]; ok {
+		return
+	}
+	cv := universe.NewCookbookVersion()
+	cv.Version = md.Version
+	cv.LocationType = "path"
+	cv.LocationPath = path
+	cv.Dependencies = md.deps
+	c.Versions[md.Version] = cv
+}
@@ -0,0 +1,113 @@
+package goulash
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeCookbook(t *testing.T, dir, file, data string) string {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		t.Fatalf("Expected no err, got: %v", err)
+	}
+	err = os.WriteFile(filepath.Join(dir, file), []byte(data), 0644)
+	if err != nil {
+		t.Fatalf("Expected no err, got: %v", err)
+	}
+	return dir
+}
+
+func TestNewLocalUniverse(t *testing.T) {
+	repo := t.TempDir()
+	cookbooks := filepath.Join(repo, "cookbooks")
+	dk := writeCookbook(t, filepath.Join(cookbooks, "chef-dk"), "metadata.json", `{
+		"name": "chef-dk",
+		"version": "2.0.1",
+		"dependencies": {"dmg": "~> 2.2", "windows": [">= 1.0", "< 2.0"]}
+	}`)
+	writeCookbook(t, filepath.Join(cookbooks, "chef-dk"), "metadata.rb", `name 'ignored'`)
+	app := writeCookbook(t, filepath.Join(cookbooks, "myapp"), "metadata.rb", `
+name "my-app" # the real name
+maintainer 'Me'
+long_description IO.read(File.join(File.dirname(__FILE__), 'README.md'))
+version '0.3.0'
+depends 'chef-dk'
+depends('dmg', '~> 2.2')
+supports 'ubuntu'
+`)
+	bare := writeCookbook(t, filepath.Join(cookbooks, "bare"), "metadata.rb", "")
+	os.MkdirAll(filepath.Join(cookbooks, "not-a-cookbook"), 0755)
+
+	u, err := NewLocalUniverse(cookbooks)
+	if err != nil {
+		t.Fatalf("Expected no err, got: %v", err)
+	}
+	dkv := u.Cookbook("chef-dk").Versions["2.0.1"]
+	appv := u.Cookbook("my-app").Versions["0.3.0"]
+	for _, i := range [][]interface{}{
+		{u.Len(), 3},
+		{dkv.LocationType, "path"},
+		{dkv.LocationPath, dk},
+		{dkv.Dependencies["dmg"], "~> 2.2"},
+		{dkv.Dependencies["windows"], ">= 1.0, < 2.0"},
+		{appv.LocationPath, app},
+		{len(appv.Dependencies), 2},
+		{appv.Dependencies["chef-dk"], ">= 0.0.0"},
+		{appv.Dependencies["dmg"], "~> 2.2"},
+		{u.Cookbook("bare").Versions["0.0.0"].LocationPath, bare},
+		{u.FetchedAt().IsZero(), false},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+}
+
+func TestNewLocalUniverseSingleCookbook(t *testing.T) {
+	first := writeCookbook(t, t.TempDir(), "metadata.rb", "name 'app'\nversion '1.0.0'\n")
+	second := writeCookbook(t, t.TempDir(), "metadata.rb", "name 'app'\nversion '1.0.0'\n")
+	third := writeCookbook(t, t.TempDir(), "metadata.rb", "name 'app'\nversion '1.1.0'\n")
+
+	u, err := NewLocalUniverse(first, second, third)
+	if err != nil {
+		t.Fatalf("Expected no err, got: %v", err)
+	}
+	for _, i := range [][]interface{}{
+		{u.Len(), 1},
+		{len(u.Cookbook("app").Versions), 2},
+		{u.Cookbook("app").Versions["1.0.0"].LocationPath, first},
+		{u.Cookbook("app").Versions["1.1.0"].LocationPath, third},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+	_, _, err = u.Update()
+	if err != ErrNoAPIInstance {
+		t.Fatalf("Expected: %v, got: %v", ErrNoAPIInstance, err)
+	}
+}
+
+func TestNewLocalUniverseErrors(t *testing.T) {
+	for _, data := range []string{
+		"version node['app']['version']\n",
+		"name \"app-#{ENV['SUFFIX']}\"\n",
+		"depends 'dmg', VERSION\n",
+	} {
+		dir := writeCookbook(t, t.TempDir(), "metadata.rb", data)
+		_, err := NewLocalUniverse(dir)
+		if err == nil {
+			t.Fatalf("Expected an error for: %v", data)
+		}
+	}
+	dir := writeCookbook(t, t.TempDir(), "metadata.json", `{"dependencies": {"dmg": 2}}`)
+	_, err := NewLocalUniverse(dir)
+	if err == nil {
+		t.Fatalf("Expected an error, got: %v", err)
+	}
+	_, err = NewLocalUniverse(filepath.Join(t.TempDir(), "nope"))
+	if err == nil {
+		t.Fatalf("Expected an error, got: %v", err)
+	}
+}
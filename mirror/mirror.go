@@ -0,0 +1,387 @@
+// Author:: Jonathan Hartman (<j@p4nt5.com>)
+//
+// Copyright (C) 2014, Jonathan Hartman
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package mirror implements a local, read-only copy of a Supermarket.
+
+A Mirror syncs the universe and a selection of cookbooks from a Supermarket
+into a directory, e.g.
+
+	mirror/universe.json.gz
+	mirror/cookbooks/nginx/cookbook.json
+	mirror/cookbooks/nginx/2.7.4/version.json
+	mirror/cookbooks/nginx/2.7.4/cookbook.tar.gz
+
+and serves them over HTTP with every URL rewritten to point at itself, so
+Berkshelf and friends can resolve and download cookbooks without reaching the
+original server. It serves:
+
+	/status
+	/universe
+	/api/v1/cookbooks
+	/api/v1/cookbooks/:name
+	/api/v1/cookbooks/:name/versions/:version
+	/api/v1/cookbooks/:name/versions/:version/download
+
+The whole universe is served, but only the versions of synced cookbooks can
+be downloaded.
+*/
+package mirror
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/RoboticCheese/goulash"
+	"github.com/RoboticCheese/goulash/internal/apiserve"
+	"github.com/RoboticCheese/goulash/universe"
+)
+
+// ErrNotSynced is the error served by a Mirror that has no universe yet.
+var ErrNotSynced = errors.New("mirror has not been synced")
+
+// Mirror implements a local copy of a Supermarket stored in a directory.
+type Mirror struct {
+	Dir     string
+	BaseURL string // Where the Mirror is served; empty uses each request's host
+	lock    sync.RWMutex
+	u       *goulash.Universe
+	gen     int               // Counts syncs, so encodings of older ones are dropped
+	served  map[string][]byte // The encoded universe at each base URL
+}
+
+// maxServed is how many base URLs a Mirror keeps an encoded universe for
+// before it starts again, so made up Host headers can't grow it forever.
+const maxServed = 16
+
+// Open returns a Mirror of a directory, loading any universe already synced
+// into it. The directory is created if it doesn't exist.
+func Open(dir string) (m *Mirror, err error) {
+	err = os.MkdirAll(filepath.Join(dir, "cookbooks"), 0755)
+	if err != nil {
+		return
+	}
+	m = &Mirror{Dir: dir}
+	u, err := goulash.LoadSnapshot(m.universePath())
+	if err == nil {
+		m.u = u
+	} else if os.IsNotExist(err) {
+		err = nil
+	}
+	return
+}
+
+// Universe returns the Mirror's copy of the universe, as it was synced from
+// the original server, or nil if it hasn't been synced.
+func (m *Mirror) Universe() *goulash.Universe {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return m.u
+}
+
+// Sync brings the Mirror's universe up to date with a Supermarket and
+// downloads every version of each cookbook named. Versions already mirrored
+// aren't downloaded again.
+func (m *Mirror) Sync(source string, cookbooks ...string) (err error) {
+	u := m.Universe()
+	if u == nil || u.APIInstance == nil || u.APIInstance.BaseURL != source {
+		var i *goulash.APIInstance
+		i, err = goulash.NewAPIInstance(source)
+		if err != nil {
+			return
+		}
+		u, err = goulash.NewUniverse(i)
+	} else {
+		_, _, err = u.Update()
+	}
+	if err != nil {
+		return
+	}
+	err = u.SaveSnapshot(m.universePath())
+	if err != nil {
+		return
+	}
+	m.lock.Lock()
+	m.u = u
+	m.gen++
+	m.served = nil
+	m.lock.Unlock()
+
+	for _, name := range cookbooks {
+		err = m.syncCookbook(u, name)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// syncCookbook downloads a cookbook's data and any of its versions that
+// aren't mirrored yet.
+func (m *Mirror) syncCookbook(u *goulash.Universe, name string) (err error) {
+	c := u.Cookbook(name)
+	if c == nil || !validName(name) {
+		return errors.New("cookbook not in universe: " + name)
+	}
+	endpoint := u.APIInstance.Endpoint + "/cookbooks/" + name
+	err = fetch(endpoint, m.cookbookPath(name))
+	if err != nil {
+		return
+	}
+	for v, cv := range c.Versions {
+		if !validName(v) {
+			continue
+		}
+		if _, serr := os.Stat(m.tarballPath(name, v)); serr == nil {
+			continue
+		}
+		err = fetch(endpoint+"/versions/"+v, m.versionPath(name, v))
+		if err != nil {
+			return
+		}
+		err = fetch(cv.DownloadURL, m.tarballPath(name, v))
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// fetch downloads a URL to a file readable by everyone, creating its
+// directory if needed and replacing it atomically if it already exists.
+func fetch(url, path string) (err error) {
+	resp, err := http.Get(url)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return errors.New(url + ": " + resp.Status)
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return
+	}
+	defer os.Remove(tmp.Name())
+	err = tmp.Chmod(0644)
+	if err == nil {
+		_, err = io.Copy(tmp, resp.Body)
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return
+	}
+	err = os.Rename(tmp.Name(), path)
+	return
+}
+
+// validName checks that a cookbook name or version is safe to use as a path
+// element.
+func validName(name string) bool {
+	return name != "" && name != "." && name != ".." &&
+		!strings.ContainsAny(name, `/\`)
+}
+
+func (m *Mirror) universePath() string {
+	return filepath.Join(m.Dir, "universe.json.gz")
+}
+
+func (m *Mirror) cookbookPath(name string) string {
+	return filepath.Join(m.Dir, "cookbooks", name, "cookbook.json")
+}
+
+func (m *Mirror) versionPath(name, version string) string {
+	return filepath.Join(m.Dir, "cookbooks", name, version, "version.json")
+}
+
+func (m *Mirror) tarballPath(name, version string) string {
+	return filepath.Join(m.Dir, "cookbooks", name, version, "cookbook.tar.gz")
+}
+
+// ServeHTTP serves the Mirror's copy of the Supermarket API.
+func (m *Mirror) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	u := m.Universe()
+	if u == nil {
+		http.Error(w, ErrNotSynced.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	base := apiserve.BaseURL(m.BaseURL, r)
+
+	path := strings.TrimSuffix(r.URL.Path, "/")
+	switch {
+	case path == "/status":
+		apiserve.WriteJSON(w, r, map[string]string{"status": "ok"})
+		return
+	case path == "/universe":
+		body, err := m.universeJSON(base)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		apiserve.Write(w, r, body, "application/json")
+		return
+	case path == "/api/v1/cookbooks":
+		apiserve.WriteJSON(w, r, m.list(r, base))
+		return
+	case strings.HasPrefix(path, "/api/v1/cookbooks/"):
+		parts := strings.Split(strings.TrimPrefix(path, "/api/v1/cookbooks/"), "/")
+		for _, p := range parts {
+			if !validName(p) {
+				http.NotFound(w, r)
+				return
+			}
+		}
+		switch {
+		case len(parts) == 1:
+			m.serveDocument(w, r, m.cookbookPath(parts[0]), u, base)
+			return
+		case len(parts) == 3 && parts[1] == "versions":
+			m.serveDocument(w, r, m.versionPath(parts[0], parts[2]), u, base)
+			return
+		case len(parts) == 4 && parts[1] == "versions" && parts[3] == "download":
+			w.Header().Set("Content-Type", "application/x-gzip")
+			http.ServeFile(w, r, m.tarballPath(parts[0], parts[2]))
+			return
+		}
+	}
+	http.NotFound(w, r)
+}
+
+// universeJSON returns the Mirror's universe rewritten to point at a base URL
+// and encoded, reusing the last encoding for that base URL if the Mirror
+// hasn't synced since. An encoding started before a sync finishes isn't kept,
+// since the sync may have updated the universe while it was being encoded.
+func (m *Mirror) universeJSON(base string) (body []byte, err error) {
+	m.lock.RLock()
+	u, gen, body := m.u, m.gen, m.served[base]
+	m.lock.RUnlock()
+	if body != nil {
+		return
+	}
+	body, err = json.Marshal(rewriteUniverse(u, base))
+	if err != nil {
+		return
+	}
+	m.lock.Lock()
+	if m.gen == gen {
+		if m.served == nil || len(m.served) >= maxServed {
+			m.served = map[string][]byte{}
+		}
+		m.served[base] = body
+	}
+	m.lock.Unlock()
+	return
+}
+
+// serveDocument serves a mirrored API document with the original server's
+// URLs in it rewritten to the Mirror's.
+func (m *Mirror) serveDocument(w http.ResponseWriter, r *http.Request, path string, u *goulash.Universe, base string) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	var doc interface{}
+	err = json.Unmarshal(data, &doc)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	apiserve.WriteJSON(w, r, rewriteURLs(doc, u.APIInstance.BaseURL, base))
+}
+
+// rewriteURLs replaces the base of every string in decoded JSON data that is
+// one URL, or a path under it, with another. Strings that only start with the
+// same characters, e.g. on another host, are left alone.
+func rewriteURLs(doc interface{}, from, to string) interface{} {
+	switch d := doc.(type) {
+	case string:
+		if from != "" && (d == from || strings.HasPrefix(d, from+"/")) {
+			return to + strings.TrimPrefix(d, from)
+		}
+	case []interface{}:
+		for i := range d {
+			d[i] = rewriteURLs(d[i], from, to)
+		}
+	case map[string]interface{}:
+		for k := range d {
+			d[k] = rewriteURLs(d[k], from, to)
+		}
+	}
+	return doc
+}
+
+// rewriteUniverse returns a copy of a Universe's cookbook data that points
+// every version's location and download at the Mirror.
+func rewriteUniverse(u *goulash.Universe, base string) (res map[string]*universe.Cookbook) {
+	snap := u.Snapshot()
+	res = make(map[string]*universe.Cookbook, len(snap.Cookbooks))
+	for name, c := range snap.Cookbooks {
+		c2 := universe.NewCookbook()
+		c2.Name = name
+		for v, cv := range c.Versions {
+			cv2 := cv.Clone()
+			cv2.LocationType = "opscode"
+			cv2.LocationPath = base + "/api/v1"
+			cv2.DownloadURL = base + "/api/v1/cookbooks/" + name + "/versions/" + v + "/download"
+			c2.Versions[v] = cv2
+		}
+		res[name] = c2
+	}
+	return
+}
+
+// list returns a page of the mirrored cookbooks, sorted by name, honoring
+// the start and items query parameters.
+func (m *Mirror) list(r *http.Request, base string) (res apiserve.List) {
+	entries, _ := os.ReadDir(filepath.Join(m.Dir, "cookbooks"))
+	names := []string{}
+	for _, e := range entries {
+		if _, err := os.Stat(m.cookbookPath(e.Name())); err == nil {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+	res = apiserve.Page(r, names, func(name string) (item apiserve.ListItem) {
+		item = apiserve.ListItem{Name: name, Cookbook: base + "/api/v1/cookbooks/" + name}
+		var c goulash.Cookbook
+		data, err := os.ReadFile(m.cookbookPath(name))
+		if err == nil && json.Unmarshal(data, &c) == nil {
+			item.Maintainer = c.Maintainer
+			item.Description = c.Description
+		}
+		return
+	})
+	return
+}
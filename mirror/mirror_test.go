@@ -0,0 +1,293 @@
+package mirror
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/RoboticCheese/goulash"
+	"github.com/RoboticCheese/goulash/common"
+	"github.com/RoboticCheese/goulash/goulashtest"
+	"github.com/RoboticCheese/goulash/internal/apiserve"
+)
+
+func source() (s *goulashtest.Server) {
+	s = goulashtest.NewServer()
+	s.AddCookbook(&goulash.Cookbook{
+		Name:        "chef-dk",
+		Maintainer:  "roboticcheese",
+		Description: "Installs/configures the Chef-DK",
+	}, &goulash.CookbookVersion{
+		Version:      "2.0.0",
+		Dependencies: map[string]string{"dmg": "~> 2.2"},
+	}, &goulash.CookbookVersion{
+		Version: "2.0.1",
+	})
+	s.AddCookbookVersion("dmg", &goulash.CookbookVersion{Version: "2.2.0"})
+	s.AddTarball("chef-dk", "2.0.0", []byte("chef-dk 2.0.0"))
+	s.AddTarball("chef-dk", "2.0.1", []byte("chef-dk 2.0.1"))
+	return
+}
+
+func get(t *testing.T, url string) (data []byte, status int) {
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("Expected: nil, got: %v", err)
+	}
+	defer resp.Body.Close()
+	data, _ = io.ReadAll(resp.Body)
+	status = resp.StatusCode
+	return
+}
+
+func TestMirror(t *testing.T) {
+	src := source()
+	defer src.Close()
+
+	m, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Expected: nil, got: %v", err)
+	}
+	err = m.Sync(src.URL, "chef-dk")
+	if err != nil {
+		t.Fatalf("Expected: nil, got: %v", err)
+	}
+	ts := httptest.NewServer(m)
+	defer ts.Close()
+	src.Close()
+	for _, path := range []string{
+		m.universePath(),
+		m.tarballPath("chef-dk", "2.0.0"),
+	} {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("Expected: nil, got: %v", err)
+		}
+		if info.Mode().Perm() != 0644 {
+			t.Fatalf("Expected: %v, got: %v", os.FileMode(0644), info.Mode().Perm())
+		}
+	}
+
+	i, err := goulash.NewAPIInstance(ts.URL)
+	if err != nil {
+		t.Fatalf("Expected: nil, got: %v", err)
+	}
+	u, err := goulash.NewUniverse(i)
+	if err != nil {
+		t.Fatalf("Expected: nil, got: %v", err)
+	}
+	cv := u.Cookbook("chef-dk").Versions["2.0.0"]
+	c, err := goulash.NewCookbook(i, "chef-dk")
+	if err != nil {
+		t.Fatalf("Expected: nil, got: %v", err)
+	}
+	v, err := goulash.NewCookbookVersion(c, "2.0.0")
+	if err != nil {
+		t.Fatalf("Expected: nil, got: %v", err)
+	}
+	tarball, status := get(t, cv.DownloadURL)
+	_, missing := get(t, ts.URL+"/api/v1/cookbooks/dmg/versions/2.2.0/download")
+	for _, i := range [][]interface{}{
+		{u.Len(), 2},
+		{cv.LocationPath, ts.URL + "/api/v1"},
+		{cv.DownloadURL, ts.URL + "/api/v1/cookbooks/chef-dk/versions/2.0.0/download"},
+		{cv.Dependencies["dmg"], "~> 2.2"},
+		{c.Maintainer, "roboticcheese"},
+		{c.LatestVersion, ts.URL + "/api/v1/cookbooks/chef-dk/versions/2.0.1"},
+		{v.Cookbook, ts.URL + "/api/v1/cookbooks/chef-dk"},
+		{v.File, ts.URL + "/api/v1/cookbooks/chef-dk/versions/2.0.0/download"},
+		{status, http.StatusOK},
+		{string(tarball), "chef-dk 2.0.0"},
+		{missing, http.StatusNotFound},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+}
+
+func TestMirrorReopen(t *testing.T) {
+	src := source()
+	defer src.Close()
+
+	dir := t.TempDir()
+	m, _ := Open(dir)
+	err := m.Sync(src.URL, "chef-dk")
+	if err != nil {
+		t.Fatalf("Expected: nil, got: %v", err)
+	}
+
+	m2, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Expected: nil, got: %v", err)
+	}
+	if m2.Universe() == nil || !m2.Universe().Equals(m.Universe(), common.IgnoreFields("APIInstance")) {
+		t.Fatalf("Expected: %v, got: %v", m.Universe(), m2.Universe())
+	}
+
+	// Mirrored versions aren't downloaded again, but new ones are
+	src.AddCookbookVersion("chef-dk", &goulash.CookbookVersion{Version: "2.1.0"})
+	src.AddTarball("chef-dk", "2.1.0", []byte("chef-dk 2.1.0"))
+	src.AddTarball("chef-dk", "2.0.0", []byte("changed"))
+	err = m2.Sync(src.URL, "chef-dk")
+	if err != nil {
+		t.Fatalf("Expected: nil, got: %v", err)
+	}
+	m2.BaseURL = "http://mirror.example.com/"
+	ts := httptest.NewServer(m2)
+	defer ts.Close()
+
+	old, _ := get(t, ts.URL+"/api/v1/cookbooks/chef-dk/versions/2.0.0/download")
+	cur, _ := get(t, ts.URL+"/api/v1/cookbooks/chef-dk/versions/2.1.0/download")
+	data, _ := get(t, ts.URL+"/universe")
+	var u map[string]map[string]map[string]interface{}
+	json.Unmarshal(data, &u)
+	for _, i := range [][]interface{}{
+		{string(old), "chef-dk 2.0.0"},
+		{string(cur), "chef-dk 2.1.0"},
+		{u["chef-dk"]["2.1.0"]["location_path"], "http://mirror.example.com/api/v1"},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+}
+
+func TestMirrorList(t *testing.T) {
+	src := source()
+	defer src.Close()
+
+	m, _ := Open(t.TempDir())
+	m.Sync(src.URL, "chef-dk")
+	ts := httptest.NewServer(m)
+	defer ts.Close()
+
+	data, _ := get(t, ts.URL+"/api/v1/cookbooks")
+	var res apiserve.List
+	json.Unmarshal(data, &res)
+	for _, i := range [][]interface{}{
+		{res.Total, 1},
+		{res.Items[0].Name, "chef-dk"},
+		{res.Items[0].Description, "Installs/configures the Chef-DK"},
+		{res.Items[0].Cookbook, ts.URL + "/api/v1/cookbooks/chef-dk"},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+}
+
+func TestMirrorErrors(t *testing.T) {
+	src := source()
+	defer src.Close()
+
+	m, _ := Open(t.TempDir())
+	ts := httptest.NewServer(m)
+	defer ts.Close()
+
+	_, notSynced := get(t, ts.URL+"/universe")
+	err := m.Sync(src.URL, "nope")
+	_, notFound := get(t, ts.URL+"/api/v1/cookbooks/nope")
+	_, traversal := get(t, ts.URL+"/api/v1/cookbooks/chef-dk/versions/%2E%2E/download")
+	for _, i := range [][]interface{}{
+		{notSynced, http.StatusServiceUnavailable},
+		{err != nil, true},
+		{notFound, http.StatusNotFound},
+		{traversal, http.StatusNotFound},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+}
+
+func TestMirrorUniverseCache(t *testing.T) {
+	src := source()
+	defer src.Close()
+
+	m, _ := Open(t.TempDir())
+	m.Sync(src.URL)
+	first, _ := m.universeJSON("http://mirror.example.com")
+	again, _ := m.universeJSON("http://mirror.example.com")
+	other, _ := m.universeJSON("http://other.example.com")
+
+	src.AddCookbookVersion("chef-dk", &goulash.CookbookVersion{Version: "2.1.0"})
+	m.Sync(src.URL)
+	synced, _ := m.universeJSON("http://mirror.example.com")
+	var res map[string]map[string]interface{}
+	json.Unmarshal(synced, &res)
+	for _, i := range [][]interface{}{
+		{&first[0], &again[0]},
+		{&first[0] == &other[0], false},
+		{len(m.served), 1},
+		{res["chef-dk"]["2.1.0"] != nil, true},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+}
+
+func TestRewriteURLs(t *testing.T) {
+	from := "https://supermarket.example.com"
+	to := "http://mirror.example.com"
+	for _, i := range [][]interface{}{
+		{from, to},
+		{from + "/api/v1/cookbooks/dmg", to + "/api/v1/cookbooks/dmg"},
+		{"https://supermarket.example.com.evil/dmg", "https://supermarket.example.com.evil/dmg"},
+		{"https://supermarket.example.community", "https://supermarket.example.community"},
+		{"Installs dmg", "Installs dmg"},
+	} {
+		res := rewriteURLs(i[0], from, to)
+		if res != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], res)
+		}
+	}
+	doc := rewriteURLs(map[string]interface{}{
+		"versions": []interface{}{from + "/api/v1/cookbooks/dmg/versions/2.2.0"},
+	}, from, to).(map[string]interface{})
+	if res := doc["versions"].([]interface{})[0]; res != to+"/api/v1/cookbooks/dmg/versions/2.2.0" {
+		t.Fatalf("Expected: %v, got: %v", to+"/api/v1/cookbooks/dmg/versions/2.2.0", res)
+	}
+}
+
+func TestMirrorUniverseCacheDuringSync(t *testing.T) {
+	src := source()
+	defer src.Close()
+	m, _ := Open(t.TempDir())
+	m.Sync(src.URL)
+	ts := httptest.NewServer(m)
+	defer ts.Close()
+
+	for n := 0; n < 5; n++ {
+		v := "3.0." + strconv.Itoa(n)
+		src.AddCookbookVersion("chef-dk", &goulash.CookbookVersion{Version: v})
+		done := make(chan bool)
+		go func() {
+			defer close(done)
+			for i := 0; i < 10; i++ {
+				resp, err := http.Get(ts.URL + "/universe")
+				if err == nil {
+					io.Copy(io.Discard, resp.Body)
+					resp.Body.Close()
+				}
+			}
+		}()
+		err := m.Sync(src.URL)
+		<-done
+		if err != nil {
+			t.Fatalf("Expected: nil, got: %v", err)
+		}
+
+		data, _ := get(t, ts.URL+"/universe")
+		var res map[string]map[string]interface{}
+		json.Unmarshal(data, &res)
+		if res["chef-dk"][v] == nil {
+			t.Fatalf("Expected %v to be served after a sync, got: %s", v, data)
+		}
+	}
+}
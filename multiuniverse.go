@@ -0,0 +1,173 @@
+// Author:: Jonathan Hartman (<j@p4nt5.com>)
+//
+// Copyright (C) 2014, Jonathan Hartman
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package goulash implements a Go client library for the Chef Supermarket API.
+
+This file defines a MultiUniverse struct, which composes several Universes in
+priority order the way a Berksfile with more than one source does, e.g. an
+internal Supermarket ahead of the public one. Each version of a cookbook comes
+from the first source that has it.
+*/
+package goulash
+
+import (
+	"sort"
+
+	"github.com/RoboticCheese/goulash/universe"
+)
+
+// Lookup is implemented by anything cookbooks can be looked up in by name,
+// so code that only reads cookbooks can run over a Universe or a
+// MultiUniverse.
+type Lookup interface {
+	Cookbook(name string) *universe.Cookbook
+	CookbookNames() []string
+	Len() int
+}
+
+var _ Lookup = (*Universe)(nil)
+
+// MultiUniverse contains a list of Universes, highest priority first.
+type MultiUniverse struct {
+	Sources []*Universe
+}
+
+var _ Lookup = (*MultiUniverse)(nil)
+
+// NewMultiUniverse generates a MultiUniverse from Universes in priority
+// order.
+func NewMultiUniverse(sources ...*Universe) (m *MultiUniverse) {
+	m = new(MultiUniverse)
+	m.Sources = sources
+	return
+}
+
+// Update updates every source of a MultiUniverse and returns positive and
+// negative diffs of the combined view, as Universe.Update does. Sources with
+// no APIInstance, e.g. ones built locally, are left as they are. Every source
+// is updated even if one fails; the first error is returned.
+func (m *MultiUniverse) Update() (posDiff, negDiff *Universe, err error) {
+	before := m.Snapshot()
+	for _, u := range m.Sources {
+		if u.APIInstance == nil {
+			continue
+		}
+		_, _, uerr := u.Update()
+		if err == nil {
+			err = uerr
+		}
+	}
+	posDiff, negDiff = before.Diff(m.Snapshot())
+	return
+}
+
+// Snapshot returns a single Universe combining the current snapshots of
+// every source. Neither it nor anything it points to may be modified.
+func (m *MultiUniverse) Snapshot() (snap *Universe) {
+	snap = InitUniverse()
+	for _, u := range m.Sources {
+		for name, uc := range u.Snapshot().Cookbooks {
+			c := snap.Cookbooks[name]
+			if c == nil {
+				c = universe.NewCookbook()
+				c.Name = name
+				snap.Cookbooks[name] = c
+			}
+			for v, cv := range uc.Versions {
+				if _, ok := c.Versions[v]; !ok {
+					c.Versions[v] = cv
+				}
+			}
+		}
+	}
+	return
+}
+
+// Cookbook returns a single Cookbook with every version of it from any
+// source, each from the highest priority source that has it, or nil if no
+// source has it. The versions are shared with the sources and may not be
+// modified.
+func (m *MultiUniverse) Cookbook(name string) (c *universe.Cookbook) {
+	for _, u := range m.Sources {
+		uc := u.Cookbook(name)
+		if uc == nil {
+			continue
+		}
+		if c == nil {
+			c = universe.NewCookbook()
+			c.Name = name
+		}
+		for v, cv := range uc.Versions {
+			if _, ok := c.Versions[v]; !ok {
+				c.Versions[v] = cv
+			}
+		}
+	}
+	return
+}
+
+// Resolve returns a version of a cookbook from the highest priority source
+// that has it, and that source, or nils if no source has it.
+func (m *MultiUniverse) Resolve(name, version string) (cv *universe.CookbookVersion, source *Universe) {
+	for _, u := range m.Sources {
+		uc := u.Cookbook(name)
+		if uc == nil || uc.Versions[version] == nil {
+			continue
+		}
+		return uc.Versions[version], u
+	}
+	return
+}
+
+// Provenance returns the source that every version of a cookbook is taken
+// from, keyed by version string.
+func (m *MultiUniverse) Provenance(name string) (sources map[string]*Universe) {
+	sources = map[string]*Universe{}
+	for _, u := range m.Sources {
+		uc := u.Cookbook(name)
+		if uc == nil {
+			continue
+		}
+		for v := range uc.Versions {
+			if _, ok := sources[v]; !ok {
+				sources[v] = u
+			}
+		}
+	}
+	return
+}
+
+// CookbookNames returns the sorted names of every cookbook in any source.
+func (m *MultiUniverse) CookbookNames() (names []string) {
+	names = []string{}
+	seen := map[string]bool{}
+	for _, u := range m.Sources {
+		for name := range u.Snapshot().Cookbooks {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return
+}
+
+// Len returns the number of cookbooks in any source.
+func (m *MultiUniverse) Len() int {
+	return len(m.CookbookNames())
+}
@@ -0,0 +1,145 @@
+package goulash
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/RoboticCheese/goulash/universe"
+)
+
+func mudata() (internal, public *Universe) {
+	internal = InitUniverse()
+	internal.Cookbooks["chef"] = &universe.Cookbook{
+		Name: "chef",
+		Versions: map[string]*universe.CookbookVersion{
+			"0.12.0": &universe.CookbookVersion{Version: "0.12.0", LocationPath: "https://internal.example.com"},
+			"0.13.0": &universe.CookbookVersion{Version: "0.13.0", LocationPath: "https://internal.example.com"},
+		},
+	}
+	public = InitUniverse()
+	public.Cookbooks["chef"] = &universe.Cookbook{
+		Name: "chef",
+		Versions: map[string]*universe.CookbookVersion{
+			"0.12.0": &universe.CookbookVersion{Version: "0.12.0", LocationPath: "https://supermarket.chef.io"},
+			"0.20.0": &universe.CookbookVersion{Version: "0.20.0", LocationPath: "https://supermarket.chef.io"},
+		},
+	}
+	public.Cookbooks["djbdns"] = &universe.Cookbook{
+		Name: "djbdns",
+		Versions: map[string]*universe.CookbookVersion{
+			"0.7.0": &universe.CookbookVersion{Version: "0.7.0", LocationPath: "https://supermarket.chef.io"},
+		},
+	}
+	return
+}
+
+func TestMultiUniverseLookups(t *testing.T) {
+	internal, public := mudata()
+	m := NewMultiUniverse(internal, public)
+	c := m.Cookbook("chef")
+	for _, i := range [][]interface{}{
+		{m.Len(), 2},
+		{len(m.CookbookNames()), 2},
+		{m.CookbookNames()[0], "chef"},
+		{m.CookbookNames()[1], "djbdns"},
+		{len(c.Versions), 3},
+		{c.Versions["0.12.0"].LocationPath, "https://internal.example.com"},
+		{c.Versions["0.13.0"].LocationPath, "https://internal.example.com"},
+		{c.Versions["0.20.0"].LocationPath, "https://supermarket.chef.io"},
+		{m.Cookbook("djbdns").Versions["0.7.0"].LocationPath, "https://supermarket.chef.io"},
+		{m.Cookbook("nope") == nil, true},
+		{len(NewMultiUniverse().CookbookNames()), 0},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+}
+
+func TestMultiUniverseProvenance(t *testing.T) {
+	internal, public := mudata()
+	m := NewMultiUniverse(internal, public)
+	cv, src := m.Resolve("chef", "0.12.0")
+	cv2, src2 := m.Resolve("chef", "0.20.0")
+	cv3, src3 := m.Resolve("chef", "9.9.9")
+	p := m.Provenance("chef")
+	for _, i := range [][]interface{}{
+		{cv.LocationPath, "https://internal.example.com"},
+		{src, internal},
+		{cv2.LocationPath, "https://supermarket.chef.io"},
+		{src2, public},
+		{cv3 == nil, true},
+		{src3 == nil, true},
+		{len(p), 3},
+		{p["0.12.0"], internal},
+		{p["0.13.0"], internal},
+		{p["0.20.0"], public},
+		{len(m.Provenance("nope")), 0},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+}
+
+func TestMultiUniverseSnapshot(t *testing.T) {
+	internal, public := mudata()
+	m := NewMultiUniverse(internal, public)
+	snap := m.Snapshot()
+	for _, i := range [][]interface{}{
+		{snap.Len(), 2},
+		{snap.Cookbook("chef").Equals(m.Cookbook("chef")), true},
+		{snap.Cookbook("djbdns").Equals(m.Cookbook("djbdns")), true},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+}
+
+func TestMultiUniverseUpdate(t *testing.T) {
+	data := ujsonData()
+	body := func() string {
+		res, _ := json.Marshal(data)
+		return string(res)
+	}
+	ts := StartHTTP(body, nil)
+	defer ts.Close()
+
+	a, _ := NewAPIInstance(ts.URL)
+	public, err := NewUniverse(a)
+	if err != nil {
+		t.Fatalf("Expected no err, got: %v", err)
+	}
+	internal, _ := mudata()
+	m := NewMultiUniverse(internal, public)
+
+	data["chef"]["0.12.0"].LocationType = "elsewhere"
+	data["chef"]["0.21.0"] = &universe.CookbookVersion{LocationType: "opscode"}
+	pos, neg, err := m.Update()
+	if err != nil {
+		t.Fatalf("Expected no err, got: %v", err)
+	}
+	for _, i := range [][]interface{}{
+		// 0.12.0 still comes from the internal source, so nothing changed
+		{pos.Cookbooks["chef"].Versions["0.12.0"] == nil, true},
+		{pos.Cookbooks["chef"].Versions["0.21.0"].LocationType, "opscode"},
+		{neg == nil, true},
+		{m.Cookbook("chef").Versions["0.21.0"] != nil, true},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+}
+
+func TestMultiUniverseUpdateError(t *testing.T) {
+	internal, public := mudata()
+	public.Endpoint = "http://127.0.0.1:1/universe"
+	public.APIInstance = &APIInstance{BaseURL: "http://127.0.0.1:1"}
+	m := NewMultiUniverse(internal, public)
+	_, _, err := m.Update()
+	if err == nil {
+		t.Fatalf("Expected: an error, got: %v", err)
+	}
+}
@@ -0,0 +1,137 @@
+// Author:: Jonathan Hartman (<j@p4nt5.com>)
+//
+// Copyright (C) 2014, Jonathan Hartman
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package proxy implements a caching reverse proxy for a Supermarket.
+
+This file defines the Cache a Proxy stores responses in and an in-memory
+implementation of it. A MemoryCache holds up to a fixed number of bytes and
+evicts the least recently used entries to stay under it.
+*/
+package proxy
+
+import (
+	"container/list"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultCacheSize is the size in bytes of the MemoryCache New gives a
+// Proxy.
+const DefaultCacheSize = 256 << 20
+
+// Entry implements a cached upstream response.
+type Entry struct {
+	Header   http.Header
+	Body     []byte
+	ETag     string
+	StoredAt time.Time
+}
+
+// Cache implements storage for a Proxy's responses, keyed by request path
+// and query. Implementations must be safe for concurrent use.
+type Cache interface {
+	Get(key string) (e *Entry, ok bool)
+	Set(key string, e *Entry)
+}
+
+// MemoryCache implements a Cache that keeps entries in memory, up to a
+// maximum size.
+type MemoryCache struct {
+	lock     sync.Mutex
+	maxBytes int64
+	size     int64
+	order    *list.List               // Most recently used first
+	entries  map[string]*list.Element // Values are *memoryEntry
+}
+
+// memoryEntry is an Entry in a MemoryCache with the key it's stored under.
+type memoryEntry struct {
+	key   string
+	entry *Entry
+}
+
+// NewMemoryCache generates an empty MemoryCache that holds up to a number of
+// bytes of keys and bodies.
+func NewMemoryCache(maxBytes int64) (c *MemoryCache) {
+	c = new(MemoryCache)
+	c.maxBytes = maxBytes
+	c.order = list.New()
+	c.entries = map[string]*list.Element{}
+	return
+}
+
+// Get returns the Entry stored under a key, if there is one, and marks it
+// as the most recently used.
+func (c *MemoryCache) Get(key string) (e *Entry, ok bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		return
+	}
+	c.order.MoveToFront(el)
+	e = el.Value.(*memoryEntry).entry
+	return
+}
+
+// Set stores an Entry under a key, replacing any already there, and evicts
+// the least recently used entries until the MemoryCache fits in its size.
+// An Entry bigger than that on its own isn't stored.
+func (c *MemoryCache) Set(key string, e *Entry) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+	}
+	size := entrySize(key, e)
+	if size > c.maxBytes {
+		return
+	}
+	c.entries[key] = c.order.PushFront(&memoryEntry{key: key, entry: e})
+	c.size += size
+	for c.size > c.maxBytes {
+		c.remove(c.order.Back())
+	}
+}
+
+// Len returns the number of entries in a MemoryCache.
+func (c *MemoryCache) Len() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return len(c.entries)
+}
+
+// Size returns the number of bytes a MemoryCache holds.
+func (c *MemoryCache) Size() int64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.size
+}
+
+// remove drops an element from a MemoryCache. It must be called with the
+// lock held.
+func (c *MemoryCache) remove(el *list.Element) {
+	me := c.order.Remove(el).(*memoryEntry)
+	delete(c.entries, me.key)
+	c.size -= entrySize(me.key, me.entry)
+}
+
+// entrySize returns the bytes an Entry counts for in a MemoryCache.
+func entrySize(key string, e *Entry) int64 {
+	return int64(len(key) + len(e.Body))
+}
@@ -0,0 +1,54 @@
+package proxy
+
+import (
+	"testing"
+)
+
+func TestMemoryCache(t *testing.T) {
+	c := NewMemoryCache(DefaultCacheSize)
+	_, ok := c.Get("/universe")
+	if ok {
+		t.Fatalf("Expected: %v, got: %v", false, ok)
+	}
+
+	e := &Entry{Body: []byte("{}"), ETag: `"abc"`}
+	c.Set("/universe", e)
+	res, ok := c.Get("/universe")
+	for _, i := range [][]interface{}{
+		{ok, true},
+		{res, e},
+		{c.Len(), 1},
+		{c.Size(), int64(len("/universe{}"))},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+}
+
+func TestMemoryCacheEviction(t *testing.T) {
+	// Each entry is a 2 byte key and an 8 byte body
+	c := NewMemoryCache(30)
+	body := []byte("12345678")
+	c.Set("/a", &Entry{Body: body})
+	c.Set("/b", &Entry{Body: body})
+	c.Set("/c", &Entry{Body: body})
+	c.Get("/a")
+	c.Set("/d", &Entry{Body: body})
+	_, a := c.Get("/a")
+	_, b := c.Get("/b")
+	c.Set("/a", &Entry{Body: []byte("1")})
+	c.Set("/e", &Entry{Body: make([]byte, 31)})
+	_, e := c.Get("/e")
+	for _, i := range [][]interface{}{
+		{a, true},
+		{b, false},
+		{c.Len(), 3},
+		{c.Size(), int64(23)},
+		{e, false},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+}
@@ -0,0 +1,279 @@
+// Author:: Jonathan Hartman (<j@p4nt5.com>)
+//
+// Copyright (C) 2014, Jonathan Hartman
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package proxy implements a caching reverse proxy for a Supermarket.
+
+This file defines a Proxy, an http.Handler that sits in front of a Supermarket
+as a pull-through cache for its API and downloads, e.g.
+
+	p, err := proxy.New("https://supermarket.chef.io")
+	http.ListenAndServe(":8080", p)
+
+GET requests are answered from the cache while an entry is younger than
+MaxAge, and revalidated upstream with the entry's ETag after that. If the
+upstream server can't be reached or fails with a 5xx, the cached entry is
+served anyway. Every other request is passed through uncached. URLs pointing
+at the upstream server in JSON responses are rewritten to point at the Proxy,
+so downloads go through it too.
+*/
+package proxy
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/RoboticCheese/goulash/internal/apiserve"
+)
+
+// Stats implements a count of how a Proxy has answered GET requests.
+type Stats struct {
+	Hits        int64 // Served from the cache without asking upstream
+	Revalidated int64 // Served from the cache after upstream said it's unchanged
+	Misses      int64 // Fetched from upstream
+	Stale       int64 // Served from the cache because upstream failed
+	Errors      int64 // Failed with nothing cached to fall back on
+}
+
+// Proxy implements a caching reverse proxy for a Supermarket.
+type Proxy struct {
+	Upstream string        // The Supermarket's base URL
+	BaseURL  string        // Where the Proxy is served; empty uses each request's host
+	Cache    Cache         // Where responses are stored
+	Client   *http.Client  // Used to make upstream requests
+	MaxAge   time.Duration // How long to serve an entry before revalidating it
+	hits     atomic.Int64
+	reval    atomic.Int64
+	misses   atomic.Int64
+	stale    atomic.Int64
+	errs     atomic.Int64
+}
+
+// New generates a Proxy for an upstream Supermarket with an empty
+// MemoryCache of DefaultCacheSize that revalidates every request.
+func New(upstream string) (p *Proxy, err error) {
+	u, err := url.Parse(upstream)
+	if err != nil {
+		return
+	}
+	if u.Scheme == "" || u.Host == "" {
+		err = errors.New("upstream URL must be absolute: " + upstream)
+		return
+	}
+	p = new(Proxy)
+	p.Upstream = strings.TrimSuffix(upstream, "/")
+	p.Cache = NewMemoryCache(DefaultCacheSize)
+	p.Client = http.DefaultClient
+	return
+}
+
+// Stats returns how the Proxy has answered GET requests so far.
+func (p *Proxy) Stats() (s Stats) {
+	s.Hits = p.hits.Load()
+	s.Revalidated = p.reval.Load()
+	s.Misses = p.misses.Load()
+	s.Stale = p.stale.Load()
+	s.Errors = p.errs.Load()
+	return
+}
+
+// ServeHTTP proxies a request to the upstream Supermarket, through the cache
+// for GET and HEAD requests.
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		p.passThrough(w, r)
+		return
+	}
+	key := r.URL.Path
+	if r.URL.RawQuery != "" {
+		key += "?" + r.URL.RawQuery
+	}
+
+	e, cached := p.Cache.Get(key)
+	status := "HIT"
+	switch {
+	case cached && time.Since(e.StoredAt) < p.MaxAge:
+		p.hits.Add(1)
+	default:
+		var prev *Entry
+		if cached {
+			prev = e
+		}
+		cur, revalidated, err := p.fetch(r, key, prev)
+		switch {
+		case err == nil && revalidated:
+			p.reval.Add(1)
+			status = "REVALIDATED"
+			e = cur
+		case err == nil:
+			p.misses.Add(1)
+			status = "MISS"
+			e = cur
+		case cached && unavailable(err):
+			p.stale.Add(1)
+			status = "STALE"
+		default:
+			p.errs.Add(1)
+			var upstream *upstreamError
+			if errors.As(err, &upstream) {
+				http.Error(w, http.StatusText(upstream.status), upstream.status)
+			} else {
+				http.Error(w, err.Error(), http.StatusBadGateway)
+			}
+			return
+		}
+	}
+	p.write(w, r, e, status)
+}
+
+// upstreamError implements an unsuccessful response from upstream.
+type upstreamError struct {
+	status int
+}
+
+func (e *upstreamError) Error() string {
+	return http.StatusText(e.status)
+}
+
+// unavailable checks whether an error from fetch means upstream is down, as
+// opposed to it answering that something doesn't exist.
+func unavailable(err error) bool {
+	var upstream *upstreamError
+	return !errors.As(err, &upstream) || upstream.status >= 500
+}
+
+// fetch gets a response from upstream, revalidating a previous Entry if
+// there is one, and stores it in the cache. Redirects are followed, so a
+// download is cached under the path it was requested with.
+func (p *Proxy) fetch(r *http.Request, key string, prev *Entry) (e *Entry, revalidated bool, err error) {
+	req, err := http.NewRequestWithContext(r.Context(), "GET", p.Upstream+key, nil)
+	if err != nil {
+		return
+	}
+	if prev != nil && prev.ETag != "" {
+		req.Header.Set("If-None-Match", prev.ETag)
+	}
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && prev != nil:
+		revalidated = true
+		e = &Entry{Header: prev.Header, Body: prev.Body, ETag: prev.ETag}
+	case resp.StatusCode == http.StatusOK:
+		e = &Entry{Header: http.Header{}, ETag: resp.Header.Get("ETag")}
+		for _, h := range []string{"Content-Type", "ETag", "Last-Modified"} {
+			if v := resp.Header.Get(h); v != "" {
+				e.Header.Set(h, v)
+			}
+		}
+		e.Body, err = io.ReadAll(resp.Body)
+		if err != nil {
+			return
+		}
+	default:
+		err = &upstreamError{status: resp.StatusCode}
+		return
+	}
+	e.StoredAt = time.Now()
+	p.Cache.Set(key, e)
+	return
+}
+
+// write sends a cached Entry to the client, rewriting upstream URLs in JSON.
+// A rewritten body depends on the URL the Proxy is reached at, so it gets its
+// own ETag instead of the upstream one.
+func (p *Proxy) write(w http.ResponseWriter, r *http.Request, e *Entry, status string) {
+	for h, v := range e.Header {
+		w.Header()[h] = v
+	}
+	w.Header().Set("X-Cache", status)
+	if status == "STALE" {
+		w.Header().Set("Warning", `110 - "Response is Stale"`)
+	}
+	contentType := e.Header.Get("Content-Type")
+	if strings.HasPrefix(contentType, "application/json") {
+		body := bytes.ReplaceAll(e.Body, []byte(p.Upstream), []byte(apiserve.BaseURL(p.BaseURL, r)))
+		apiserve.Write(w, r, body, contentType)
+		return
+	}
+	if e.ETag != "" && r.Header.Get("If-None-Match") == e.ETag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Write(e.Body)
+}
+
+// passThrough forwards a request upstream without caching it.
+func (p *Proxy) passThrough(w http.ResponseWriter, r *http.Request) {
+	req, err := http.NewRequestWithContext(r.Context(), r.Method, p.Upstream+r.URL.RequestURI(), r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	req.Header = r.Header.Clone()
+	removeHopHeaders(req.Header)
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+	removeHopHeaders(resp.Header)
+	for h, v := range resp.Header {
+		w.Header()[h] = v
+	}
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+}
+
+// hopHeaders are the headers that only apply to a single connection, so a
+// proxy mustn't forward them.
+var hopHeaders = []string{
+	"Connection",
+	"Proxy-Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// removeHopHeaders deletes the hop-by-hop headers from a set of headers,
+// including any the Connection header names.
+func removeHopHeaders(h http.Header) {
+	for _, v := range h.Values("Connection") {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				h.Del(name)
+			}
+		}
+	}
+	for _, name := range hopHeaders {
+		h.Del(name)
+	}
+}
@@ -0,0 +1,265 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RoboticCheese/goulash"
+	"github.com/RoboticCheese/goulash/goulashtest"
+)
+
+func upstream() (s *goulashtest.Server) {
+	s = goulashtest.NewServer()
+	s.AddCookbook(&goulash.Cookbook{Name: "chef-dk"},
+		&goulash.CookbookVersion{Version: "2.0.0"})
+	s.AddTarball("chef-dk", "2.0.0", []byte("chef-dk 2.0.0"))
+	return
+}
+
+func start(t *testing.T, s *goulashtest.Server) (p *Proxy, ts *httptest.Server) {
+	p, err := New(s.URL)
+	if err != nil {
+		t.Fatalf("Expected: nil, got: %v", err)
+	}
+	ts = httptest.NewServer(p)
+	return
+}
+
+func get(t *testing.T, url string) (body, cache string, status int) {
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("Expected: nil, got: %v", err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	body = string(data)
+	cache = resp.Header.Get("X-Cache")
+	status = resp.StatusCode
+	return
+}
+
+func TestProxyRevalidates(t *testing.T) {
+	s := upstream()
+	defer s.Close()
+	p, ts := start(t, s)
+	defer ts.Close()
+
+	_, first, _ := get(t, ts.URL+"/universe")
+	_, second, _ := get(t, ts.URL+"/universe")
+	s.AddCookbookVersion("chef-dk", &goulash.CookbookVersion{Version: "2.1.0"})
+	body, third, _ := get(t, ts.URL+"/universe")
+	for _, i := range [][]interface{}{
+		{first, "MISS"},
+		{second, "REVALIDATED"},
+		{third, "MISS"},
+		{strings.Contains(body, "2.1.0"), true},
+		{p.Stats(), Stats{Revalidated: 1, Misses: 2}},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+}
+
+func TestProxyMaxAge(t *testing.T) {
+	s := upstream()
+	defer s.Close()
+	p, ts := start(t, s)
+	defer ts.Close()
+	p.MaxAge = time.Hour
+
+	get(t, ts.URL+"/universe")
+	before := s.Requests()
+	_, cache, _ := get(t, ts.URL+"/universe")
+	for _, i := range [][]interface{}{
+		{cache, "HIT"},
+		{s.Requests(), before},
+		{p.Stats(), Stats{Hits: 1, Misses: 1}},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+}
+
+func TestProxyStale(t *testing.T) {
+	s := upstream()
+	defer s.Close()
+	p, ts := start(t, s)
+	defer ts.Close()
+
+	body, _, _ := get(t, ts.URL+"/universe")
+	s.Inject(goulashtest.Fault{Status: http.StatusServiceUnavailable})
+	stale, cache, status := get(t, ts.URL+"/universe")
+	_, _, missing := get(t, ts.URL+"/api/v1/cookbooks/chef-dk")
+	s.Close()
+	_, down, _ := get(t, ts.URL+"/universe")
+	_, _, unreachable := get(t, ts.URL+"/api/v1/cookbooks/chef-dk")
+	for _, i := range [][]interface{}{
+		{stale, body},
+		{cache, "STALE"},
+		{status, http.StatusOK},
+		{missing, http.StatusServiceUnavailable},
+		{down, "STALE"},
+		{unreachable, http.StatusBadGateway},
+		{p.Stats(), Stats{Misses: 1, Stale: 2, Errors: 2}},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+}
+
+func TestProxyNotFound(t *testing.T) {
+	s := upstream()
+	defer s.Close()
+	_, ts := start(t, s)
+	defer ts.Close()
+
+	get(t, ts.URL+"/api/v1/cookbooks/chef-dk")
+	s.RemoveCookbook("chef-dk")
+	_, _, status := get(t, ts.URL+"/api/v1/cookbooks/chef-dk")
+	if status != http.StatusNotFound {
+		t.Fatalf("Expected: %v, got: %v", http.StatusNotFound, status)
+	}
+}
+
+func TestProxyRewritesURLs(t *testing.T) {
+	s := upstream()
+	defer s.Close()
+	_, ts := start(t, s)
+	defer ts.Close()
+
+	i, err := goulash.NewAPIInstance(ts.URL)
+	if err != nil {
+		t.Fatalf("Expected: nil, got: %v", err)
+	}
+	u, err := goulash.NewUniverse(i)
+	if err != nil {
+		t.Fatalf("Expected: nil, got: %v", err)
+	}
+	cv := u.Cookbook("chef-dk").Versions["2.0.0"]
+	tarball, _, _ := get(t, cv.DownloadURL)
+	for _, i := range [][]interface{}{
+		{cv.LocationPath, ts.URL + "/api/v1"},
+		{cv.DownloadURL, ts.URL + "/api/v1/cookbooks/chef-dk/versions/2.0.0/download"},
+		{tarball, "chef-dk 2.0.0"},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+}
+
+func TestProxyPassThrough(t *testing.T) {
+	s := upstream()
+	defer s.Close()
+	p, ts := start(t, s)
+	defer ts.Close()
+
+	resp, err := http.Post(ts.URL+"/api/v1/cookbooks", "application/json", nil)
+	if err != nil {
+		t.Fatalf("Expected: nil, got: %v", err)
+	}
+	resp.Body.Close()
+	for _, i := range [][]interface{}{
+		{resp.StatusCode, http.StatusNotFound},
+		{p.Stats(), Stats{}},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+}
+
+func TestProxyRewrittenETag(t *testing.T) {
+	s := upstream()
+	defer s.Close()
+	_, ts := start(t, s)
+	defer ts.Close()
+
+	request := func(host, etag string) (resp *http.Response, body string) {
+		req, _ := http.NewRequest("GET", ts.URL+"/universe", nil)
+		req.Host = host
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Expected: nil, got: %v", err)
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		body = string(data)
+		return
+	}
+	direct, err := http.Get(s.URL + "/universe")
+	if err != nil {
+		t.Fatalf("Expected: nil, got: %v", err)
+	}
+	direct.Body.Close()
+	a, _ := request("a.example.com", "")
+	etag := a.Header.Get("ETag")
+	same, _ := request("a.example.com", etag)
+	other, body := request("b.example.com", etag)
+	for _, i := range [][]interface{}{
+		{etag != "" && etag != direct.Header.Get("ETag"), true},
+		{same.StatusCode, http.StatusNotModified},
+		{other.StatusCode, http.StatusOK},
+		{other.Header.Get("ETag") != etag, true},
+		{strings.Contains(body, "http://b.example.com/api/v1"), true},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+}
+
+func TestProxyPassThroughHopHeaders(t *testing.T) {
+	var received http.Header
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Clone()
+		w.Header().Set("Connection", "X-Hop")
+		w.Header().Set("X-Hop", "1")
+		w.Header().Set("Keep-Alive", "timeout=5")
+		w.Header().Set("X-End", "1")
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer up.Close()
+	p, err := New(up.URL)
+	if err != nil {
+		t.Fatalf("Expected: nil, got: %v", err)
+	}
+	r := httptest.NewRequest("POST", "/api/v1/cookbooks", nil)
+	r.Header.Set("Connection", "X-Client-Hop")
+	r.Header.Set("X-Client-Hop", "1")
+	r.Header.Set("Proxy-Authorization", "secret")
+	r.Header.Set("X-Client-End", "1")
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, r)
+	for _, i := range [][]interface{}{
+		{w.Code, http.StatusCreated},
+		{w.Header().Get("X-End"), "1"},
+		{w.Header().Get("X-Hop"), ""},
+		{w.Header().Get("Keep-Alive"), ""},
+		{w.Header().Get("Connection"), ""},
+		{received.Get("X-Client-End"), "1"},
+		{received.Get("X-Client-Hop"), ""},
+		{received.Get("Proxy-Authorization"), ""},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	_, err := New("supermarket.chef.io")
+	if err == nil {
+		t.Fatalf("Expected: an error, got: %v", err)
+	}
+}
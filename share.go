@@ -0,0 +1,171 @@
+// Author:: Jonathan Hartman (<j@p4nt5.com>)
+//
+// Copyright (C) 2014, Jonathan Hartman
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package goulash implements a Go client library for the Chef Supermarket API.
+
+This file defines sharing a cookbook to a Supermarket the way
+`knife supermarket share` does, with a signed multipart POST of two parts to
+/api/v1/cookbooks:
+
+	cookbook: {"category": "Other"}
+	tarball:  the gzipped tar of the cookbook, e.g. chef-dk/metadata.json...
+*/
+package goulash
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+)
+
+// ErrNoSigner is returned by requests a Supermarket only accepts from a
+// signed in user when the APIInstance has no Signer.
+var ErrNoSigner = errors.New("a Signer is required to make this request")
+
+// ShareCookbook uploads a cookbook tarball into a category and returns the
+// CookbookVersion created. The cookbook's name and version are read from the
+// metadata in the tarball. The APIInstance must have a Signer for the
+// Supermarket user sharing it. A refused upload returns a ValidationError or
+// an APIError. The Context covers both the upload and fetching the new
+// CookbookVersion.
+func (a *APIInstance) ShareCookbook(ctx context.Context, category string, tarball io.Reader) (cv *CookbookVersion, err error) {
+	if a == nil {
+		err = ErrNoAPIInstance
+		return
+	}
+	if a.Signer == nil {
+		err = ErrNoSigner
+		return
+	}
+	data, err := io.ReadAll(tarball)
+	if err != nil {
+		return
+	}
+	md, err := tarballMetadata(data)
+	if err != nil {
+		return
+	}
+
+	body, contentType, err := shareBody(category, md.Name, data)
+	if err != nil {
+		return
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", a.Endpoint+"/cookbooks", body)
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", contentType)
+	resp, err := a.send(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 && resp.StatusCode != 201 {
+		err = newAPIError(resp)
+		return
+	}
+
+	c, err := newCookbook(ctx, a, md.Name)
+	if err != nil {
+		return
+	}
+	cv, err = newCookbookVersion(ctx, c, md.Version)
+	return
+}
+
+// shareBody returns the multipart body of a share and its content type.
+func shareBody(category, name string, tarball []byte) (body *bytes.Buffer, contentType string, err error) {
+	body = new(bytes.Buffer)
+	mw := multipart.NewWriter(body)
+	cookbook, err := json.Marshal(map[string]string{"category": category})
+	if err != nil {
+		return
+	}
+	err = mw.WriteField("cookbook", string(cookbook))
+	if err != nil {
+		return
+	}
+	fw, err := mw.CreateFormFile("tarball", name+".tgz")
+	if err != nil {
+		return
+	}
+	_, err = fw.Write(tarball)
+	if err != nil {
+		return
+	}
+	err = mw.Close()
+	contentType = mw.FormDataContentType()
+	return
+}
+
+// tarballMetadata reads the metadata.json, or else the metadata.rb, in the
+// top-level directory of a gzipped cookbook tarball. A tarball with metadata
+// in more than one top-level directory is rejected.
+func tarballMetadata(data []byte) (md *localMetadata, err error) {
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return
+	}
+	tr := tar.NewReader(gz)
+	var dir string
+	var jsonData, rbData []byte
+	for {
+		var h *tar.Header
+		h, err = tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return
+		}
+		parts := strings.Split(strings.TrimPrefix(h.Name, "./"), "/")
+		if len(parts) != 2 {
+			continue
+		}
+		if parts[1] != "metadata.json" && parts[1] != "metadata.rb" {
+			continue
+		}
+		if dir != "" && parts[0] != dir {
+			err = errors.New("tarball has metadata for more than one cookbook: " + dir + ", " + parts[0])
+			return
+		}
+		dir = parts[0]
+		switch parts[1] {
+		case "metadata.json":
+			jsonData, err = io.ReadAll(tr)
+		case "metadata.rb":
+			rbData, err = io.ReadAll(tr)
+		}
+		if err != nil {
+			return
+		}
+	}
+	if jsonData == nil && rbData == nil {
+		err = errors.New("no cookbook metadata found in tarball")
+		return
+	}
+	md, err = decodeMetadata(dir, jsonData, rbData)
+	return
+}
@@ -0,0 +1,231 @@
+package goulash
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func cookbookTarball(t *testing.T, files map[string]string) []byte {
+	buf := new(bytes.Buffer)
+	gz := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gz)
+	for name, data := range files {
+		err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data))})
+		if err != nil {
+			t.Fatalf("Expected no err, got: %v", err)
+		}
+		tw.Write([]byte(data))
+	}
+	tw.Close()
+	gz.Close()
+	return buf.Bytes()
+}
+
+// startShareServer starts a Supermarket that takes signed shares of chef-dk
+// 2.0.0 and records the category and tarball of each one.
+func startShareServer(t *testing.T, shared map[string]string) (ts *httptest.Server) {
+	ts = StartHTTP(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/cookbooks":
+			body, _ := io.ReadAll(r.Body)
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			if r.Method != "POST" || verifySignature(&signerKey(t).PublicKey, r) != nil {
+				w.WriteHeader(401)
+				fmt.Fprint(w, `{"error_code": "UNAUTHORIZED", "error_messages": ["Bad signature"]}`)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			f, h, err := r.FormFile("tarball")
+			if err != nil {
+				w.WriteHeader(400)
+				fmt.Fprint(w, `{"error_code": "INVALID_DATA", "error_messages": ["Multipart POST must include a part named 'tarball'"]}`)
+				return
+			}
+			tarball, _ := io.ReadAll(f)
+			if shared["tarball"] == string(tarball) {
+				w.WriteHeader(409)
+				fmt.Fprint(w, `{"error_code": "INVALID_DATA", "error_messages": ["Version already exists"]}`)
+				return
+			}
+			shared["cookbook"] = r.FormValue("cookbook")
+			shared["filename"] = h.Filename
+			shared["tarball"] = string(tarball)
+			w.WriteHeader(201)
+			fmt.Fprint(w, `{"uri": "`+ts.URL+`/api/v1/cookbooks/chef-dk"}`)
+		case "/api/v1/cookbooks/chef-dk":
+			fmt.Fprint(w, cjsonified())
+		case "/api/v1/cookbooks/chef-dk/versions/2.0.0":
+			fmt.Fprint(w, cvjsonified())
+		}
+	}, nil)
+	return
+}
+
+func TestShareCookbook(t *testing.T) {
+	shared := map[string]string{}
+	ts := startShareServer(t, shared)
+	defer ts.Close()
+	a, _ := NewAPIInstance(ts.URL)
+	a.Signer, _ = NewSigner("me", pkcs1PEM(t), SignVersion10)
+	tarball := cookbookTarball(t, map[string]string{
+		"chef-dk/metadata.json": `{"name": "chef-dk", "version": "2.0.0"}`,
+		"chef-dk/README.md":     "# chef-dk",
+	})
+
+	cv, err := a.ShareCookbook(context.Background(), "Other", bytes.NewReader(tarball))
+	if err != nil {
+		t.Fatalf("Expected no err, got: %v", err)
+	}
+	for _, i := range [][]interface{}{
+		{shared["cookbook"], `{"category":"Other"}`},
+		{shared["filename"], "chef-dk.tgz"},
+		{shared["tarball"], string(tarball)},
+		{cv.Endpoint, ts.URL + "/api/v1/cookbooks/chef-dk/versions/2.0.0"},
+		{cv.Version, "2.0.0"},
+		{cv.License, "Apache v2.0"},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+
+	_, err = a.ShareCookbook(context.Background(), "Other", bytes.NewReader(tarball))
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("Expected a ValidationError, got: %v", err)
+	}
+	for _, i := range [][]interface{}{
+		{verr.StatusCode, 409},
+		{verr.Code, "INVALID_DATA"},
+		{verr.Messages[0], "Version already exists"},
+		{err.Error(), "INVALID_DATA: Version already exists"},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+}
+
+func TestShareCookbookErrors(t *testing.T) {
+	shared := map[string]string{}
+	ts := startShareServer(t, shared)
+	defer ts.Close()
+	a, _ := NewAPIInstance(ts.URL)
+	tarball := cookbookTarball(t, map[string]string{
+		"chef-dk/metadata.rb": "name 'chef-dk'\nversion '2.0.0'\n",
+	})
+
+	_, err := a.ShareCookbook(context.Background(), "Other", bytes.NewReader(tarball))
+	if err != ErrNoSigner {
+		t.Fatalf("Expected: %v, got: %v", ErrNoSigner, err)
+	}
+
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	a.Signer, _ = NewSigner("me", pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(key),
+	}), "")
+	_, err = a.ShareCookbook(context.Background(), "Other", bytes.NewReader(tarball))
+	aerr, ok := err.(*APIError)
+	if !ok || aerr.StatusCode != 401 {
+		t.Fatalf("Expected a 401 APIError, got: %v", err)
+	}
+
+	a.Signer, _ = NewSigner("me", pkcs1PEM(t), "")
+	for _, data := range [][]byte{
+		[]byte("not a tarball"),
+		cookbookTarball(t, map[string]string{"chef-dk/README.md": "# chef-dk"}),
+	} {
+		_, err = a.ShareCookbook(context.Background(), "Other", bytes.NewReader(data))
+		if err == nil {
+			t.Fatalf("Expected an error, got: %v", err)
+		}
+	}
+	if shared["tarball"] != "" {
+		t.Fatalf("Expected nothing shared, got: %v", shared)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = a.ShareCookbook(ctx, "Other", bytes.NewReader(tarball))
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected: %v, got: %v", context.Canceled, err)
+	}
+
+	var none *APIInstance
+	_, err = none.ShareCookbook(context.Background(), "Other", bytes.NewReader(tarball))
+	if err != ErrNoAPIInstance {
+		t.Fatalf("Expected: %v, got: %v", ErrNoAPIInstance, err)
+	}
+}
+
+func TestShareCookbookContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// The upload succeeds, but the context is canceled while the new
+	// cookbook is being fetched
+	ts := StartHTTP(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "POST":
+			w.WriteHeader(201)
+			fmt.Fprint(w, `{}`)
+		case r.URL.Path == "/api/v1/cookbooks/chef-dk":
+			cancel()
+			<-r.Context().Done()
+		}
+	}, nil)
+	defer ts.Close()
+	a, _ := NewAPIInstance(ts.URL)
+	a.Signer, _ = NewSigner("me", pkcs1PEM(t), "")
+	tarball := cookbookTarball(t, map[string]string{
+		"chef-dk/metadata.json": `{"name": "chef-dk", "version": "2.0.0"}`,
+	})
+
+	_, err := a.ShareCookbook(ctx, "Other", bytes.NewReader(tarball))
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected: %v, got: %v", context.Canceled, err)
+	}
+}
+
+func TestTarballMetadataTwoCookbooks(t *testing.T) {
+	_, err := tarballMetadata(cookbookTarball(t, map[string]string{
+		"chef-dk/metadata.json": `{"name": "chef-dk", "version": "2.0.0"}`,
+		"dmg/metadata.rb":       "name 'dmg'\nversion '2.2.0'\n",
+	}))
+	if err == nil || !strings.Contains(err.Error(), "more than one cookbook") {
+		t.Fatalf("Expected an error, got: %v", err)
+	}
+}
+
+func TestTarballMetadata(t *testing.T) {
+	md, err := tarballMetadata(cookbookTarball(t, map[string]string{
+		"./myapp/metadata.rb":         "version '0.3.0'\ndepends 'dmg'\n",
+		"./myapp/recipes/default.rb":  "",
+		"./myapp/files/metadata.json": "{}",
+	}))
+	if err != nil {
+		t.Fatalf("Expected no err, got: %v", err)
+	}
+	for _, i := range [][]interface{}{
+		{md.Name, "myapp"},
+		{md.Version, "0.3.0"},
+		{md.deps["dmg"], ">= 0.0.0"},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+}
@@ -0,0 +1,207 @@
+// Author:: Jonathan Hartman (<j@p4nt5.com>)
+//
+// Copyright (C) 2014, Jonathan Hartman
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package goulash implements a Go client library for the Chef Supermarket API.
+
+This file defines a Signer, which signs requests the way
+Mixlib::Authentication does so they're accepted by a Chef Server. A signed
+request carries headers like
+
+	X-Ops-Sign: algorithm=sha256;version=1.3
+	X-Ops-Userid: my-client
+	X-Ops-Timestamp: 2014-09-20T04:46:00Z
+	X-Ops-Content-Hash: 47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=
+	X-Ops-Server-API-Version: 1
+	X-Ops-Authorization-1: ...
+	X-Ops-Authorization-2: ...
+
+Protocol version 1.0 signs with SHA-1 and 1.3 with SHA-256.
+*/
+package goulash
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"hash"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The signing protocol versions a Signer supports.
+const (
+	SignVersion10 = "1.0"
+	SignVersion13 = "1.3"
+)
+
+// Signer implements Mixlib::Authentication request signing with a client's
+// RSA private key.
+type Signer struct {
+	ClientName string
+	Key        []byte // A PEM encoded RSA private key, PKCS #1 or PKCS #8
+	Version    string // SignVersion10 or SignVersion13; empty means 1.3
+	now        func() time.Time
+}
+
+// NewSigner initializes and returns a new Signer from a client name, a PEM
+// encoded private key, and a protocol version, checking that the key can be
+// used.
+func NewSigner(clientName string, pemKey []byte, version string) (s *Signer, err error) {
+	if version != "" && version != SignVersion10 && version != SignVersion13 {
+		err = errors.New("unsupported signing protocol version: " + version)
+		return
+	}
+	s = &Signer{ClientName: clientName, Key: pemKey, Version: version}
+	_, err = s.privateKey()
+	if err != nil {
+		s = nil
+	}
+	return
+}
+
+// privateKey parses a Signer's PEM encoded key.
+func (s *Signer) privateKey() (key *rsa.PrivateKey, err error) {
+	block, _ := pem.Decode(s.Key)
+	if block == nil {
+		err = errors.New("no PEM data found in private key")
+		return
+	}
+	key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err == nil {
+		return
+	}
+	pkey, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return
+	}
+	key, ok := pkey.(*rsa.PrivateKey)
+	if !ok {
+		err = errors.New("private key is not an RSA key")
+	}
+	return
+}
+
+// Sign adds the authentication headers to a request. The request's body, if
+// any, is read to hash it and replaced with an identical one.
+func (s *Signer) Sign(req *http.Request) (err error) {
+	version := s.Version
+	if version == "" {
+		version = SignVersion13
+	}
+	key, err := s.privateKey()
+	if err != nil {
+		return
+	}
+	var body []byte
+	if req.Body != nil {
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	now := time.Now
+	if s.now != nil {
+		now = s.now
+	}
+	timestamp := now().UTC().Format("2006-01-02T15:04:05Z")
+
+	var sig []byte
+	switch version {
+	case SignVersion10:
+		contentHash := hashString(sha1.New(), body)
+		req.Header.Set("X-Ops-Sign", "algorithm=sha1;version=1.0;")
+		req.Header.Set("X-Ops-Content-Hash", contentHash)
+		canonical := strings.Join([]string{
+			"Method:" + strings.ToUpper(req.Method),
+			"Hashed Path:" + hashString(sha1.New(), []byte(canonicalPath(req.URL.Path))),
+			"X-Ops-Content-Hash:" + contentHash,
+			"X-Ops-Timestamp:" + timestamp,
+			"X-Ops-UserId:" + s.ClientName,
+		}, "\n")
+		// Version 1.0 signs the canonical request itself, not a digest
+		sig, err = rsa.SignPKCS1v15(nil, key, crypto.Hash(0), []byte(canonical))
+	case SignVersion13:
+		contentHash := hashString(sha256.New(), body)
+		apiVersion := req.Header.Get("X-Ops-Server-API-Version")
+		if apiVersion == "" {
+			apiVersion = "1"
+			req.Header.Set("X-Ops-Server-API-Version", apiVersion)
+		}
+		req.Header.Set("X-Ops-Sign", "algorithm=sha256;version=1.3")
+		req.Header.Set("X-Ops-Content-Hash", contentHash)
+		canonical := strings.Join([]string{
+			"Method:" + strings.ToUpper(req.Method),
+			"Path:" + canonicalPath(req.URL.Path),
+			"X-Ops-Content-Hash:" + contentHash,
+			"X-Ops-Sign:version=1.3",
+			"X-Ops-Timestamp:" + timestamp,
+			"X-Ops-UserId:" + s.ClientName,
+			"X-Ops-Server-API-Version:" + apiVersion,
+		}, "\n")
+		digest := sha256.Sum256([]byte(canonical))
+		sig, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	default:
+		err = errors.New("unsupported signing protocol version: " + version)
+	}
+	if err != nil {
+		return
+	}
+	req.Header.Set("X-Ops-Userid", s.ClientName)
+	req.Header.Set("X-Ops-Timestamp", timestamp)
+	encoded := base64.StdEncoding.EncodeToString(sig)
+	for i := 0; len(encoded) > 0; i++ {
+		n := 60
+		if len(encoded) < n {
+			n = len(encoded)
+		}
+		req.Header.Set("X-Ops-Authorization-"+strconv.Itoa(i+1), encoded[:n])
+		encoded = encoded[n:]
+	}
+	return
+}
+
+// hashString returns the base64 encoded digest of some data.
+func hashString(h hash.Hash, data []byte) string {
+	h.Write(data)
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// repeatedSlashes matches runs of more than one slash in a path.
+var repeatedSlashes = regexp.MustCompile(`/+`)
+
+// canonicalPath collapses repeated slashes in a request path and removes any
+// trailing one.
+func canonicalPath(path string) (res string) {
+	res = repeatedSlashes.ReplaceAllString(path, "/")
+	if len(res) > 1 {
+		res = strings.TrimSuffix(res, "/")
+	}
+	return
+}
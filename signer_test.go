@@ -0,0 +1,320 @@
+package goulash
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var (
+	testKeyOnce sync.Once
+	testKey     *rsa.PrivateKey
+)
+
+func signerKey(t *testing.T) *rsa.PrivateKey {
+	testKeyOnce.Do(func() {
+		var err error
+		testKey, err = rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatalf("Expected no err, got: %v", err)
+		}
+	})
+	return testKey
+}
+
+func pkcs1PEM(t *testing.T) []byte {
+	return pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(signerKey(t)),
+	})
+}
+
+func pkcs8PEM(t *testing.T) []byte {
+	der, err := x509.MarshalPKCS8PrivateKey(signerKey(t))
+	if err != nil {
+		t.Fatalf("Expected no err, got: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+// verifySignature checks a request's signature the way a Chef Server does.
+func verifySignature(pub *rsa.PublicKey, req *http.Request) (err error) {
+	body, _ := io.ReadAll(req.Body)
+	var encoded string
+	for i := 1; req.Header.Get("X-Ops-Authorization-"+strconv.Itoa(i)) != ""; i++ {
+		encoded += req.Header.Get("X-Ops-Authorization-" + strconv.Itoa(i))
+	}
+	sig, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return
+	}
+	user := req.Header.Get("X-Ops-Userid")
+	timestamp := req.Header.Get("X-Ops-Timestamp")
+	contentHash := req.Header.Get("X-Ops-Content-Hash")
+	switch req.Header.Get("X-Ops-Sign") {
+	case "algorithm=sha1;version=1.0;":
+		if contentHash != hashString(sha1.New(), body) {
+			return errors.New("Bad content hash")
+		}
+		canonical := fmt.Sprintf(
+			"Method:%s\nHashed Path:%s\nX-Ops-Content-Hash:%s\nX-Ops-Timestamp:%s\nX-Ops-UserId:%s",
+			req.Method, hashString(sha1.New(), []byte(req.URL.Path)),
+			contentHash, timestamp, user,
+		)
+		err = rsa.VerifyPKCS1v15(pub, crypto.Hash(0), []byte(canonical), sig)
+	case "algorithm=sha256;version=1.3":
+		if contentHash != hashString(sha256.New(), body) {
+			return errors.New("Bad content hash")
+		}
+		canonical := fmt.Sprintf(
+			"Method:%s\nPath:%s\nX-Ops-Content-Hash:%s\nX-Ops-Sign:version=1.3\nX-Ops-Timestamp:%s\nX-Ops-UserId:%s\nX-Ops-Server-API-Version:%s",
+			req.Method, req.URL.Path, contentHash, timestamp, user,
+			req.Header.Get("X-Ops-Server-API-Version"),
+		)
+		digest := sha256.Sum256([]byte(canonical))
+		err = rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig)
+	default:
+		err = errors.New("Unsupported X-Ops-Sign")
+	}
+	return
+}
+
+// startChefServer starts a stand-in Chef Server with one organization that
+// refuses any request not signed by the given key.
+func startChefServer(pub *rsa.PublicKey) (ts *httptest.Server) {
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if verifySignature(pub, r) != nil {
+			http.Error(w, "Failed to authenticate", 401)
+			return
+		}
+		org := ts.URL + "/organizations/myorg"
+		switch r.URL.Path {
+		case "/organizations/myorg":
+			fmt.Fprint(w, `{"name": "myorg"}`)
+		case "/organizations/myorg/universe":
+			fmt.Fprintf(w, `{"chef-dk": {"2.0.1": {
+				"location_type": "chef_server",
+				"location_path": "%s",
+				"download_url": "%s/cookbooks/chef-dk/2.0.1",
+				"dependencies": {"dmg": "~> 2.2"}
+			}}}`, org, org)
+		case "/organizations/myorg/cookbooks/chef-dk":
+			fmt.Fprintf(w, `{"chef-dk": {
+				"url": "%s/cookbooks/chef-dk",
+				"versions": [
+					{"url": "%s/cookbooks/chef-dk/2.0.1", "version": "2.0.1"},
+					{"url": "%s/cookbooks/chef-dk/2.0.0", "version": "2.0.0"}
+				]
+			}}`, org, org, org)
+		case "/organizations/myorg/cookbooks/chef-dk/2.0.1":
+			fmt.Fprint(w, `{
+				"cookbook_name": "chef-dk",
+				"version": "2.0.1",
+				"metadata": {
+					"license": "Apache v2.0",
+					"dependencies": {"dmg": "~> 2.2"}
+				}
+			}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	return
+}
+
+func TestNewSigner(t *testing.T) {
+	s1, err1 := NewSigner("me", pkcs1PEM(t), SignVersion10)
+	s8, err8 := NewSigner("me", pkcs8PEM(t), "")
+	for _, i := range [][]interface{}{
+		{err1, nil},
+		{s1.ClientName, "me"},
+		{s1.Version, SignVersion10},
+		{err8, nil},
+		{s8.Version, ""},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+}
+
+func TestNewSignerErrors(t *testing.T) {
+	for _, i := range [][]interface{}{
+		{[]byte("not a key"), ""},
+		{pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: []byte("junk")}), ""},
+		{pkcs1PEM(t), "1.1"},
+	} {
+		s, err := NewSigner("me", i[0].([]byte), i[1].(string))
+		if err == nil || s != nil {
+			t.Fatalf("Expected an error, got: %v", err)
+		}
+	}
+}
+
+func TestSignerSign(t *testing.T) {
+	for _, version := range []string{SignVersion10, SignVersion13} {
+		s, _ := NewSigner("me", pkcs1PEM(t), version)
+		s.now = func() time.Time {
+			return time.Date(2014, 9, 20, 4, 46, 0, 0, time.FixedZone("PDT", -7*3600))
+		}
+		req, _ := http.NewRequest("POST", "https://example.com//organizations/myorg/", strings.NewReader("{}"))
+		err := s.Sign(req)
+		if err != nil {
+			t.Fatalf("Expected no err, got: %v", err)
+		}
+		body, _ := io.ReadAll(req.Body)
+		// A Chef Server checks the canonical path, not the one requested
+		req.URL.Path = "/organizations/myorg"
+		req.Body = io.NopCloser(strings.NewReader(string(body)))
+		for _, i := range [][]interface{}{
+			{string(body), "{}"},
+			{req.Header.Get("X-Ops-Userid"), "me"},
+			{req.Header.Get("X-Ops-Timestamp"), "2014-09-20T11:46:00Z"},
+			{len(req.Header.Get("X-Ops-Authorization-1")), 60},
+			{req.Header.Get("X-Ops-Authorization-6") != "", true},
+			{req.Header.Get("X-Ops-Authorization-7"), ""},
+			{verifySignature(&signerKey(t).PublicKey, req), nil},
+		} {
+			if i[0] != i[1] {
+				t.Fatalf("%v: Expected: %v, got: %v", version, i[1], i[0])
+			}
+		}
+	}
+}
+
+func TestCanonicalPath(t *testing.T) {
+	for _, i := range [][]interface{}{
+		{canonicalPath("/organizations/myorg"), "/organizations/myorg"},
+		{canonicalPath("//organizations///myorg/"), "/organizations/myorg"},
+		{canonicalPath("/"), "/"},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+}
+
+func TestChefServer(t *testing.T) {
+	ts := startChefServer(&signerKey(t).PublicKey)
+	defer ts.Close()
+	org := ts.URL + "/organizations/myorg"
+
+	for _, version := range []string{SignVersion10, SignVersion13} {
+		s, _ := NewSigner("me", pkcs8PEM(t), version)
+		a, err := NewChefServerAPIInstance(org, s)
+		if err != nil {
+			t.Fatalf("Expected no err, got: %v", err)
+		}
+		u, err := NewUniverse(a)
+		if err != nil {
+			t.Fatalf("Expected no err, got: %v", err)
+		}
+		c, err := NewCookbook(a, "chef-dk")
+		if err != nil {
+			t.Fatalf("Expected no err, got: %v", err)
+		}
+		cv, err := NewCookbookVersion(c, "2.0.1")
+		if err != nil {
+			t.Fatalf("Expected no err, got: %v", err)
+		}
+		for _, i := range [][]interface{}{
+			{a.Endpoint, org},
+			{a.ChefServer, true},
+			{string(a.Clone().Signer.Key), string(s.Key)},
+			{u.Cookbook("chef-dk").Versions["2.0.1"].LocationType, "chef_server"},
+			{u.Cookbook("chef-dk").Versions["2.0.1"].Dependencies["dmg"], "~> 2.2"},
+			{c.Name, "chef-dk"},
+			{c.Endpoint, org + "/cookbooks/chef-dk"},
+			{len(c.Versions), 2},
+			{c.LatestVersion, org + "/cookbooks/chef-dk/2.0.1"},
+			{cv.Endpoint, org + "/cookbooks/chef-dk/2.0.1"},
+			{cv.Version, "2.0.1"},
+			{cv.License, "Apache v2.0"},
+			{cv.Dependencies["dmg"], "~> 2.2"},
+			{cv.Cookbook, org + "/cookbooks/chef-dk"},
+		} {
+			if i[0] != i[1] {
+				t.Fatalf("%v: Expected: %v, got: %v", version, i[1], i[0])
+			}
+		}
+		_, _, err = u.Update()
+		if err != nil {
+			t.Fatalf("Expected no err, got: %v", err)
+		}
+	}
+}
+
+func TestChefServerSnapshot(t *testing.T) {
+	ts := startChefServer(&signerKey(t).PublicKey)
+	defer ts.Close()
+	org := ts.URL + "/organizations/myorg"
+	s, _ := NewSigner("me", pkcs1PEM(t), "")
+	a, _ := NewChefServerAPIInstance(org, s)
+	u, err := NewUniverse(a)
+	if err != nil {
+		t.Fatalf("Expected no err, got: %v", err)
+	}
+	var buf bytes.Buffer
+	u.WriteSnapshot(&buf)
+
+	res, err := ReadSnapshot(&buf)
+	if err != nil {
+		t.Fatalf("Expected no err, got: %v", err)
+	}
+	for _, i := range [][]interface{}{
+		{res.APIInstance.ChefServer, true},
+		{res.APIInstance.Endpoint, org},
+		{res.APIInstance.Signer == nil, true},
+		{res.Endpoint, org + "/universe"},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+	_, _, err = res.Update()
+	if err == nil {
+		t.Fatalf("Expected an error, got: %v", err)
+	}
+	res.APIInstance.Signer = s
+	_, _, err = res.Update()
+	if err != nil {
+		t.Fatalf("Expected no err, got: %v", err)
+	}
+}
+
+func TestChefServerBadSignature(t *testing.T) {
+	ts := startChefServer(&signerKey(t).PublicKey)
+	defer ts.Close()
+	org := ts.URL + "/organizations/myorg"
+
+	other, _ := rsa.GenerateKey(rand.Reader, 2048)
+	key := pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(other),
+	})
+	s, _ := NewSigner("me", key, "")
+	_, err := NewChefServerAPIInstance(org, s)
+	if err == nil {
+		t.Fatalf("Expected an error, got: %v", err)
+	}
+	_, err = NewChefServerAPIInstance(org, nil)
+	if err == nil {
+		t.Fatalf("Expected an error, got: %v", err)
+	}
+}
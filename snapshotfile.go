@@ -0,0 +1,153 @@
+// Author:: Jonathan Hartman (<j@p4nt5.com>)
+//
+// Copyright (C) 2014, Jonathan Hartman
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package goulash implements a Go client library for the Chef Supermarket API.
+
+This file defines saving a Universe to disk and loading it back, so it can be
+kept between process restarts. A snapshot file is gzip-compressed JSON holding
+the universe data and where and when it was fetched, e.g.
+
+	{
+		"source": "https://supermarket.chef.io/universe",
+		"base_url": "https://supermarket.chef.io",
+		"api_version": "1",
+		"etag": "\"b0a3aa07e2d4bb4e0a5a4f5e7b0e3f6c\"",
+		"fetched_at": "2014-09-20T04:46:00.780Z",
+		"universe": {"chef": {"0.12.0": {...}}, ...}
+	}
+
+A universe from a Chef Server also has "chef_server": true. The Signer its
+requests were made with isn't saved.
+*/
+package goulash
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// snapshotFile implements the layout of a saved Universe.
+type snapshotFile struct {
+	Source     string    `json:"source"`
+	BaseURL    string    `json:"base_url"`
+	APIVersion string    `json:"api_version"`
+	ChefServer bool      `json:"chef_server,omitempty"`
+	ETag       string    `json:"etag"`
+	FetchedAt  time.Time `json:"fetched_at"`
+	Universe   *Universe `json:"universe"`
+}
+
+// SaveSnapshot writes the current snapshot of a Universe to a file, replacing
+// it atomically if it already exists. The file is left readable by everyone,
+// as os.CreateTemp would otherwise make it private to its owner.
+func (u *Universe) SaveSnapshot(path string) (err error) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return
+	}
+	defer os.Remove(tmp.Name())
+
+	err = tmp.Chmod(0644)
+	if err == nil {
+		err = u.WriteSnapshot(tmp)
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return
+	}
+	err = os.Rename(tmp.Name(), path)
+	return
+}
+
+// WriteSnapshot writes the current snapshot of a Universe to a writer in the
+// snapshot file format.
+func (u *Universe) WriteSnapshot(w io.Writer) (err error) {
+	snap := u.Snapshot()
+	f := snapshotFile{
+		Source:    snap.Endpoint,
+		ETag:      snap.ETag,
+		FetchedAt: snap.fetchedAt,
+		Universe:  snap,
+	}
+	if snap.APIInstance != nil {
+		f.BaseURL = snap.APIInstance.BaseURL
+		f.APIVersion = snap.APIInstance.Version
+		f.ChefServer = snap.APIInstance.ChefServer
+	}
+	gz := gzip.NewWriter(w)
+	err = json.NewEncoder(gz).Encode(&f)
+	if cerr := gz.Close(); err == nil {
+		err = cerr
+	}
+	return
+}
+
+// LoadSnapshot reads a Universe from a file written by SaveSnapshot. The
+// result can be updated like a freshly fetched one; if the server's ETag
+// hasn't changed since the snapshot was saved, its first Update won't have to
+// download anything. The Signer isn't saved, so one the source needs, e.g. a
+// Chef Server, has to be set on the result's APIInstance again before it's
+// updated.
+func LoadSnapshot(path string) (u *Universe, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	u, err = ReadSnapshot(f)
+	return
+}
+
+// ReadSnapshot reads a Universe from a reader in the snapshot file format. As
+// with LoadSnapshot, any Signer has to be set again.
+func ReadSnapshot(r io.Reader) (u *Universe, err error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return
+	}
+	defer gz.Close()
+
+	f := snapshotFile{Universe: InitUniverse()}
+	err = json.NewDecoder(gz).Decode(&f)
+	if err != nil {
+		return
+	}
+	u = f.Universe
+	if u == nil {
+		u = InitUniverse()
+	}
+	u.Endpoint = f.Source
+	u.ETag = f.ETag
+	u.fetchedAt = f.FetchedAt
+	if f.BaseURL != "" {
+		u.APIInstance = InitAPIInstance()
+		u.APIInstance.BaseURL = f.BaseURL
+		u.APIInstance.Version = f.APIVersion
+		u.APIInstance.Endpoint = f.BaseURL + "/api/v" + f.APIVersion
+		if f.ChefServer {
+			u.APIInstance.ChefServer = true
+			u.APIInstance.Endpoint = f.BaseURL
+		}
+	}
+	return
+}
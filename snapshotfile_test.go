@@ -0,0 +1,117 @@
+package goulash
+
+import (
+	"bytes"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+func TestUniverseSaveLoadSnapshot(t *testing.T) {
+	ts := StartHTTP(uwireJSON, map[string]string{"ETag": "tag1"})
+	defer ts.Close()
+	a, err := NewAPIInstance(ts.URL)
+	if err != nil {
+		t.Fatalf("Expected no err, got: %v", err)
+	}
+	u, err := NewUniverse(a)
+	if err != nil {
+		t.Fatalf("Expected no err, got: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "universe.json.gz")
+	err = u.SaveSnapshot(path)
+	if err != nil {
+		t.Fatalf("Expected no err, got: %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	info, _ := os.Stat(path)
+	res, err := LoadSnapshot(path)
+	if err != nil {
+		t.Fatalf("Expected no err, got: %v", err)
+	}
+	for _, i := range [][]interface{}{
+		{bytes.HasPrefix(data, []byte{0x1f, 0x8b}), true},
+		{info.Mode().Perm(), os.FileMode(0644)},
+		{res.Endpoint, ts.URL + "/universe"},
+		{res.ETag, "tag1"},
+		{res.FetchedAt().IsZero(), false},
+		{res.FetchedAt().Equal(u.FetchedAt()), true},
+		{res.APIInstance.BaseURL, ts.URL},
+		{res.APIInstance.Endpoint, a.Endpoint},
+		{res.Len(), 2},
+		{res.Hash(), u.Hash()},
+		{res.Cookbook("chef").Versions["0.20.0"].Version, "0.20.0"},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+}
+
+func TestLoadSnapshotUpdateETagShortCircuit(t *testing.T) {
+	var gets int32
+	var etag atomic.Value
+	etag.Store("tag1")
+	ts := StartHTTP(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", etag.Load().(string))
+		if r.Method == "GET" {
+			atomic.AddInt32(&gets, 1)
+		}
+		w.Write([]byte(uwireJSON))
+	}, nil)
+	defer ts.Close()
+	a, err := NewAPIInstance(ts.URL)
+	if err != nil {
+		t.Fatalf("Expected no err, got: %v", err)
+	}
+	u, err := NewUniverse(a)
+	if err != nil {
+		t.Fatalf("Expected no err, got: %v", err)
+	}
+	var buf bytes.Buffer
+	err = u.WriteSnapshot(&buf)
+	if err != nil {
+		t.Fatalf("Expected no err, got: %v", err)
+	}
+	res, err := ReadSnapshot(&buf)
+	if err != nil {
+		t.Fatalf("Expected no err, got: %v", err)
+	}
+
+	before := atomic.LoadInt32(&gets)
+	pos, neg, err := res.Update()
+	for _, i := range [][]interface{}{
+		{err, nil},
+		{pos, (*Universe)(nil)},
+		{neg, (*Universe)(nil)},
+		{atomic.LoadInt32(&gets), before},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+
+	etag.Store("tag2")
+	_, _, err = res.Update()
+	if err != nil {
+		t.Fatalf("Expected no err, got: %v", err)
+	}
+	if atomic.LoadInt32(&gets) != before+1 {
+		t.Fatalf("Expected a download after the ETag changed, got: %v", gets-before)
+	}
+}
+
+func TestLoadSnapshotErrors(t *testing.T) {
+	dir := t.TempDir()
+	_, err := LoadSnapshot(filepath.Join(dir, "missing"))
+	if err == nil {
+		t.Fatalf("Expected an error for a missing file")
+	}
+	_, err = ReadSnapshot(bytes.NewBufferString("not gzip"))
+	if err == nil {
+		t.Fatalf("Expected an error for a non-gzip file")
+	}
+}
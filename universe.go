@@ -70,36 +70,61 @@ https://supermarket.chef.io/universe =>
 		...
 	},
 	...
+
+A Universe is safe for concurrent use through its methods. Update never
+modifies a snapshot other goroutines may be reading; it builds a new snapshot
+of the universe and atomically swaps it in. Readers should go through
+Snapshot() or the lookup methods, which always see one complete snapshot.
 */
 package goulash
 
 import (
+	"context"
 	"encoding/json"
 	"io"
-	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/RoboticCheese/goulash/common"
 	"github.com/RoboticCheese/goulash/universe"
 )
 
 // Universe contains a Cookbooks map of cookbook name strings to Cookbook items.
+//
+// Update sets the exported fields to the updated data, as it always has, but
+// reading them while another goroutine calls Update isn't safe. Concurrent
+// readers should go through Snapshot() or the lookup methods instead. The
+// Cookbooks map after an Update is shared with the snapshot and mustn't be
+// modified.
 type Universe struct {
 	Component
 	APIInstance *APIInstance
 	Cookbooks   map[string]*universe.Cookbook
+	snapshot    atomic.Pointer[Universe]
+	updateLock  sync.Mutex
+	// fieldsLock orders Update setting the exported fields with Snapshot
+	// reading them before the first Update
+	fieldsLock sync.Mutex
+	// hashes caches the Hash of each cookbook in a snapshot stored by Update
+	hashes    map[string]string
+	fetchedAt time.Time
 }
 
+var _ common.Supermarketer[*Universe] = (*Universe)(nil)
+
 // NewUniverse accepts a pointer to an APIInstance struct and uses it to
 // initialize and return a pointer to a new Universe struct.
 func NewUniverse(i *APIInstance) (u *Universe, err error) {
 	u = InitUniverse()
 	u.APIInstance = i
-	u.Component, err = NewComponent(u.APIInstance.BaseURL + "/universe")
+	u.Component, err = newComponent(context.Background(), i, u.APIInstance.BaseURL+"/universe")
 	if err != nil {
 		return
 	}
 
-	resp, err := http.Get(u.Endpoint)
+	resp, err := i.get(context.Background(), u.Endpoint)
 	if err != nil {
 		return
 	}
@@ -113,6 +138,7 @@ func NewUniverse(i *APIInstance) (u *Universe, err error) {
 	if err != nil {
 		return
 	}
+	u.fetchedAt = time.Now()
 	// Fill in the Universe struct with the JSON data gathered above
 	for cbName, cb := range tempU {
 		u.Cookbooks[cbName] = universe.NewCookbook()
@@ -132,57 +158,237 @@ func InitUniverse() (u *Universe) {
 	return
 }
 
+// Snapshot returns the current, immutable snapshot of a Universe, or nil for
+// a nil Universe. Neither the snapshot nor anything it points to may be
+// modified.
+func (u *Universe) Snapshot() (snap *Universe) {
+	if u == nil {
+		return
+	}
+	snap = u.snapshot.Load()
+	if snap != nil {
+		return
+	}
+	u.fieldsLock.Lock()
+	defer u.fieldsLock.Unlock()
+	snap = u.snapshot.Load()
+	if snap == nil {
+		// Never updated, so the exported fields are still current
+		snap = &Universe{
+			Component:   u.Component,
+			APIInstance: u.APIInstance,
+			Cookbooks:   u.Cookbooks,
+			fetchedAt:   u.fetchedAt,
+		}
+	}
+	return
+}
+
+// FetchedAt returns the time the current snapshot of a Universe was
+// downloaded, or the zero time if it wasn't.
+func (u *Universe) FetchedAt() time.Time {
+	return u.Snapshot().fetchedAt
+}
+
+// Cookbook returns a single Cookbook from the current snapshot of a Universe,
+// or nil if it doesn't exist.
+func (u *Universe) Cookbook(name string) *universe.Cookbook {
+	return u.Snapshot().Cookbooks[name]
+}
+
+// CookbookNames returns the sorted names of every cookbook in the current
+// snapshot of a Universe.
+func (u *Universe) CookbookNames() (names []string) {
+	cookbooks := u.Snapshot().Cookbooks
+	names = make([]string, 0, len(cookbooks))
+	for name := range cookbooks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return
+}
+
+// Len returns the number of cookbooks in the current snapshot of a Universe.
+func (u *Universe) Len() int {
+	return len(u.Snapshot().Cookbooks)
+}
+
 // Empty checks whether a Universe struct has been populated with anything or
 // still holds all the base defaults.
 func (u *Universe) Empty() (empty bool) {
-	empty = common.Empty(u)
+	empty = common.Empty(u.Snapshot())
 	return
 }
 
 // Equals implements an equality test for a Universe.
-func (u *Universe) Equals(u2 *Universe) (res bool) {
-	res = common.Equals(u, u2)
+func (u *Universe) Equals(u2 *Universe, opts ...common.Option) (res bool) {
+	res = common.Equals(u.Snapshot(), u2.Snapshot(), opts...)
 	return
 }
 
 // Update refreshes a Universe struct and returns the diff of the original
-// Universe and the updated one.
+// Universe and the updated one. Concurrent calls are serialized, and readers
+// see either the old snapshot or the new one, never a mix of the two. If the
+// server doesn't send an ETag, cookbook content hashes are used to limit the
+// diff to the cookbooks that changed.
 func (u *Universe) Update() (posDiff, negDiff *Universe, err error) {
+	u.updateLock.Lock()
+	defer u.updateLock.Unlock()
+
+	cur := u.Snapshot()
+	if cur.APIInstance == nil {
+		err = ErrNoAPIInstance
+		return
+	}
 	// Try to use the HTTP ETag header first; don't download the entire
 	// universe JSON if we don't need to.
-	if u.ETag != "" {
+	if cur.ETag != "" {
 		// Fall through to the regular compare if there's an error
-		tmp, _ := NewComponent(u.Endpoint)
-		if tmp.ETag != "" && tmp.ETag == u.ETag {
+		tmp, _ := newComponent(context.Background(), cur.APIInstance, cur.Endpoint)
+		if tmp.ETag != "" && tmp.ETag == cur.ETag {
 			return
 		}
 	}
 
-	curU, err := NewUniverse(u.APIInstance)
+	curU, err := NewUniverse(cur.APIInstance)
 	if err != nil {
 		return
 	}
-	posDiff, negDiff = u.Diff(curU)
-	*u = *curU
+	// Only deep-diff the cookbooks whose content hashes have changed
+	curU.hashes, _ = universe.HashCookbooks(curU.Cookbooks)
+	oldHashes := cur.cookbookHashes()
+	oldSub := &Universe{Component: cur.Component, APIInstance: cur.APIInstance}
+	oldSub.Cookbooks = map[string]*universe.Cookbook{}
+	for name, h := range oldHashes {
+		if curU.hashes[name] != h {
+			oldSub.Cookbooks[name] = cur.Cookbooks[name]
+		}
+	}
+	curSub := &Universe{Component: curU.Component, APIInstance: curU.APIInstance}
+	curSub.Cookbooks = map[string]*universe.Cookbook{}
+	for name, h := range curU.hashes {
+		if oldHashes[name] != h {
+			curSub.Cookbooks[name] = curU.Cookbooks[name]
+		}
+	}
+	posDiff, negDiff = oldSub.Diff(curSub)
+	u.fieldsLock.Lock()
+	u.snapshot.Store(curU)
+	u.Component = curU.Component
+	u.APIInstance = curU.APIInstance
+	u.Cookbooks = curU.Cookbooks
+	u.fetchedAt = curU.fetchedAt
+	u.fieldsLock.Unlock()
+	return
+}
+
+// Hash returns a fingerprint of the cookbook data in the current snapshot of
+// a Universe. The Component and APIInstance fields aren't included, so two
+// Universes fetched at different times with the same cookbooks have the same
+// Hash.
+func (u *Universe) Hash() (res string) {
+	_, res = universe.HashCookbooks(u.Snapshot().Cookbooks)
+	return
+}
+
+// cookbookHashes returns the Hash of each cookbook in a snapshot, using the
+// ones cached by Update if there are any.
+func (u *Universe) cookbookHashes() (hashes map[string]string) {
+	hashes = u.hashes
+	if hashes == nil {
+		hashes, _ = universe.HashCookbooks(u.Cookbooks)
+	}
 	return
 }
 
 // Diff returns any attributes that have changed from one Universe struct to
 // another.
-func (u *Universe) Diff(u2 *Universe) (pos, neg *Universe) {
-	ipos, ineg := common.Diff(u, u2, &Universe{}, &Universe{})
-	if ipos != nil {
-		cpos := ipos.(*Universe)
-		pos = cpos
-	} else {
-		pos = nil
-	}
-	if ineg != nil {
-		cneg := ineg.(*Universe)
-		neg = cneg
-	} else {
-		neg = nil
+func (u *Universe) Diff(u2 *Universe, opts ...common.Option) (pos, neg *Universe) {
+	pos, neg = common.TypedDiff(u.Snapshot(), u2.Snapshot(), opts...)
+	return
+}
+
+// Clone returns a deep copy of the current snapshot of a Universe struct.
+func (u *Universe) Clone() (res *Universe) {
+	res = common.Clone(u.Snapshot())
+	return
+}
+
+// Apply returns a new Universe struct with a positive and negative diff, as
+// returned by Diff, applied to it. Either diff may be nil.
+func (u *Universe) Apply(pos, neg *Universe) (res *Universe) {
+	res = common.TypedApply(u.Snapshot(), pos, neg)
+	return
+}
+
+// Merge does a three-way merge with a Universe as the common base of two
+// others, ours and theirs, e.g. a locally curated copy and a fresh fetch. It
+// returns a new Universe with the changes from both and a list of any
+// conflicts, which are left as they are in ours.
+func (u *Universe) Merge(ours, theirs *Universe) (res *Universe, conflicts []common.Conflict) {
+	res, conflicts = common.TypedMerge(u.Snapshot(), ours.Snapshot(), theirs.Snapshot())
+	return
+}
+
+// Changes returns a flat list of every change from one Universe struct to
+// another.
+func (u *Universe) Changes(u2 *Universe, opts ...common.Option) (changes []common.Change) {
+	changes = common.Changes(u.Snapshot(), u2.Snapshot(), opts...)
+	return
+}
+
+// JSONPatch returns an RFC 6902 JSON Patch from one Universe struct to
+// another.
+func (u *Universe) JSONPatch(u2 *Universe) (p common.Patch, err error) {
+	p, err = common.JSONPatch(u.Snapshot(), u2.Snapshot())
+	return
+}
+
+// ApplyJSONPatch applies an RFC 6902 JSON Patch to a Universe struct and
+// returns the result as a new Universe with the same Component and
+// APIInstance.
+func (u *Universe) ApplyJSONPatch(p common.Patch) (res *Universe, err error) {
+	snap := u.Snapshot()
+	ires, err := common.ApplyJSONPatch(snap, p, &Universe{})
+	if err != nil {
+		return
+	}
+	res = ires.(*Universe)
+	// The universe format only holds the cookbooks
+	res.Component = snap.Component
+	res.APIInstance = snap.APIInstance.Clone()
+	return
+}
+
+// MarshalJSON encodes the current snapshot of a Universe in the same format
+// as a universe endpoint. Only the cookbooks are included.
+func (u *Universe) MarshalJSON() ([]byte, error) {
+	cookbooks := u.Snapshot().Cookbooks
+	if cookbooks == nil {
+		cookbooks = map[string]*universe.Cookbook{}
+	}
+	return json.Marshal(cookbooks)
+}
+
+// UnmarshalJSON decodes a Universe from the format of a universe endpoint,
+// replacing its cookbooks and discarding any snapshot stored by Update. It
+// isn't safe to call while other goroutines are reading the Universe.
+func (u *Universe) UnmarshalJSON(data []byte) (err error) {
+	cookbooks := map[string]*universe.Cookbook{}
+	err = json.Unmarshal(data, &cookbooks)
+	if err != nil {
+		return
+	}
+	for name, c := range cookbooks {
+		if c == nil {
+			c = universe.NewCookbook()
+			cookbooks[name] = c
+		}
+		c.Name = name
 	}
+	u.Cookbooks = cookbooks
+	u.hashes = nil
+	u.snapshot.Store(nil)
 	return
 }
 
@@ -0,0 +1,250 @@
+// Author:: Jonathan Hartman (<j@p4nt5.com>)
+//
+// Copyright (C) 2014, Jonathan Hartman
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package universe implements the building blocks that make up the top-level
+Universe struct.
+
+This file defines memory-compact, read-only counterparts to the Cookbook and
+CookbookVersion structs. Location strings and dependency names are interned,
+versions are pre-parsed, identical constraints share a single object, and
+download URLs are only stored when they can't be derived from the location.
+Versions and constraints that can't be parsed are kept as their raw strings
+rather than failing the whole cookbook.
+*/
+package universe
+
+import (
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Interner implements a table of shared strings and Constraints.
+type Interner struct {
+	strings     map[string]string
+	constraints map[string]*Constraint
+}
+
+// NewInterner generates an empty Interner struct.
+func NewInterner() (in *Interner) {
+	in = new(Interner)
+	in.strings = map[string]string{}
+	in.constraints = map[string]*Constraint{}
+	return
+}
+
+// String returns the shared copy of a string, adding it to the table if it's
+// not there yet.
+func (in *Interner) String(s string) (res string) {
+	res, ok := in.strings[s]
+	if !ok {
+		in.strings[s] = s
+		res = s
+	}
+	return
+}
+
+// Constraint returns the shared Constraint for a constraint string, parsing
+// and adding it to the table if it's not there yet.
+func (in *Interner) Constraint(s string) (c *Constraint, err error) {
+	c, ok := in.constraints[s]
+	if ok {
+		return
+	}
+	c, err = ParseConstraint(s)
+	if err != nil {
+		return
+	}
+	in.constraints[s] = c
+	return
+}
+
+// Dependency implements a single dependency of a CompactCookbookVersion. A
+// constraint string that can't be parsed is kept as a Constraint with no
+// Operator, which only returns its raw string and satisfies no Version.
+type Dependency struct {
+	Name       string
+	Constraint *Constraint
+}
+
+// CompactCookbookVersion implements a read-only, memory-compact
+// CookbookVersion.
+type CompactCookbookVersion struct {
+	cookbook     string
+	version      string
+	parsed       Version
+	locationType string
+	locationPath string
+	downloadURL  string
+	dependencies []Dependency
+}
+
+// NewCompactCookbookVersion accepts an Interner, a cookbook name, and a
+// CookbookVersion and returns a pointer to its compact equivalent.
+func NewCompactCookbookVersion(in *Interner, name string, cv *CookbookVersion) (ccv *CompactCookbookVersion) {
+	ccv = new(CompactCookbookVersion)
+	ccv.cookbook = in.String(name)
+	ccv.version = cv.Version
+	ccv.parsed, _ = ParseVersion(cv.Version)
+	ccv.locationType = in.String(cv.LocationType)
+	ccv.locationPath = in.String(cv.LocationPath)
+	if cv.DownloadURL != ccv.derivedDownloadURL() {
+		ccv.downloadURL = cv.DownloadURL
+	}
+	ccv.dependencies = make([]Dependency, 0, len(cv.Dependencies))
+	for dep, str := range cv.Dependencies {
+		c, err := in.Constraint(str)
+		if err != nil {
+			c = &Constraint{raw: str}
+		}
+		ccv.dependencies = append(ccv.dependencies, Dependency{Name: in.String(dep), Constraint: c})
+	}
+	slices.SortFunc(ccv.dependencies, func(a, b Dependency) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return
+}
+
+// Version returns the version string of a CompactCookbookVersion.
+func (ccv *CompactCookbookVersion) Version() string {
+	return ccv.version
+}
+
+// ParsedVersion returns the pre-parsed Version of a CompactCookbookVersion,
+// or a zero Version if its version string couldn't be parsed.
+func (ccv *CompactCookbookVersion) ParsedVersion() Version {
+	return ccv.parsed
+}
+
+// LocationType returns the location type of a CompactCookbookVersion.
+func (ccv *CompactCookbookVersion) LocationType() string {
+	return ccv.locationType
+}
+
+// LocationPath returns the location path of a CompactCookbookVersion.
+func (ccv *CompactCookbookVersion) LocationPath() string {
+	return ccv.locationPath
+}
+
+// DownloadURL returns the download URL of a CompactCookbookVersion.
+func (ccv *CompactCookbookVersion) DownloadURL() (res string) {
+	res = ccv.downloadURL
+	if res == "" {
+		res = ccv.derivedDownloadURL()
+	}
+	return
+}
+
+// Dependency returns the shared Constraint on a single dependency and
+// whether that dependency exists.
+func (ccv *CompactCookbookVersion) Dependency(name string) (c *Constraint, ok bool) {
+	i := sort.Search(len(ccv.dependencies), func(i int) bool {
+		return ccv.dependencies[i].Name >= name
+	})
+	if i < len(ccv.dependencies) && ccv.dependencies[i].Name == name {
+		c = ccv.dependencies[i].Constraint
+		ok = true
+	}
+	return
+}
+
+// Dependencies returns the dependencies of a CompactCookbookVersion, sorted
+// by name. The returned slice must not be modified.
+func (ccv *CompactCookbookVersion) Dependencies() []Dependency {
+	return ccv.dependencies
+}
+
+// Expand returns a pointer to a new, regular CookbookVersion struct with the
+// same data as a CompactCookbookVersion.
+func (ccv *CompactCookbookVersion) Expand() (cv *CookbookVersion) {
+	cv = NewCookbookVersion()
+	cv.Version = ccv.version
+	cv.LocationType = ccv.locationType
+	cv.LocationPath = ccv.locationPath
+	cv.DownloadURL = ccv.DownloadURL()
+	for _, d := range ccv.dependencies {
+		cv.Dependencies[d.Name] = d.Constraint.String()
+	}
+	return
+}
+
+// derivedDownloadURL returns the download URL a Supermarket would generate
+// for a CompactCookbookVersion based on its location path.
+func (ccv *CompactCookbookVersion) derivedDownloadURL() string {
+	return ccv.locationPath + "/cookbooks/" + ccv.cookbook + "/versions/" +
+		ccv.version + "/download"
+}
+
+// CompactCookbook implements a read-only, memory-compact Cookbook.
+type CompactCookbook struct {
+	name     string
+	versions []*CompactCookbookVersion
+}
+
+// NewCompactCookbook accepts an Interner and a Cookbook and returns a pointer
+// to its compact equivalent.
+func NewCompactCookbook(in *Interner, c *Cookbook) (cc *CompactCookbook) {
+	cc = new(CompactCookbook)
+	cc.name = in.String(c.Name)
+	cc.versions = make([]*CompactCookbookVersion, 0, len(c.Versions))
+	for _, cv := range c.Versions {
+		cc.versions = append(cc.versions, NewCompactCookbookVersion(in, cc.name, cv))
+	}
+	slices.SortFunc(cc.versions, func(a, b *CompactCookbookVersion) int {
+		// Unparseable versions fall back to string comparison, as in
+		// CompareVersions
+		if a.parsed.parts == 0 || b.parsed.parts == 0 {
+			return strings.Compare(a.version, b.version)
+		}
+		return a.parsed.Compare(b.parsed)
+	})
+	return
+}
+
+// Name returns the name of a CompactCookbook.
+func (cc *CompactCookbook) Name() string {
+	return cc.name
+}
+
+// Version returns a single CompactCookbookVersion by version string, or nil
+// if it doesn't exist.
+func (cc *CompactCookbook) Version(v string) (ccv *CompactCookbookVersion) {
+	for _, i := range cc.versions {
+		if i.version == v {
+			ccv = i
+			break
+		}
+	}
+	return
+}
+
+// Versions returns the versions of a CompactCookbook, sorted from lowest to
+// highest. The returned slice must not be modified.
+func (cc *CompactCookbook) Versions() []*CompactCookbookVersion {
+	return cc.versions
+}
+
+// Expand returns a pointer to a new, regular Cookbook struct with the same
+// data as a CompactCookbook.
+func (cc *CompactCookbook) Expand() (c *Cookbook) {
+	c = NewCookbook()
+	c.Name = cc.name
+	for _, ccv := range cc.versions {
+		c.Versions[ccv.version] = ccv.Expand()
+	}
+	return
+}
@@ -0,0 +1,137 @@
+package universe
+
+import (
+	"testing"
+	"unsafe"
+)
+
+func TestInternerString(t *testing.T) {
+	in := NewInterner()
+	s1 := in.String(string([]byte("opscode")))
+	s2 := in.String(string([]byte("opscode")))
+	if unsafe.StringData(s1) != unsafe.StringData(s2) {
+		t.Fatalf("Expected interned strings to share data")
+	}
+}
+
+func TestInternerConstraint(t *testing.T) {
+	in := NewInterner()
+	c1, err := in.Constraint(">= 0.0.0")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	c2, _ := in.Constraint(">= 0.0.0")
+	if c1 != c2 {
+		t.Fatalf("Expected the same Constraint, got: %v and %v", c1, c2)
+	}
+	_, err = in.Constraint("?? 0.0.0")
+	if err == nil {
+		t.Fatalf("Expected an error but didn't get one")
+	}
+}
+
+func TestNewCompactCookbookVersion(t *testing.T) {
+	in := NewInterner()
+	cv := cvdata()
+	ccv := NewCompactCookbookVersion(in, "something", cv)
+	c, ok := ccv.Dependency("thing2")
+	for _, i := range [][]interface{}{
+		{ccv.Version(), "0.1.0"},
+		{ccv.ParsedVersion().Minor, 1},
+		{ccv.LocationType(), "opscode"},
+		{ccv.LocationPath(), "https://example1.com"},
+		{ccv.DownloadURL(), "https://example1.com/dl1"},
+		{len(ccv.Dependencies()), 2},
+		{ccv.Dependencies()[0].Name, "thing1"},
+		{ok, true},
+		{c.String(), ">= 0.0.0"},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+	_, ok = ccv.Dependency("thing3")
+	if ok != false {
+		t.Fatalf("Expected false, got: %v", ok)
+	}
+	if !ccv.Expand().Equals(cv) {
+		t.Fatalf("Expected %v, got: %v", cv, ccv.Expand())
+	}
+}
+
+func TestNewCompactCookbookVersionDerivedDownloadURL(t *testing.T) {
+	in := NewInterner()
+	cv := cvdata()
+	cv.DownloadURL = "https://example1.com/cookbooks/something/versions/0.1.0/download"
+	ccv := NewCompactCookbookVersion(in, "something", cv)
+	for _, i := range [][]interface{}{
+		{ccv.downloadURL, ""},
+		{ccv.DownloadURL(), cv.DownloadURL},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+}
+
+func TestNewCompactCookbookVersionBadVersion(t *testing.T) {
+	cv := cvdata()
+	cv.Version = "abc"
+	ccv := NewCompactCookbookVersion(NewInterner(), "something", cv)
+	for _, i := range [][]interface{}{
+		{ccv.Version(), "abc"},
+		{ccv.ParsedVersion(), Version{}},
+		{len(ccv.Dependencies()), 2},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+	if !ccv.Expand().Equals(cv) {
+		t.Fatalf("Expected %v, got: %v", cv, ccv.Expand())
+	}
+}
+
+func TestNewCompactCookbookVersionBadConstraint(t *testing.T) {
+	cv := cvdata()
+	cv.Dependencies["thing3"] = "?? 1.0.0"
+	ccv := NewCompactCookbookVersion(NewInterner(), "something", cv)
+	c, ok := ccv.Dependency("thing3")
+	for _, i := range [][]interface{}{
+		{ok, true},
+		{c.String(), "?? 1.0.0"},
+		{c.Satisfies(Version{Major: 1, parts: 3}), false},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+	if !ccv.Expand().Equals(cv) {
+		t.Fatalf("Expected %v, got: %v", cv, ccv.Expand())
+	}
+}
+
+func TestNewCompactCookbook(t *testing.T) {
+	c := cdata()
+	c.Versions["0.10.0"] = cvdata()
+	c.Versions["0.10.0"].Version = "0.10.0"
+	c.Versions["0.2.0"] = cvdata()
+	c.Versions["0.2.0"].Version = "0.2.0"
+	cc := NewCompactCookbook(NewInterner(), c)
+	for _, i := range [][]interface{}{
+		{cc.Name(), "something"},
+		{len(cc.Versions()), 3},
+		{cc.Versions()[0].Version(), "0.1.0"},
+		{cc.Versions()[1].Version(), "0.2.0"},
+		{cc.Versions()[2].Version(), "0.10.0"},
+		{cc.Version("0.2.0").Version(), "0.2.0"},
+		{cc.Version("9.9.9") == nil, true},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+	if !cc.Expand().Equals(c) {
+		t.Fatalf("Expected %v, got: %v", c, cc.Expand())
+	}
+}
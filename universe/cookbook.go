@@ -18,11 +18,24 @@
 Package universe implements the building blocks that make up the top-level
 Universe struct.
 
-This file defines a universe-style Cookbook struct.
+This file defines a universe-style Cookbook struct. Its JSON encoding is that
+of a single cookbook in a universe endpoint, a map of version strings to
+versions, e.g.
+
+	{
+		"0.1.0": {
+			"location_type": "opscode",
+			"location_path": "https://supermarket.chef.io/api/v1",
+			"download_url": "https://supermarket.chef.io/api/v1/cookbooks/chef/versions/0.1.0/download",
+			"dependencies": {"runit": ">= 0.0.0"}
+		}
+	}
 */
 package universe
 
 import (
+	"encoding/json"
+
 	"github.com/RoboticCheese/goulash/common"
 )
 
@@ -32,6 +45,8 @@ type Cookbook struct {
 	Versions map[string]*CookbookVersion
 }
 
+var _ common.Supermarketer[*Cookbook] = (*Cookbook)(nil)
+
 // NewCookbook generates an empty Cookbook struct.
 func NewCookbook() (c *Cookbook) {
 	c = new(Cookbook)
@@ -47,26 +62,96 @@ func (c *Cookbook) Empty() (empty bool) {
 }
 
 // Equals implements an equality test for a Cookbook.
-func (c *Cookbook) Equals(c2 *Cookbook) (res bool) {
-	res = common.Equals(c, c2)
+func (c *Cookbook) Equals(c2 *Cookbook, opts ...common.Option) (res bool) {
+	res = common.Equals(c, c2, opts...)
 	return
 }
 
 // Diff returns any attributes that have changed from one Cookbook struct to
 // another.
-func (c *Cookbook) Diff(c2 *Cookbook) (pos, neg *Cookbook) {
-	ipos, ineg := common.Diff(c, c2, &Cookbook{}, &Cookbook{})
-	if ipos != nil {
-		cpos := ipos.(*Cookbook)
-		pos = cpos
-	} else {
-		pos = nil
+func (c *Cookbook) Diff(c2 *Cookbook, opts ...common.Option) (pos, neg *Cookbook) {
+	pos, neg = common.TypedDiff(c, c2, opts...)
+	return
+}
+
+// Clone returns a deep copy of a Cookbook struct.
+func (c *Cookbook) Clone() (res *Cookbook) {
+	res = common.Clone(c)
+	return
+}
+
+// Apply returns a new Cookbook struct with a positive and negative diff, as
+// returned by Diff, applied to it. Either diff may be nil.
+func (c *Cookbook) Apply(pos, neg *Cookbook) (res *Cookbook) {
+	res = common.TypedApply(c, pos, neg)
+	return
+}
+
+// Merge does a three-way merge with a Cookbook as the common base of two
+// others, ours and theirs. It returns a new Cookbook with the changes from
+// both and a list of any conflicts, which are left as they are in ours.
+func (c *Cookbook) Merge(ours, theirs *Cookbook) (res *Cookbook, conflicts []common.Conflict) {
+	res, conflicts = common.TypedMerge(c, ours, theirs)
+	return
+}
+
+// Changes returns a flat list of every change from one Cookbook struct to
+// another.
+func (c *Cookbook) Changes(c2 *Cookbook, opts ...common.Option) (changes []common.Change) {
+	changes = common.Changes(c, c2, opts...)
+	return
+}
+
+// wireCookbookVersion is a CookbookVersion as it appears in universe JSON,
+// where the version is a key rather than a field.
+type wireCookbookVersion struct {
+	LocationType string            `json:"location_type"`
+	LocationPath string            `json:"location_path"`
+	DownloadURL  string            `json:"download_url"`
+	Dependencies map[string]string `json:"dependencies"`
+}
+
+// MarshalJSON encodes a Cookbook in the universe format. The name isn't
+// included; in a universe it's the key the Cookbook is stored under.
+func (c *Cookbook) MarshalJSON() ([]byte, error) {
+	wire := make(map[string]wireCookbookVersion, len(c.Versions))
+	for v, cv := range c.Versions {
+		if cv == nil {
+			continue
+		}
+		w := wireCookbookVersion{
+			LocationType: cv.LocationType,
+			LocationPath: cv.LocationPath,
+			DownloadURL:  cv.DownloadURL,
+			Dependencies: cv.Dependencies,
+		}
+		if w.Dependencies == nil {
+			w.Dependencies = map[string]string{}
+		}
+		wire[v] = w
+	}
+	return json.Marshal(wire)
+}
+
+// UnmarshalJSON decodes a Cookbook from the universe format, replacing its
+// versions and leaving its name as it is.
+func (c *Cookbook) UnmarshalJSON(data []byte) (err error) {
+	wire := map[string]wireCookbookVersion{}
+	err = json.Unmarshal(data, &wire)
+	if err != nil {
+		return
 	}
-	if ineg != nil {
-		cneg := ineg.(*Cookbook)
-		neg = cneg
-	} else {
-		neg = nil
+	c.Versions = make(map[string]*CookbookVersion, len(wire))
+	for v, w := range wire {
+		cv := NewCookbookVersion()
+		cv.Version = v
+		cv.LocationType = w.LocationType
+		cv.LocationPath = w.LocationPath
+		cv.DownloadURL = w.DownloadURL
+		if w.Dependencies != nil {
+			cv.Dependencies = w.Dependencies
+		}
+		c.Versions[v] = cv
 	}
 	return
 }
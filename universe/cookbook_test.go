@@ -1,7 +1,11 @@
 package universe
 
 import (
+	"encoding/json"
+	"strings"
 	"testing"
+
+	"github.com/RoboticCheese/goulash/common"
 )
 
 func cdata() (data *Cookbook) {
@@ -250,3 +254,109 @@ func TestCookbookDiffRemovedVersions(t *testing.T) {
 		}
 	}
 }
+
+func TestCookbookChanges(t *testing.T) {
+	data1 := cdata()
+	data2 := cdata()
+	data2.Versions["0.2.0"] = &CookbookVersion{Version: "0.2.0"}
+	res := data1.Changes(data2)
+	for _, i := range [][]interface{}{
+		{len(res), 1},
+		{res[0].Path, `Versions["0.2.0"]`},
+		{res[0].Kind, common.Added},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+}
+
+func TestCookbookApply(t *testing.T) {
+	data1 := cdata()
+	data2 := cdata()
+	data2.Versions["0.1.0"].Dependencies = map[string]string{}
+	data2.Versions["0.2.0"] = cvdata()
+	data2.Versions["0.2.0"].Version = "0.2.0"
+	for _, i := range [][]*Cookbook{{data1, data2}, {data2, data1}} {
+		pos, neg := i[0].Diff(i[1])
+		res := i[0].Apply(pos, neg)
+		if !res.Equals(i[1]) {
+			t.Fatalf("Expected %v, got: %v", i[1], res)
+		}
+	}
+}
+
+func TestCookbookMerge(t *testing.T) {
+	base := cdata()
+	ours := cdata()
+	ours.Versions["0.1.0"].Dependencies["thing1"] = "~> 1.0"
+	theirs := cdata()
+	theirs.Versions["0.1.0"].DownloadURL = "https://example1.com/dl2"
+	theirs.Versions["0.2.0"] = &CookbookVersion{Version: "0.2.0"}
+	res, conflicts := base.Merge(ours, theirs)
+	for _, i := range [][]interface{}{
+		{len(conflicts), 0},
+		{res.Versions["0.1.0"].Dependencies["thing1"], "~> 1.0"},
+		{res.Versions["0.1.0"].DownloadURL, "https://example1.com/dl2"},
+		{res.Versions["0.2.0"].Version, "0.2.0"},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+	theirs.Versions["0.1.0"].Dependencies["thing1"] = "= 2.0"
+	_, conflicts = base.Merge(ours, theirs)
+	if len(conflicts) != 1 || conflicts[0].Path != `Versions["0.1.0"].Dependencies["thing1"]` {
+		t.Fatalf("Expected one dependency conflict, got: %v", conflicts)
+	}
+}
+
+func TestCookbookClone(t *testing.T) {
+	data := cdata()
+	res := data.Clone()
+	res.Versions["0.1.0"].Dependencies["thing1"] = "= 1.0"
+	for _, i := range [][]interface{}{
+		{data.Versions["0.1.0"].Dependencies["thing1"], ">= 0.0.0"},
+		{data.Clone().Equals(data), true},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+}
+
+func TestCookbookDiffDoesNotAlias(t *testing.T) {
+	data1 := cdata()
+	data2 := cdata()
+	data2.Versions["0.2.0"] = cvdata()
+	pos, _ := data1.Diff(data2)
+	pos.Versions["0.2.0"].Dependencies["thing1"] = "= 1.0"
+	if data2.Versions["0.2.0"].Dependencies["thing1"] != ">= 0.0.0" {
+		t.Fatalf("Expected the original to be unmodified, got: %v", data2.Versions["0.2.0"])
+	}
+}
+
+func TestCookbookJSON(t *testing.T) {
+	data := cdata()
+	data.Versions["0.2.0"] = &CookbookVersion{Version: "0.2.0", LocationType: "opscode"}
+	out, err := json.Marshal(data)
+	if err != nil {
+		t.Fatalf("Expected no err, got: %v", err)
+	}
+	res := &Cookbook{Name: "something"}
+	err = json.Unmarshal(out, res)
+	if err != nil {
+		t.Fatalf("Expected no err, got: %v", err)
+	}
+	data.Versions["0.2.0"].Dependencies = map[string]string{}
+	for _, i := range [][]interface{}{
+		{strings.Contains(string(out), `"0.2.0":{"location_type":"opscode","location_path":"","download_url":"","dependencies":{}}`), true},
+		{strings.Contains(string(out), "Version"), false},
+		{strings.Contains(string(out), "something"), false},
+		{res.Equals(data), true},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+}
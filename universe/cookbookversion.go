@@ -36,6 +36,8 @@ type CookbookVersion struct {
 	Dependencies map[string]string `json:"dependencies"`
 }
 
+var _ common.Supermarketer[*CookbookVersion] = (*CookbookVersion)(nil)
+
 // NewCookbookVersion generates an empty CookbookVersion struct.
 func NewCookbookVersion() (cv *CookbookVersion) {
 	cv = new(CookbookVersion)
@@ -51,26 +53,34 @@ func (cv *CookbookVersion) Empty() (empty bool) {
 }
 
 // Equals implements an equality test for a CookbookVersion struct
-func (cv *CookbookVersion) Equals(cv2 *CookbookVersion) (res bool) {
-	res = common.Equals(cv, cv2)
+func (cv *CookbookVersion) Equals(cv2 *CookbookVersion, opts ...common.Option) (res bool) {
+	res = common.Equals(cv, cv2, opts...)
 	return
 }
 
 // Diff returns any attributes that have been changed from one CookbookVersion
 // struct to another.
-func (cv *CookbookVersion) Diff(cv2 *CookbookVersion) (pos, neg *CookbookVersion) {
-	ipos, ineg := common.Diff(cv, cv2, &CookbookVersion{}, &CookbookVersion{})
-	if ipos != nil {
-		cpos := ipos.(*CookbookVersion)
-		pos = cpos
-	} else {
-		pos = nil
-	}
-	if ineg != nil {
-		cneg := ineg.(*CookbookVersion)
-		neg = cneg
-	} else {
-		neg = nil
-	}
+func (cv *CookbookVersion) Diff(cv2 *CookbookVersion, opts ...common.Option) (pos, neg *CookbookVersion) {
+	pos, neg = common.TypedDiff(cv, cv2, opts...)
+	return
+}
+
+// Clone returns a deep copy of a CookbookVersion struct.
+func (cv *CookbookVersion) Clone() (res *CookbookVersion) {
+	res = common.Clone(cv)
+	return
+}
+
+// Apply returns a new CookbookVersion struct with a positive and negative diff, as
+// returned by Diff, applied to it. Either diff may be nil.
+func (cv *CookbookVersion) Apply(pos, neg *CookbookVersion) (res *CookbookVersion) {
+	res = common.TypedApply(cv, pos, neg)
+	return
+}
+
+// Changes returns a flat list of every change from one CookbookVersion struct
+// to another.
+func (cv *CookbookVersion) Changes(cv2 *CookbookVersion, opts ...common.Option) (changes []common.Change) {
+	changes = common.Changes(cv, cv2, opts...)
 	return
 }
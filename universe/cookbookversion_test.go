@@ -2,6 +2,8 @@ package universe
 
 import (
 	"testing"
+
+	"github.com/RoboticCheese/goulash/common"
 )
 
 func cvdata() (data *CookbookVersion) {
@@ -479,3 +481,49 @@ func TestCookbookVersionDiffRemovedAllDepndencies(t *testing.T) {
 		}
 	}
 }
+
+func TestCookbookVersionChanges(t *testing.T) {
+	data1 := cvdata()
+	data2 := cvdata()
+	data2.LocationType = "other"
+	res := data1.Changes(data2)
+	for _, i := range [][]interface{}{
+		{len(res), 1},
+		{res[0].Path, "LocationType"},
+		{res[0].Kind, common.Modified},
+		{res[0].Old, "opscode"},
+		{res[0].New, "other"},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+}
+
+func TestCookbookVersionApply(t *testing.T) {
+	data1 := cvdata()
+	data2 := cvdata()
+	data2.LocationPath = "https://example2.com"
+	delete(data2.Dependencies, "thing1")
+	for _, i := range [][]*CookbookVersion{{data1, data2}, {data2, data1}} {
+		pos, neg := i[0].Diff(i[1])
+		res := i[0].Apply(pos, neg)
+		if !res.Equals(i[1]) {
+			t.Fatalf("Expected %v, got: %v", i[1], res)
+		}
+	}
+}
+
+func TestCookbookVersionClone(t *testing.T) {
+	data := cvdata()
+	res := data.Clone()
+	res.Dependencies["thing1"] = "= 1.0"
+	for _, i := range [][]interface{}{
+		{data.Dependencies["thing1"], ">= 0.0.0"},
+		{data.Clone().Equals(data), true},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+}
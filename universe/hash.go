@@ -0,0 +1,100 @@
+// Author:: Jonathan Hartman (<j@p4nt5.com>)
+//
+// Copyright (C) 2014, Jonathan Hartman
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package universe implements the building blocks that make up the top-level
+Universe struct.
+
+This file defines content fingerprints for the Cookbook and CookbookVersion
+structs. Each is a hex-encoded SHA-256 sum over a canonical encoding of the
+struct's data, with map entries in sorted order, so two structs holding the
+same data always have the same Hash.
+*/
+package universe
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"sort"
+	"strconv"
+)
+
+// Hash returns a fingerprint of a CookbookVersion's content, or an empty
+// string for a nil CookbookVersion.
+func (cv *CookbookVersion) Hash() (res string) {
+	if cv == nil {
+		return
+	}
+	h := sha256.New()
+	writeHashStrings(h, cv.Version, cv.LocationType, cv.LocationPath, cv.DownloadURL)
+	deps := make([]string, 0, len(cv.Dependencies))
+	for dep := range cv.Dependencies {
+		deps = append(deps, dep)
+	}
+	sort.Strings(deps)
+	for _, dep := range deps {
+		writeHashStrings(h, dep, cv.Dependencies[dep])
+	}
+	res = hex.EncodeToString(h.Sum(nil))
+	return
+}
+
+// Hash returns a fingerprint of a Cookbook's content, including every one of
+// its versions, or an empty string for a nil Cookbook.
+func (c *Cookbook) Hash() (res string) {
+	if c == nil {
+		return
+	}
+	h := sha256.New()
+	writeHashStrings(h, c.Name)
+	versions := make([]string, 0, len(c.Versions))
+	for v := range c.Versions {
+		versions = append(versions, v)
+	}
+	sort.Strings(versions)
+	for _, v := range versions {
+		writeHashStrings(h, v, c.Versions[v].Hash())
+	}
+	res = hex.EncodeToString(h.Sum(nil))
+	return
+}
+
+// HashCookbooks returns the Hash of every Cookbook in a map, keyed by the
+// same names, and a fingerprint of the whole map.
+func HashCookbooks(cookbooks map[string]*Cookbook) (hashes map[string]string, sum string) {
+	hashes = make(map[string]string, len(cookbooks))
+	names := make([]string, 0, len(cookbooks))
+	for name, c := range cookbooks {
+		hashes[name] = c.Hash()
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	h := sha256.New()
+	for _, name := range names {
+		writeHashStrings(h, name, hashes[name])
+	}
+	sum = hex.EncodeToString(h.Sum(nil))
+	return
+}
+
+// writeHashStrings writes each string to a hash with a length prefix, so no
+// two different lists of strings write the same bytes.
+func writeHashStrings(h hash.Hash, strs ...string) {
+	for _, s := range strs {
+		h.Write([]byte(strconv.Itoa(len(s)) + ":" + s))
+	}
+}
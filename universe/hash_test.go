@@ -0,0 +1,65 @@
+package universe
+
+import (
+	"testing"
+)
+
+func TestCookbookVersionHash(t *testing.T) {
+	data1 := cvdata()
+	data2 := cvdata()
+	data2.Dependencies = map[string]string{"thing2": ">= 0.0.0"}
+	data2.Dependencies["thing1"] = ">= 0.0.0"
+	data3 := cvdata()
+	data3.Dependencies["thing1"] = "~> 1.0"
+	data4 := cvdata()
+	data4.LocationType = "opscode1"
+	data4.LocationPath = "ttps://example1.com"
+	for _, i := range [][]interface{}{
+		{len(data1.Hash()), 64},
+		{data1.Hash(), data2.Hash()},
+		{data1.Hash() != data3.Hash(), true},
+		{data1.Hash() != data4.Hash(), true},
+		{(*CookbookVersion)(nil).Hash(), ""},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+}
+
+func TestCookbookHash(t *testing.T) {
+	data1 := cdata()
+	data2 := cdata()
+	data2.Versions["0.2.0"] = cvdata()
+	data3 := cdata()
+	data3.Versions["0.1.0"].DownloadURL = "https://example1.com/dl2"
+	for _, i := range [][]interface{}{
+		{data1.Hash(), cdata().Hash()},
+		{data1.Hash() != data2.Hash(), true},
+		{data1.Hash() != data3.Hash(), true},
+		{(*Cookbook)(nil).Hash(), ""},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+}
+
+func TestHashCookbooks(t *testing.T) {
+	c1 := map[string]*Cookbook{"a": cdata(), "b": NewCookbook()}
+	c2 := map[string]*Cookbook{"b": NewCookbook(), "a": cdata()}
+	c3 := map[string]*Cookbook{"a": cdata()}
+	h1, s1 := HashCookbooks(c1)
+	_, s2 := HashCookbooks(c2)
+	_, s3 := HashCookbooks(c3)
+	for _, i := range [][]interface{}{
+		{len(h1), 2},
+		{h1["a"], cdata().Hash()},
+		{s1, s2},
+		{s1 != s3, true},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+}
@@ -0,0 +1,185 @@
+// Author:: Jonathan Hartman (<j@p4nt5.com>)
+//
+// Copyright (C) 2014, Jonathan Hartman
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package universe implements the building blocks that make up the top-level
+Universe struct.
+
+This file defines pre-parsed Version and Constraint structs for the version
+strings and dependency constraints that appear in a universe, e.g.
+
+	"2.7.4"
+	"~> 2.2"
+	">= 0.0.0"
+*/
+package universe
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Version implements a parsed Chef cookbook version number.
+type Version struct {
+	Major int
+	Minor int
+	Patch int
+	parts int
+}
+
+// ParseVersion accepts a "x.y" or "x.y.z" version string and returns the
+// parsed Version and any error.
+func ParseVersion(s string) (v Version, err error) {
+	fields := strings.Split(s, ".")
+	if len(fields) < 2 || len(fields) > 3 {
+		err = errors.New("invalid version string: " + s)
+		return
+	}
+	nums := [3]int{}
+	for i, f := range fields {
+		nums[i], err = strconv.Atoi(f)
+		if err != nil || nums[i] < 0 {
+			err = errors.New("invalid version string: " + s)
+			return
+		}
+	}
+	v = Version{Major: nums[0], Minor: nums[1], Patch: nums[2], parts: len(fields)}
+	return
+}
+
+// String returns the version string a Version was parsed from.
+func (v Version) String() (res string) {
+	res = strconv.Itoa(v.Major) + "." + strconv.Itoa(v.Minor)
+	if v.parts != 2 {
+		res += "." + strconv.Itoa(v.Patch)
+	}
+	return
+}
+
+// Compare returns -1, 0, or 1 depending on whether a Version is lower than,
+// equal to, or higher than another.
+func (v Version) Compare(v2 Version) (res int) {
+	for _, i := range [][]int{
+		{v.Major, v2.Major},
+		{v.Minor, v2.Minor},
+		{v.Patch, v2.Patch},
+	} {
+		if i[0] < i[1] {
+			return -1
+		}
+		if i[0] > i[1] {
+			return 1
+		}
+	}
+	return
+}
+
+// CompareVersions returns -1, 0, or 1 depending on whether a version string
+// is lower than, equal to, or higher than another. If either can't be
+// parsed, they're compared as strings.
+func CompareVersions(s1, s2 string) (res int) {
+	v1, err1 := ParseVersion(s1)
+	v2, err2 := ParseVersion(s2)
+	if err1 != nil || err2 != nil {
+		return strings.Compare(s1, s2)
+	}
+	return v1.Compare(v2)
+}
+
+// SortVersions sorts a list of version strings, lowest first, as
+// CompareVersions orders them.
+func SortVersions(versions []string) {
+	sort.Slice(versions, func(i, j int) bool {
+		return CompareVersions(versions[i], versions[j]) < 0
+	})
+}
+
+// Constraint implements a parsed dependency constraint, e.g. "~> 2.2".
+type Constraint struct {
+	Operator string
+	Version  Version
+	raw      string
+}
+
+// ParseConstraint accepts a dependency constraint string and returns a
+// pointer to the parsed Constraint and any error. A bare version string is
+// treated as an "=" constraint.
+func ParseConstraint(s string) (c *Constraint, err error) {
+	c = &Constraint{Operator: "=", raw: s}
+	fields := strings.Fields(s)
+	switch len(fields) {
+	case 1:
+		for _, op := range []string{"~>", ">=", "<=", "!=", "=", ">", "<"} {
+			if strings.HasPrefix(fields[0], op) {
+				c.Operator = op
+				fields[0] = strings.TrimPrefix(fields[0], op)
+				break
+			}
+		}
+	case 2:
+		c.Operator = fields[0]
+		fields = fields[1:]
+	default:
+		err = errors.New("invalid constraint string: " + s)
+		return
+	}
+	switch c.Operator {
+	case "~>", ">=", "<=", "!=", "=", ">", "<":
+	default:
+		err = errors.New("invalid constraint operator: " + s)
+		return
+	}
+	c.Version, err = ParseVersion(fields[0])
+	return
+}
+
+// String returns the constraint string a Constraint was parsed from.
+func (c *Constraint) String() (res string) {
+	res = c.raw
+	if res == "" {
+		res = c.Operator + " " + c.Version.String()
+	}
+	return
+}
+
+// Satisfies checks whether a Version meets a Constraint.
+func (c *Constraint) Satisfies(v Version) (res bool) {
+	cmp := v.Compare(c.Version)
+	switch c.Operator {
+	case "=":
+		res = cmp == 0
+	case "!=":
+		res = cmp != 0
+	case ">":
+		res = cmp > 0
+	case "<":
+		res = cmp < 0
+	case ">=":
+		res = cmp >= 0
+	case "<=":
+		res = cmp <= 0
+	case "~>":
+		// "~> 2.2" allows anything < 3.0; "~> 2.2.1" anything < 2.3.0
+		upper := Version{Major: c.Version.Major + 1}
+		if c.Version.parts == 3 {
+			upper = Version{Major: c.Version.Major, Minor: c.Version.Minor + 1}
+		}
+		res = cmp >= 0 && v.Compare(upper) < 0
+	}
+	return
+}
@@ -0,0 +1,158 @@
+package universe
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseVersionThreeParts(t *testing.T) {
+	v, err := ParseVersion("2.7.4")
+	for _, i := range [][]interface{}{
+		{err, nil},
+		{v.Major, 2},
+		{v.Minor, 7},
+		{v.Patch, 4},
+		{v.String(), "2.7.4"},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+}
+
+func TestParseVersionTwoParts(t *testing.T) {
+	v, err := ParseVersion("2.2")
+	for _, i := range [][]interface{}{
+		{err, nil},
+		{v.Major, 2},
+		{v.Minor, 2},
+		{v.Patch, 0},
+		{v.String(), "2.2"},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+}
+
+func TestParseVersionInvalid(t *testing.T) {
+	for _, s := range []string{"", "1", "1.2.3.4", "1.a.3", "1.-2.3"} {
+		_, err := ParseVersion(s)
+		if err == nil {
+			t.Fatalf("Expected an error for %v but didn't get one", s)
+		}
+	}
+}
+
+func TestVersionCompare(t *testing.T) {
+	for _, i := range []struct {
+		v1  string
+		v2  string
+		res int
+	}{
+		{"1.2.3", "1.2.3", 0},
+		{"1.2", "1.2.0", 0},
+		{"1.2.3", "1.2.4", -1},
+		{"1.10.0", "1.9.0", 1},
+		{"2.0.0", "1.99.99", 1},
+	} {
+		v1, _ := ParseVersion(i.v1)
+		v2, _ := ParseVersion(i.v2)
+		res := v1.Compare(v2)
+		if res != i.res {
+			t.Fatalf("Expected %v for %v <=> %v, got: %v", i.res, i.v1, i.v2, res)
+		}
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	for _, i := range []struct {
+		v1  string
+		v2  string
+		res int
+	}{
+		{"1.10.0", "1.9.0", 1},
+		{"1.2", "1.2.0", 0},
+		{"0.1.0", "1.0.0", -1},
+		{"abc", "1.0.0", 1},
+		{"abc", "abd", -1},
+	} {
+		res := CompareVersions(i.v1, i.v2)
+		if res != i.res {
+			t.Fatalf("Expected %v for %v <=> %v, got: %v", i.res, i.v1, i.v2, res)
+		}
+	}
+}
+
+func TestSortVersions(t *testing.T) {
+	versions := []string{"1.10.0", "abc", "1.9.0", "0.1"}
+	SortVersions(versions)
+	res := strings.Join(versions, " ")
+	if res != "0.1 1.9.0 1.10.0 abc" {
+		t.Fatalf("Expected: 0.1 1.9.0 1.10.0 abc, got: %v", res)
+	}
+}
+
+func TestParseConstraint(t *testing.T) {
+	for _, i := range []struct {
+		str string
+		op  string
+		ver string
+	}{
+		{">= 0.0.0", ">=", "0.0.0"},
+		{"~> 2.2", "~>", "2.2"},
+		{"<3.0.0", "<", "3.0.0"},
+		{"1.2.3", "=", "1.2.3"},
+		{"= 1.2.3", "=", "1.2.3"},
+	} {
+		c, err := ParseConstraint(i.str)
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		for _, j := range [][]interface{}{
+			{c.Operator, i.op},
+			{c.Version.String(), i.ver},
+			{c.String(), i.str},
+		} {
+			if j[0] != j[1] {
+				t.Fatalf("Expected: %v, got: %v", j[1], j[0])
+			}
+		}
+	}
+}
+
+func TestParseConstraintInvalid(t *testing.T) {
+	for _, s := range []string{"", "?? 1.2.3", ">= 1.2.3 4.5.6", ">= abc"} {
+		_, err := ParseConstraint(s)
+		if err == nil {
+			t.Fatalf("Expected an error for %v but didn't get one", s)
+		}
+	}
+}
+
+func TestConstraintSatisfies(t *testing.T) {
+	for _, i := range []struct {
+		c   string
+		v   string
+		res bool
+	}{
+		{">= 0.0.0", "1.2.3", true},
+		{"= 1.2.3", "1.2.3", true},
+		{"!= 1.2.3", "1.2.3", false},
+		{"> 1.2.3", "1.2.3", false},
+		{"< 1.2.3", "1.2.2", true},
+		{"<= 1.2.3", "1.2.4", false},
+		{"~> 2.2", "2.9.0", true},
+		{"~> 2.2", "3.0.0", false},
+		{"~> 2.2", "2.1.0", false},
+		{"~> 2.2.1", "2.2.9", true},
+		{"~> 2.2.1", "2.3.0", false},
+	} {
+		c, _ := ParseConstraint(i.c)
+		v, _ := ParseVersion(i.v)
+		res := c.Satisfies(v)
+		if res != i.res {
+			t.Fatalf("Expected %v for %v satisfying %v, got: %v", i.res, i.v, i.c, res)
+		}
+	}
+}
@@ -3,8 +3,12 @@ package goulash
 import (
 	"encoding/json"
 	"net/http"
+	"reflect"
+	"runtime"
+	"sync"
 	"testing"
 
+	"github.com/RoboticCheese/goulash/common"
 	"github.com/RoboticCheese/goulash/universe"
 )
 
@@ -164,6 +168,38 @@ func TestNewUniverseRealData(t *testing.T) {
 	}
 }
 
+func TestUniverseSnapshotNotUpdated(t *testing.T) {
+	u := udata()
+	snap := u.Snapshot()
+	for _, i := range [][]interface{}{
+		{snap != u, true},
+		{snap.Endpoint, u.Endpoint},
+		{snap.APIInstance, u.APIInstance},
+		{snap.Cookbooks["test1"], u.Cookbooks["test1"]},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+}
+
+func TestUniverseLookups(t *testing.T) {
+	u := udata()
+	u.Cookbooks["test0"] = &universe.Cookbook{Name: "test0"}
+	for _, i := range [][]interface{}{
+		{u.Len(), 2},
+		{len(u.CookbookNames()), 2},
+		{u.CookbookNames()[0], "test0"},
+		{u.CookbookNames()[1], "test1"},
+		{u.Cookbook("test1").Name, "test1"},
+		{u.Cookbook("test2") == nil, true},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+}
+
 func TestUniverseEmptyEmpty(t *testing.T) {
 	u := new(Universe)
 	res := u.Empty()
@@ -261,6 +297,30 @@ func TestUniverseEqualsFewerCookbooks(t *testing.T) {
 	}
 }
 
+func TestUniverseNilArguments(t *testing.T) {
+	data := udata()
+	pos, neg := data.Diff(nil)
+	merged, conflicts := data.Merge(nil, data)
+	patch, err := data.JSONPatch(nil)
+	for _, i := range [][]interface{}{
+		{data.Equals(nil), false},
+		{pos == nil, true},
+		{len(neg.Cookbooks), 1},
+		{neg.Cookbooks["test1"].Versions["0.1.0"].LocationType, "opscode"},
+		{len(data.Changes(nil)) > 0, true},
+		// Ours removed everything and theirs changed nothing
+		{merged == nil, true},
+		{len(conflicts), 0},
+		{err, nil},
+		{len(patch) > 0, true},
+		{(*Universe)(nil).Snapshot() == nil, true},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+}
+
 func TestUniverseEqualsDifferentCookbooks(t *testing.T) {
 	data1 := udata()
 	data2 := udata()
@@ -465,6 +525,122 @@ func TestUniverseUpdateETagNoChanges(t *testing.T) {
 	}
 }
 
+func TestUniverseUpdateKeepsOldSnapshot(t *testing.T) {
+	data := ujsonData()
+	body := func() string {
+		res, _ := json.Marshal(data)
+		return string(res)
+	}
+
+	ts := StartHTTP(body, nil)
+	defer ts.Close()
+
+	a, err := NewAPIInstance(ts.URL)
+	if err != nil {
+		t.Fatalf("Expected no err, got: %v", err)
+	}
+	u, err := NewUniverse(a)
+	if err != nil {
+		t.Fatalf("Expected no err, got: %v", err)
+	}
+	old := u.Snapshot()
+
+	delete(data, "djbdns")
+	_, _, err = u.Update()
+	if err != nil {
+		t.Fatalf("Expected no err, got: %v", err)
+	}
+	for _, i := range [][]interface{}{
+		{len(old.Cookbooks), 2},
+		{old.Cookbook("djbdns").Name, "djbdns"},
+		{u.Len(), 1},
+		{u.Cookbook("djbdns") == nil, true},
+		{u.Snapshot() != old, true},
+		// Update still sets the exported fields for code that reads them
+		{len(u.Cookbooks), 1},
+		{u.Cookbooks["djbdns"] == nil, true},
+		{u.Cookbooks["chef"], u.Cookbook("chef")},
+		{u.FetchedAt(), u.Snapshot().FetchedAt()},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+}
+
+func TestUniverseUpdateConcurrentReaders(t *testing.T) {
+	var lock sync.Mutex
+	data := ujsonData()
+	body := func() string {
+		lock.Lock()
+		defer lock.Unlock()
+		res, _ := json.Marshal(data)
+		return string(res)
+	}
+
+	ts := StartHTTP(body, nil)
+	defer ts.Close()
+
+	a, err := NewAPIInstance(ts.URL)
+	if err != nil {
+		t.Fatalf("Expected no err, got: %v", err)
+	}
+	u, err := NewUniverse(a)
+	if err != nil {
+		t.Fatalf("Expected no err, got: %v", err)
+	}
+
+	done := make(chan bool)
+	var wg sync.WaitGroup
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				// Every snapshot has both cookbooks with matching versions
+				snap := u.Snapshot()
+				for _, name := range snap.CookbookNames() {
+					for v, cv := range snap.Cookbook(name).Versions {
+						if cv.Version != v {
+							t.Errorf("Expected: %v, got: %v", v, cv.Version)
+						}
+					}
+				}
+				u.Empty()
+				u.Equals(udata())
+				if u.Len() != 2 {
+					t.Errorf("Expected: 2, got: %v", u.Len())
+				}
+				runtime.Gosched()
+			}
+		}()
+	}
+	var updates sync.WaitGroup
+	for w := 0; w < 2; w++ {
+		updates.Add(1)
+		go func(w int) {
+			defer updates.Done()
+			for n := 0; n < 5; n++ {
+				lock.Lock()
+				data["chef"]["0.12.0"].LocationPath = "https://example.com/" + string(rune('a'+w*10+n))
+				lock.Unlock()
+				_, _, err := u.Update()
+				if err != nil {
+					t.Errorf("Expected no err, got: %v", err)
+				}
+			}
+		}(w)
+	}
+	updates.Wait()
+	close(done)
+	wg.Wait()
+}
+
 func TestUniverseUpdateError(t *testing.T) {
 	ts := StartHTTP(uhttpBody(ujsonData()), nil)
 
@@ -561,6 +737,106 @@ func TestUniverseDiffUpdatedCookbook(t *testing.T) {
 	}
 }
 
+func TestUniverseChanges(t *testing.T) {
+	data1 := udata()
+	data2 := udata()
+	data2.Cookbooks["test1"].Versions["0.1.0"].Dependencies["thing2"] = "~> 1.0"
+	delete(data2.Cookbooks["test1"].Versions["0.1.0"].Dependencies, "thing1")
+	res := data1.Changes(data2)
+	for _, i := range [][]interface{}{
+		{len(res), 2},
+		{res[0].Path, `Cookbooks["test1"].Versions["0.1.0"].Dependencies["thing1"]`},
+		{res[0].Kind, common.Removed},
+		{res[0].Old, ">= 0.0.0"},
+		{res[1].Path, `Cookbooks["test1"].Versions["0.1.0"].Dependencies["thing2"]`},
+		{res[1].Kind, common.Modified},
+		{res[1].Old, ">= 0.0.0"},
+		{res[1].New, "~> 1.0"},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+}
+
+func TestUniverseJSONPatchRoundTrip(t *testing.T) {
+	data1 := udata()
+	data2 := udata()
+	data2.Cookbooks["test1"].Versions["0.1.0"].Dependencies["thing3"] = "~> 1.0"
+	data2.Cookbooks["test1"].Versions["0.2.0"] = &universe.CookbookVersion{
+		Version:      "0.2.0",
+		LocationType: "opscode",
+		Dependencies: map[string]string{},
+	}
+	data2.Cookbooks["nginx"] = &universe.Cookbook{Name: "nginx", Versions: map[string]*universe.CookbookVersion{}}
+	for _, i := range [][]*Universe{{data1, data2}, {data2, data1}} {
+		p, err := i[0].JSONPatch(i[1])
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		res, err := i[0].ApplyJSONPatch(p)
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		if !res.Equals(i[1]) {
+			t.Fatalf("Expected %v, got: %v", i[1], res)
+		}
+	}
+}
+
+func TestUniverseApplyReplaysDiffs(t *testing.T) {
+	data := ujsonData()
+	body := func() string {
+		res, _ := json.Marshal(data)
+		return string(res)
+	}
+	ts := StartHTTP(body, nil)
+	defer ts.Close()
+
+	a, err := NewAPIInstance(ts.URL)
+	if err != nil {
+		t.Fatalf("Expected no err, got: %v", err)
+	}
+	u, err := NewUniverse(a)
+	if err != nil {
+		t.Fatalf("Expected no err, got: %v", err)
+	}
+	saved := u.Snapshot()
+
+	diffs := [][]*Universe{}
+	for _, change := range []func(){
+		func() { data["chef"]["0.12.0"].LocationType = "elsewhere" },
+		func() { delete(data["chef"]["0.20.0"].Dependencies, "xml") },
+		func() { delete(data, "djbdns") },
+		func() {
+			data["nginx"] = map[string]*universe.CookbookVersion{
+				"2.7.4": &universe.CookbookVersion{
+					LocationType: "opscode",
+					Dependencies: map[string]string{"apt": ">= 0.0.0"},
+				},
+			}
+		},
+	} {
+		change()
+		pos, neg, err := u.Update()
+		if err != nil {
+			t.Fatalf("Expected no err, got: %v", err)
+		}
+		diffs = append(diffs, []*Universe{pos, neg})
+	}
+
+	res := saved
+	for _, d := range diffs {
+		res = res.Apply(d[0], d[1])
+	}
+	if !res.Equals(u) {
+		t.Fatalf("Expected %v, got: %v", u.Snapshot(), res)
+	}
+	if saved.Cookbook("djbdns") == nil {
+		t.Fatalf("Expected the saved snapshot to be unmodified")
+	}
+}
+
 func TestdecodeUniverseJSON(t *testing.T) {
 	ts := StartHTTP(uhttpBody(ujsonData()), nil)
 	defer ts.Close()
@@ -579,3 +855,215 @@ func TestdecodeUniverseJSON(t *testing.T) {
 		t.Fatalf("Expected 2 cookbooks, got: %v", len(tempU))
 	}
 }
+
+func TestUniverseMerge(t *testing.T) {
+	base := udata()
+	ours := udata()
+	ours.Cookbooks["test1"].Versions["0.1.0"].LocationPath = "https://mirror.example.com"
+	ours.Cookbooks["pinned"] = &universe.Cookbook{Name: "pinned"}
+	theirs := udata()
+	theirs.Cookbooks["test1"].Versions["0.2.0"] = &universe.CookbookVersion{Version: "0.2.0"}
+	theirs.Cookbooks["test1"].Versions["0.1.0"].Dependencies["thing3"] = "~> 1.0"
+	theirs.Cookbooks["test1"].Versions["0.1.0"].LocationPath = "https://new.example.com"
+	res, conflicts := base.Merge(ours, theirs)
+	cv := res.Cookbooks["test1"].Versions["0.1.0"]
+	for _, i := range [][]interface{}{
+		{len(conflicts), 1},
+		{conflicts[0].Path, `Cookbooks["test1"].Versions["0.1.0"].LocationPath`},
+		{conflicts[0].Theirs, "https://new.example.com"},
+		{cv.LocationPath, "https://mirror.example.com"},
+		{cv.Dependencies["thing3"], "~> 1.0"},
+		{res.Cookbooks["test1"].Versions["0.2.0"].Version, "0.2.0"},
+		{res.Cookbooks["pinned"].Name, "pinned"},
+		{len(base.Cookbooks["test1"].Versions), 1},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+}
+
+func TestUniverseClone(t *testing.T) {
+	data := udata()
+	res := data.Clone()
+	res.Cookbooks["test1"].Versions["0.1.0"].LocationType = "elsewhere"
+	for _, i := range [][]interface{}{
+		{data.Cookbooks["test1"].Versions["0.1.0"].LocationType, "opscode"},
+		{res.APIInstance == data.APIInstance, false},
+		{data.Clone().Equals(data), true},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+}
+
+func TestUniverseDiffDoesNotAlias(t *testing.T) {
+	data1 := udata()
+	data2 := udata()
+	data2.Cookbooks["test2"] = &universe.Cookbook{
+		Name: "test2",
+		Versions: map[string]*universe.CookbookVersion{
+			"1.0.0": &universe.CookbookVersion{Version: "1.0.0"},
+		},
+	}
+	pos, neg := data2.Diff(data1)
+	neg.Cookbooks["test2"].Versions["1.0.0"].Version = "9.9.9"
+	for _, i := range [][]interface{}{
+		{pos, (*Universe)(nil)},
+		{data2.Cookbooks["test2"].Versions["1.0.0"].Version, "1.0.0"},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+}
+
+func TestUniverseHash(t *testing.T) {
+	data1 := udata()
+	data2 := udata()
+	data2.Component = Component{Endpoint: "https://elsewhere.com", ETag: "abc"}
+	h := data1.Hash()
+	data2.Cookbooks["test1"].Versions["0.1.0"].Dependencies["thing3"] = ">= 0.0.0"
+	for _, i := range [][]interface{}{
+		{len(h), 64},
+		{udata().Hash(), h},
+		{data2.Hash() != h, true},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+}
+
+func TestUniverseUpdateDiffsChangedCookbooks(t *testing.T) {
+	data := ujsonData()
+	body := func() string {
+		res, _ := json.Marshal(data)
+		return string(res)
+	}
+	ts := StartHTTP(body, nil)
+	defer ts.Close()
+
+	a, err := NewAPIInstance(ts.URL)
+	if err != nil {
+		t.Fatalf("Expected no err, got: %v", err)
+	}
+	u, err := NewUniverse(a)
+	if err != nil {
+		t.Fatalf("Expected no err, got: %v", err)
+	}
+	for _, change := range []func(){
+		func() { data["chef"]["0.12.0"].LocationType = "elsewhere" },
+		func() { delete(data, "djbdns") },
+		func() {
+			data["nginx"] = map[string]*universe.CookbookVersion{
+				"1.0.0": &universe.CookbookVersion{Dependencies: map[string]string{}},
+			}
+		},
+	} {
+		old := u.Snapshot()
+		change()
+		pos, neg, err := u.Update()
+		if err != nil {
+			t.Fatalf("Expected no err, got: %v", err)
+		}
+		cur := u.Snapshot()
+		epos, eneg := old.Diff(cur)
+		hashes, _ := universe.HashCookbooks(cur.Cookbooks)
+		for _, i := range [][]interface{}{
+			{pos == nil, epos == nil},
+			{neg == nil, eneg == nil},
+			{pos == nil || pos.Equals(epos), true},
+			{neg == nil || neg.Equals(eneg), true},
+			{len(cur.hashes), len(hashes)},
+			{cur.hashes["chef"], hashes["chef"]},
+		} {
+			if i[0] != i[1] {
+				t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+			}
+		}
+		for _, d := range []*Universe{pos, neg} {
+			if d == nil {
+				continue
+			}
+			for name := range d.Cookbooks {
+				if old.Cookbook(name).Hash() == cur.Cookbook(name).Hash() {
+					t.Fatalf("Expected only changed cookbooks in the diff, got: %v", name)
+				}
+			}
+		}
+	}
+}
+
+const uwireJSON = `{
+	"chef": {
+		"0.12.0": {
+			"location_type": "opscode",
+			"location_path": "https://supermarket.chef.io/api/v1",
+			"download_url": "https://supermarket.chef.io/api/v1/cookbooks/chef/versions/0.12.0/download",
+			"dependencies": {"runit": ">= 0.0.0", "couchdb": ">= 0.0.0"}
+		},
+		"0.20.0": {
+			"location_type": "opscode",
+			"location_path": "https://supermarket.chef.io/api/v1",
+			"download_url": "https://supermarket.chef.io/api/v1/cookbooks/chef/versions/0.20.0/download",
+			"dependencies": {}
+		}
+	},
+	"djbdns": {}
+}`
+
+func TestUniverseJSONRoundTrip(t *testing.T) {
+	u := InitUniverse()
+	err := json.Unmarshal([]byte(uwireJSON), u)
+	if err != nil {
+		t.Fatalf("Expected no err, got: %v", err)
+	}
+	out, err := json.Marshal(u)
+	if err != nil {
+		t.Fatalf("Expected no err, got: %v", err)
+	}
+	var exp, res interface{}
+	json.Unmarshal([]byte(uwireJSON), &exp)
+	json.Unmarshal(out, &res)
+	for _, i := range [][]interface{}{
+		{u.Len(), 2},
+		{u.Cookbook("chef").Name, "chef"},
+		{u.Cookbook("chef").Versions["0.20.0"].Version, "0.20.0"},
+		{u.Cookbook("chef").Versions["0.12.0"].Dependencies["couchdb"], ">= 0.0.0"},
+		{len(u.Cookbook("djbdns").Versions), 0},
+		{reflect.DeepEqual(res, exp), true},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+}
+
+func TestUniverseJSONMatchesNewUniverse(t *testing.T) {
+	ts := StartHTTP(uwireJSON, nil)
+	defer ts.Close()
+	a, err := NewAPIInstance(ts.URL)
+	if err != nil {
+		t.Fatalf("Expected no err, got: %v", err)
+	}
+	u, err := NewUniverse(a)
+	if err != nil {
+		t.Fatalf("Expected no err, got: %v", err)
+	}
+	data, err := json.Marshal(u)
+	if err != nil {
+		t.Fatalf("Expected no err, got: %v", err)
+	}
+	res := InitUniverse()
+	err = json.Unmarshal(data, res)
+	if err != nil {
+		t.Fatalf("Expected no err, got: %v", err)
+	}
+	res.Component = u.Component
+	res.APIInstance = u.APIInstance
+	if !res.Equals(u) {
+		t.Fatalf("Expected %v, got: %v", u, res)
+	}
+}
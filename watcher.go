@@ -0,0 +1,262 @@
+// Author:: Jonathan Hartman (<j@p4nt5.com>)
+//
+// Copyright (C) 2014, Jonathan Hartman
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package goulash implements a Go client library for the Chef Supermarket API.
+
+This file defines a Watcher struct that polls a Universe for updates and
+turns the positive and negative diffs of each one into a stream of events,
+e.g.
+
+	w := goulash.NewWatcher(u, 5*time.Minute)
+	go w.Run(ctx)
+	for {
+		select {
+		case e, ok := <-w.Events:
+			if !ok {
+				return
+			}
+			fmt.Println(e.Type, e.Cookbook, e.Version)
+		case err := <-w.Errors:
+			if err != nil {
+				log.Print(err)
+			}
+		}
+	}
+*/
+package goulash
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/RoboticCheese/goulash/universe"
+)
+
+// EventType identifies the kind of change an Event represents.
+type EventType int
+
+// The types of Event a Watcher can emit.
+const (
+	CookbookAdded EventType = iota
+	CookbookRemoved
+	VersionPublished
+	VersionRemoved
+	DependenciesChanged
+	LocationChanged
+)
+
+// String returns the name of an EventType.
+func (t EventType) String() (res string) {
+	switch t {
+	case CookbookAdded:
+		res = "CookbookAdded"
+	case CookbookRemoved:
+		res = "CookbookRemoved"
+	case VersionPublished:
+		res = "VersionPublished"
+	case VersionRemoved:
+		res = "VersionRemoved"
+	case DependenciesChanged:
+		res = "DependenciesChanged"
+	case LocationChanged:
+		res = "LocationChanged"
+	default:
+		res = "Unknown"
+	}
+	return
+}
+
+// Event implements a single change to a Universe. Version, Old and New are
+// only set for version-level events; Old is nil for a newly published
+// version and New is nil for a removed one.
+type Event struct {
+	Type     EventType
+	Cookbook string
+	Version  string
+	Old      *universe.CookbookVersion
+	New      *universe.CookbookVersion
+}
+
+// ErrInvalidInterval is returned by Run for a Watcher whose Interval isn't
+// positive.
+var ErrInvalidInterval = errors.New("a Watcher's Interval must be positive")
+
+// Watcher implements a poller that updates a Universe at a regular interval
+// and sends any changes to its Events channel. Errors holds one unread error
+// at a time; while it's full, any more are dropped rather than stopping the
+// polling.
+type Watcher struct {
+	Universe *Universe
+	Interval time.Duration
+	Events   chan Event
+	Errors   chan error
+}
+
+// NewWatcher accepts a pointer to a Universe struct and a polling interval
+// and returns a pointer to a new Watcher struct.
+func NewWatcher(u *Universe, interval time.Duration) (w *Watcher) {
+	w = new(Watcher)
+	w.Universe = u
+	w.Interval = interval
+	w.Events = make(chan Event)
+	w.Errors = make(chan error, 1)
+	return
+}
+
+// Run polls for updates until the context is done, at which point it closes
+// the Events and Errors channels and returns the context's error. Each poll
+// is short-circuited by Universe.Update if the ETag hasn't changed. Update
+// errors are sent to the Errors channel and polling continues. A Watcher with
+// an Interval that isn't positive returns ErrInvalidInterval right away.
+func (w *Watcher) Run(ctx context.Context) (err error) {
+	defer close(w.Events)
+	defer close(w.Errors)
+
+	if w.Interval <= 0 {
+		return ErrInvalidInterval
+	}
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		old := w.Universe.Snapshot()
+		pos, neg, uerr := w.Universe.Update()
+		if uerr != nil {
+			select {
+			case w.Errors <- uerr:
+			default:
+			}
+			continue
+		}
+		for _, e := range universeEvents(old, w.Universe.Snapshot(), pos, neg) {
+			select {
+			case w.Events <- e:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+}
+
+// universeEvents uses the positive and negative diffs of an update to find
+// which cookbooks and versions were touched, then compares the old and new
+// snapshots to classify each change. Added and removed cookbooks are followed
+// by an event for each of their versions.
+func universeEvents(old, cur, pos, neg *Universe) (events []Event) {
+	for _, name := range diffCookbookNames(pos, neg) {
+		oc := old.Cookbook(name)
+		nc := cur.Cookbook(name)
+		switch {
+		case oc == nil && nc != nil:
+			events = append(events, Event{Type: CookbookAdded, Cookbook: name})
+			oc = universe.NewCookbook()
+		case oc != nil && nc == nil:
+			events = append(events, Event{Type: CookbookRemoved, Cookbook: name})
+			nc = universe.NewCookbook()
+		case oc == nil && nc == nil:
+			continue
+		}
+		versions := map[string]bool{}
+		for _, c := range []*universe.Cookbook{oc, nc} {
+			for v := range c.Versions {
+				versions[v] = true
+			}
+		}
+		for _, v := range sortedVersions(versions) {
+			events = append(events, versionEvents(name, v, oc.Versions[v], nc.Versions[v])...)
+		}
+	}
+	return
+}
+
+// versionEvents compares an old and new CookbookVersion and returns any
+// events for the changes between them.
+func versionEvents(name, v string, ocv, ncv *universe.CookbookVersion) (events []Event) {
+	e := Event{Cookbook: name, Version: v, Old: ocv, New: ncv}
+	switch {
+	case ocv == nil && ncv == nil:
+	case ocv == nil:
+		e.Type = VersionPublished
+		events = append(events, e)
+	case ncv == nil:
+		e.Type = VersionRemoved
+		events = append(events, e)
+	default:
+		if !equalDependencies(ocv.Dependencies, ncv.Dependencies) {
+			e.Type = DependenciesChanged
+			events = append(events, e)
+		}
+		if ocv.LocationType != ncv.LocationType ||
+			ocv.LocationPath != ncv.LocationPath ||
+			ocv.DownloadURL != ncv.DownloadURL {
+			e.Type = LocationChanged
+			events = append(events, e)
+		}
+	}
+	return
+}
+
+// diffCookbookNames returns the sorted names of every cookbook in a positive
+// and negative diff, either of which may be nil.
+func diffCookbookNames(pos, neg *Universe) (res []string) {
+	set := map[string]bool{}
+	for _, u := range []*Universe{pos, neg} {
+		if u == nil {
+			continue
+		}
+		for name := range u.Cookbooks {
+			set[name] = true
+		}
+	}
+	for name := range set {
+		res = append(res, name)
+	}
+	sort.Strings(res)
+	return
+}
+
+// equalDependencies checks whether two dependency maps hold the same
+// constraints.
+func equalDependencies(d1, d2 map[string]string) (equal bool) {
+	if len(d1) != len(d2) {
+		return
+	}
+	for k, v := range d1 {
+		if v2, ok := d2[k]; !ok || v2 != v {
+			return
+		}
+	}
+	equal = true
+	return
+}
+
+// sortedVersions returns a set of version strings in version order, falling
+// back to string order for any that can't be parsed.
+func sortedVersions(set map[string]bool) (res []string) {
+	for v := range set {
+		res = append(res, v)
+	}
+	universe.SortVersions(res)
+	return
+}
@@ -0,0 +1,243 @@
+package goulash
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/RoboticCheese/goulash/universe"
+)
+
+func TestEventTypeString(t *testing.T) {
+	for _, i := range [][]interface{}{
+		{CookbookAdded.String(), "CookbookAdded"},
+		{CookbookRemoved.String(), "CookbookRemoved"},
+		{VersionPublished.String(), "VersionPublished"},
+		{VersionRemoved.String(), "VersionRemoved"},
+		{DependenciesChanged.String(), "DependenciesChanged"},
+		{LocationChanged.String(), "LocationChanged"},
+		{EventType(99).String(), "Unknown"},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+}
+
+func TestNewWatcher(t *testing.T) {
+	u := udata()
+	w := NewWatcher(u, time.Minute)
+	for _, i := range [][]interface{}{
+		{w.Universe, u},
+		{w.Interval, time.Minute},
+		{w.Events != nil, true},
+		{w.Errors != nil, true},
+	} {
+		if i[0] != i[1] {
+			t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+		}
+	}
+}
+
+func TestUniverseEvents(t *testing.T) {
+	old := udata()
+	old.Cookbooks["gone"] = &universe.Cookbook{
+		Name: "gone",
+		Versions: map[string]*universe.CookbookVersion{
+			"1.0.0": &universe.CookbookVersion{Version: "1.0.0", LocationType: "opscode"},
+		},
+	}
+	cur := udata()
+	cur.Cookbooks["test1"].Versions["0.1.0"].Dependencies["thing3"] = ">= 1.0.0"
+	cur.Cookbooks["test1"].Versions["0.1.0"].DownloadURL = "https://example.com/2"
+	cur.Cookbooks["test1"].Versions["0.10.0"] = &universe.CookbookVersion{Version: "0.10.0", LocationType: "opscode"}
+	cur.Cookbooks["test1"].Versions["0.2.0"] = &universe.CookbookVersion{Version: "0.2.0", LocationType: "opscode"}
+	cur.Cookbooks["new"] = &universe.Cookbook{
+		Name: "new",
+		Versions: map[string]*universe.CookbookVersion{
+			"0.1.0": &universe.CookbookVersion{Version: "0.1.0", LocationType: "opscode"},
+		},
+	}
+	pos, neg := old.Diff(cur)
+	events := universeEvents(old, cur, pos, neg)
+	expected := []Event{
+		{Type: CookbookRemoved, Cookbook: "gone"},
+		{Type: VersionRemoved, Cookbook: "gone", Version: "1.0.0"},
+		{Type: CookbookAdded, Cookbook: "new"},
+		{Type: VersionPublished, Cookbook: "new", Version: "0.1.0"},
+		{Type: DependenciesChanged, Cookbook: "test1", Version: "0.1.0"},
+		{Type: LocationChanged, Cookbook: "test1", Version: "0.1.0"},
+		{Type: VersionPublished, Cookbook: "test1", Version: "0.2.0"},
+		{Type: VersionPublished, Cookbook: "test1", Version: "0.10.0"},
+	}
+	if len(events) != len(expected) {
+		t.Fatalf("Expected %v events, got: %v", len(expected), events)
+	}
+	for n, e := range expected {
+		for _, i := range [][]interface{}{
+			{events[n].Type, e.Type},
+			{events[n].Cookbook, e.Cookbook},
+			{events[n].Version, e.Version},
+		} {
+			if i[0] != i[1] {
+				t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+			}
+		}
+	}
+	if events[0].Old != nil || events[1].Old == nil || events[1].New != nil {
+		t.Fatalf("Expected only an Old version for removals, got: %v", events[1])
+	}
+}
+
+func TestUniverseEventsNoChanges(t *testing.T) {
+	events := universeEvents(udata(), udata(), nil, nil)
+	if len(events) != 0 {
+		t.Fatalf("Expected no events, got: %v", events)
+	}
+}
+
+func TestWatcherRun(t *testing.T) {
+	var lock sync.Mutex
+	etag := "tag1"
+	data := ujsonData()
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		w.Header().Set("ETag", etag)
+		res, _ := json.Marshal(data)
+		w.Write(res)
+	}
+	ts := StartHTTP(handler, nil)
+	defer ts.Close()
+
+	a, err := NewAPIInstance(ts.URL)
+	if err != nil {
+		t.Fatalf("Expected no err, got: %v", err)
+	}
+	u, err := NewUniverse(a)
+	if err != nil {
+		t.Fatalf("Expected no err, got: %v", err)
+	}
+	w := NewWatcher(u, 10*time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	res := make(chan error)
+	go func() {
+		res <- w.Run(ctx)
+	}()
+
+	lock.Lock()
+	delete(data["chef"], "0.12.0")
+	etag = "tag2"
+	lock.Unlock()
+
+	select {
+	case e := <-w.Events:
+		for _, i := range [][]interface{}{
+			{e.Type, VersionRemoved},
+			{e.Cookbook, "chef"},
+			{e.Version, "0.12.0"},
+		} {
+			if i[0] != i[1] {
+				t.Fatalf("Expected: %v, got: %v", i[1], i[0])
+			}
+		}
+	case err := <-w.Errors:
+		t.Fatalf("Expected no err, got: %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timed out waiting for an event")
+	}
+
+	cancel()
+	err = <-res
+	if err != context.Canceled {
+		t.Fatalf("Expected %v, got: %v", context.Canceled, err)
+	}
+	if _, ok := <-w.Events; ok {
+		t.Fatalf("Expected a closed Events channel")
+	}
+}
+
+func TestWatcherRunError(t *testing.T) {
+	ts := StartHTTP(uhttpBody(ujsonData()), nil)
+	a, err := NewAPIInstance(ts.URL)
+	if err != nil {
+		t.Fatalf("Expected no err, got: %v", err)
+	}
+	u, err := NewUniverse(a)
+	if err != nil {
+		t.Fatalf("Expected no err, got: %v", err)
+	}
+	ts.Close()
+
+	w := NewWatcher(u, 10*time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Run(ctx)
+
+	select {
+	case err := <-w.Errors:
+		if err == nil {
+			t.Fatalf("Expected non-nil, got: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timed out waiting for an error")
+	}
+}
+
+func TestWatcherRunInvalidInterval(t *testing.T) {
+	for _, interval := range []time.Duration{0, -time.Second} {
+		w := NewWatcher(InitUniverse(), interval)
+		err := w.Run(context.Background())
+		if err != ErrInvalidInterval {
+			t.Fatalf("Expected: %v, got: %v", ErrInvalidInterval, err)
+		}
+		if _, ok := <-w.Events; ok {
+			t.Fatalf("Expected a closed Events channel")
+		}
+	}
+}
+
+func TestWatcherRunUnreadErrors(t *testing.T) {
+	fail := true
+	var lock sync.Mutex
+	data := ujsonData()
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		if fail {
+			http.Error(w, "down", 500)
+			return
+		}
+		res, _ := json.Marshal(data)
+		w.Write(res)
+	}
+	ts := StartHTTP(handler, nil)
+	defer ts.Close()
+	a := &APIInstance{BaseURL: ts.URL}
+	u := InitUniverse()
+	u.APIInstance = a
+	u.Endpoint = ts.URL + "/universe"
+
+	w := NewWatcher(u, 5*time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Run(ctx)
+
+	// Several polls fail with nobody reading Errors, then one succeeds
+	time.Sleep(50 * time.Millisecond)
+	lock.Lock()
+	fail = false
+	lock.Unlock()
+
+	select {
+	case e := <-w.Events:
+		if e.Type != CookbookAdded {
+			t.Fatalf("Expected: %v, got: %v", CookbookAdded, e.Type)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timed out waiting for an event")
+	}
+}